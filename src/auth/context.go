@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"slices"
+)
+
+const (
+	userIDKey = "auth.user_id"
+	scopesKey = "auth.scopes"
+	roleKey   = "auth.role"
+)
+
+// SetUserID records the authenticated user of a request.
+func SetUserID(c *gin.Context, id uint) {
+	c.Set(userIDKey, id)
+}
+
+// UserID returns the authenticated user of a request, if any.
+func UserID(c *gin.Context) (uint, bool) {
+	id, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, false
+	}
+	uid, ok := id.(uint)
+	return uid, ok
+}
+
+// SetScopes records the scopes the credentials of a request carry.
+func SetScopes(c *gin.Context, scopes []string) {
+	c.Set(scopesKey, scopes)
+}
+
+// Scopes returns the scopes the credentials of a request carry.
+func Scopes(c *gin.Context) []string {
+	scopes, _ := c.Get(scopesKey)
+	list, _ := scopes.([]string)
+	return list
+}
+
+// HasScope reports whether the credentials of a request carry the scope.
+func HasScope(c *gin.Context, scope string) bool {
+	return slices.Contains(Scopes(c), scope)
+}
+
+// SetRole records the role of the authenticated user of a request.
+func SetRole(c *gin.Context, role string) {
+	c.Set(roleKey, role)
+}
+
+// Role returns the role of the authenticated user of a request, empty when
+// there is none.
+func Role(c *gin.Context) string {
+	role, _ := c.Get(roleKey)
+	s, _ := role.(string)
+	return s
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/sync/singleflight"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultJWKSRefresh = time.Hour
+	// DefaultJWKSMinRefetch limits how often an unknown key ID makes the set be
+	// fetched again, so that forged key IDs can't flood the provider.
+	DefaultJWKSMinRefetch = 30 * time.Second
+
+	maxJWKSSize = 1 << 20
+)
+
+var (
+	errUnknownKey = errors.New("no key with this ID in the JWKS")
+	errNoJWKS     = errors.New("the JWKS could not be loaded")
+)
+
+// JWK is a public key of a JSON Web Key Set (RFC 7517). RSA and EC keys are
+// supported.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type verificationKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKS caches the keys of a JSON Web Key Set. The set is loaded again every
+// RefreshInterval, and when a token names a key it doesn't know, which is how
+// providers rotate keys, at most every MinRefetchInterval. Loads run without
+// the lock held, one at a time, so that a slow provider only holds up the
+// requests that need the new keys.
+type JWKS struct {
+	RefreshInterval    time.Duration
+	MinRefetchInterval time.Duration
+
+	load    func(ctx context.Context) ([]byte, error)
+	loading singleflight.Group
+
+	mu        sync.RWMutex
+	keys      map[string]verificationKey
+	fetchedAt time.Time
+}
+
+// NewJWKSFromURL caches the key set served at url.
+func NewJWKSFromURL(url string) *JWKS {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return newJWKS(func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching JWKS: %s", resp.Status)
+		}
+		return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	})
+}
+
+// NewJWKSFromFile caches the key set in a local file, which is read again
+// on refresh, so that keys can be rotated by replacing it.
+func NewJWKSFromFile(path string) *JWKS {
+	return newJWKS(func(context.Context) ([]byte, error) {
+		return os.ReadFile(path)
+	})
+}
+
+func newJWKS(load func(ctx context.Context) ([]byte, error)) *JWKS {
+	return &JWKS{
+		RefreshInterval:    DefaultJWKSRefresh,
+		MinRefetchInterval: DefaultJWKSMinRefetch,
+		load:               load,
+	}
+}
+
+// key returns the key with the given ID. An empty ID matches the only key of
+// a set with one key.
+func (s *JWKS) key(ctx context.Context, kid string) (verificationKey, error) {
+	keys, fetchedAt := s.cached()
+	if keys == nil || time.Since(fetchedAt) >= s.RefreshInterval {
+		err := s.refresh(ctx, fetchedAt)
+		if keys, fetchedAt = s.cached(); keys == nil {
+			if err == nil {
+				err = errNoJWKS
+			}
+			return verificationKey{}, err
+		}
+	}
+
+	key, ok := lookup(keys, kid)
+	if !ok && time.Since(fetchedAt) >= s.MinRefetchInterval {
+		if err := s.refresh(ctx, fetchedAt); err != nil {
+			return verificationKey{}, err
+		}
+		keys, _ = s.cached()
+		key, ok = lookup(keys, kid)
+	}
+	if !ok {
+		return verificationKey{}, errUnknownKey
+	}
+	return key, nil
+}
+
+func (s *JWKS) cached() (map[string]verificationKey, time.Time) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys, s.fetchedAt
+}
+
+func lookup(keys map[string]verificationKey, kid string) (verificationKey, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, ok := keys[kid]
+	return key, ok
+}
+
+// refresh loads the set again, unless it was loaded since seen, the time of
+// the load the caller found cached. Concurrent callers share one load, which
+// doesn't stop when the caller that started it goes away. On failure the
+// cached keys are kept.
+func (s *JWKS) refresh(ctx context.Context, seen time.Time) error {
+	_, err, _ := s.loading.Do("", func() (any, error) {
+		s.mu.Lock()
+		if !s.fetchedAt.Equal(seen) {
+			s.mu.Unlock()
+			return nil, nil
+		}
+		s.fetchedAt = time.Now()
+		s.mu.Unlock()
+
+		keys, err := s.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.keys = keys
+		s.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+// fetch loads and decodes the set, skipping the keys it can't use.
+func (s *JWKS) fetch(ctx context.Context) (map[string]verificationKey, error) {
+	data, err := s.load(ctx)
+	if err != nil {
+		log.Println("error loading JWKS:", err)
+		return nil, err
+	}
+	var set struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		log.Println("error decoding JWKS:", err)
+		return nil, err
+	}
+
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("skipping JWK %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = verificationKey{alg: jwk.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func (k *JWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/tenant"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"os"
+)
+
+const (
+	// ModeEnv names the environment variable selecting who issues bearer
+	// tokens: the API itself ("local", the default), or an OpenID Connect
+	// provider ("oidc").
+	ModeEnv   = "AUTH_MODE"
+	ModeLocal = "local"
+	ModeOIDC  = "oidc"
+
+	// Environment variables configuring the oidc mode. Either the URL or the
+	// file of the JWKS is required.
+	OIDCIssuerEnv      = "OIDC_ISSUER"
+	OIDCAudienceEnv    = "OIDC_AUDIENCE"
+	OIDCJWKSURLEnv     = "OIDC_JWKS_URL"
+	OIDCJWKSFileEnv    = "OIDC_JWKS_FILE"
+	OIDCJWKSRefreshEnv = "OIDC_JWKS_REFRESH"
+	OIDCEmailClaimEnv  = "OIDC_EMAIL_CLAIM"
+	OIDCWorkspaceEnv   = "OIDC_WORKSPACE_CLAIM"
+)
+
+// ErrEmailTaken is returned when a new user of the identity provider has the
+// email of an existing user.
+var ErrEmailTaken = errors.New("the email of the token belongs to another user")
+
+// errUserExists rolls back the creation of a user that exists already.
+var errUserExists = errors.New("the user exists")
+
+// Verifier authenticates bearer tokens.
+type Verifier interface {
+	// UserFromToken returns the user a token identifies. It returns
+	// ErrInvalidToken or ErrExpiredToken for tokens that can't be trusted.
+	UserFromToken(ctx context.Context, token string) (uint, error)
+}
+
+func (i *Issuer) UserFromToken(_ context.Context, token string) (uint, error) {
+	return i.Verify(token)
+}
+
+// OIDCUsers maps the identities of an OpenID Connect provider to users, by
+// issuer and subject. A user is created the first time a subject is seen, in
+// the workspace of its workspace claim, or in a workspace of its own.
+type OIDCUsers struct {
+	provider *OIDC
+	db       *gorm.DB
+}
+
+func NewOIDCUsers(provider *OIDC, db *gorm.DB) *OIDCUsers {
+	return &OIDCUsers{provider: provider, db: db.Session(&gorm.Session{SkipDefaultTransaction: true})}
+}
+
+func (u *OIDCUsers) UserFromToken(ctx context.Context, token string) (uint, error) {
+	identity, err := u.provider.Verify(ctx, token)
+	if err != nil {
+		return 0, err
+	}
+
+	db := u.db.WithContext(ctx)
+	find := func() (*models.User, error) {
+		var user models.User
+		err := db.Where("external_issuer = ? AND external_subject = ?", identity.Issuer, identity.Subject).
+			First(&user).Error
+		return &user, err
+	}
+
+	user, err := find()
+	if err == nil {
+		return user.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		workspaceID, err := u.workspace(tx, identity)
+		if err != nil {
+			return err
+		}
+		role, err := InitialRole(tx, workspaceID)
+		if err != nil {
+			return err
+		}
+
+		user = &models.User{
+			WorkspaceID:     workspaceID,
+			Role:            role,
+			ExternalIssuer:  identity.Issuer,
+			ExternalSubject: identity.Subject,
+		}
+		if identity.Email != "" {
+			user.Email = &identity.Email
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(user)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errUserExists
+		}
+		return nil
+	})
+	if err == nil {
+		return user.ID, nil
+	}
+	if !errors.Is(err, errUserExists) {
+		return 0, err
+	}
+
+	// Created concurrently, or the email is taken.
+	user, err = find()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, ErrEmailTaken
+	}
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// workspace returns the workspace of a new user: the one of its workspace
+// claim, created if needed, or a new one.
+func (u *OIDCUsers) workspace(tx *gorm.DB, identity *Identity) (uint, error) {
+	workspace := models.Workspace{Name: identity.Email}
+	if workspace.Name == "" {
+		workspace.Name = identity.Subject
+	}
+	if identity.Workspace != "" {
+		workspace = models.Workspace{
+			Name:           identity.Workspace,
+			ExternalIssuer: identity.Issuer,
+			ExternalID:     identity.Workspace,
+		}
+	}
+
+	created, err := tenant.CreateWorkspace(tx, &workspace)
+	if err != nil || created {
+		return workspace.ID, err
+	}
+	err = tx.Where("external_issuer = ? AND external_id = ?", workspace.ExternalIssuer, workspace.ExternalID).
+		First(&workspace).Error
+	return workspace.ID, err
+}
+
+// VerifierFromEnv builds the verifier of the mode selected by AUTH_MODE. The
+// issuer is nil in oidc mode, where the API issues no tokens of its own.
+func VerifierFromEnv(db *gorm.DB) (Verifier, *Issuer, error) {
+	switch mode := os.Getenv(ModeEnv); mode {
+	case "", ModeLocal:
+		issuer, err := FromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		return issuer, issuer, nil
+	case ModeOIDC:
+		provider, err := OIDCFromEnv()
+		if err != nil {
+			return nil, nil, err
+		}
+		return NewOIDCUsers(provider, db), nil, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid %s %q, expected %q or %q", ModeEnv, mode, ModeLocal, ModeOIDC)
+	}
+}
+
+// OIDCFromEnv configures the provider from the OIDC_* environment variables.
+func OIDCFromEnv() (*OIDC, error) {
+	provider := &OIDC{
+		Issuer:         os.Getenv(OIDCIssuerEnv),
+		Audience:       os.Getenv(OIDCAudienceEnv),
+		EmailClaim:     os.Getenv(OIDCEmailClaimEnv),
+		WorkspaceClaim: os.Getenv(OIDCWorkspaceEnv),
+	}
+	if provider.Issuer == "" || provider.Audience == "" {
+		return nil, fmt.Errorf("%s and %s are required in %s mode", OIDCIssuerEnv, OIDCAudienceEnv, ModeOIDC)
+	}
+	if provider.EmailClaim == "" {
+		provider.EmailClaim = "email"
+	}
+
+	switch url, file := os.Getenv(OIDCJWKSURLEnv), os.Getenv(OIDCJWKSFileEnv); {
+	case url != "" && file != "":
+		return nil, fmt.Errorf("only one of %s and %s can be set", OIDCJWKSURLEnv, OIDCJWKSFileEnv)
+	case url != "":
+		provider.Keys = NewJWKSFromURL(url)
+	case file != "":
+		provider.Keys = NewJWKSFromFile(file)
+	default:
+		return nil, fmt.Errorf("%s or %s is required in %s mode", OIDCJWKSURLEnv, OIDCJWKSFileEnv, ModeOIDC)
+	}
+
+	refresh, err := durationFromEnv(OIDCJWKSRefreshEnv, DefaultJWKSRefresh)
+	if err != nil {
+		return nil, err
+	}
+	provider.Keys.RefreshInterval = refresh
+	return provider, nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is how far the clocks of the provider and the API may drift.
+const clockSkew = time.Minute
+
+// Identity is who a token of the identity provider was issued to.
+type Identity struct {
+	Issuer  string
+	Subject string
+	// Email is empty when the token has no verified email.
+	Email string
+	// Workspace is the value of the workspace claim, empty when there is none.
+	Workspace string
+}
+
+// OIDC verifies the ID or access tokens of an OpenID Connect provider,
+// acting as a resource server: tokens must be signed by a key of the
+// provider's JWKS, issued by Issuer for Audience, and not expired.
+type OIDC struct {
+	Issuer   string
+	Audience string
+	// EmailClaim names the claim the email of users is read from.
+	EmailClaim string
+	// WorkspaceClaim names the claim users sharing a workspace have in
+	// common, such as the ID of their organization. Without it, every user
+	// gets a workspace of their own.
+	WorkspaceClaim string
+	Keys           *JWKS
+}
+
+// audience is the "aud" claim, a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify checks a token and returns the identity it carries.
+func (o *OIDC) Verify(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var head struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return nil, ErrInvalidToken
+	}
+	hash, ok := signatureHashes[head.Alg]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	key, err := o.Keys.key(ctx, head.Kid)
+	if err != nil {
+		if errors.Is(err, errUnknownKey) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if key.alg != "" && key.alg != head.Alg {
+		return nil, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !verifySignature(key.key, head.Alg, hash, parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims map[string]json.RawMessage
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	var registered struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		ExpiresAt *int64   `json:"exp"`
+		NotBefore *int64   `json:"nbf"`
+	}
+	if err := decodeSegment(parts[1], &registered); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if registered.Issuer != o.Issuer || registered.Subject == "" || !slices.Contains(registered.Audience, o.Audience) {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if registered.ExpiresAt == nil {
+		return nil, ErrInvalidToken
+	}
+	if !now.Add(-clockSkew).Before(time.Unix(*registered.ExpiresAt, 0)) {
+		return nil, ErrExpiredToken
+	}
+	if registered.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(*registered.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+
+	identity := &Identity{Issuer: registered.Issuer, Subject: registered.Subject}
+	var email string
+	var verified *bool
+	_ = json.Unmarshal(claims[o.EmailClaim], &email)
+	_ = json.Unmarshal(claims["email_verified"], &verified)
+	if email != "" && (verified == nil || *verified) {
+		identity.Email = strings.ToLower(email)
+	}
+	if o.WorkspaceClaim != "" {
+		_ = json.Unmarshal(claims[o.WorkspaceClaim], &identity.Workspace)
+	}
+	return identity, nil
+}
+
+// signatureHashes are the algorithms tokens of the provider may be signed
+// with. Symmetric algorithms and "none" are refused.
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// curveBits are the curves ECDSA algorithms are used with.
+var curveBits = map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, signed string, signature []byte) bool {
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(pub, hash, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		bits := pub.Curve.Params().BitSize
+		size := (bits + 7) / 8
+		if curveBits[alg] != bits || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	default:
+		return false
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MinPasswordLength = 8
+	// MaxPasswordLength is the longest password bcrypt takes into account.
+	MaxPasswordLength = 72
+)
+
+// dummyHash is compared against when a login names an unknown user, so that
+// it takes as long as one with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("graph-task"), bcrypt.DefaultCost)
+
+// ValidatePassword checks the length of a new password.
+func ValidatePassword(password string) error {
+	switch {
+	case len(password) < MinPasswordLength:
+		return errors.New("\"password\" must be at least 8 characters long")
+	case len(password) > MaxPasswordLength:
+		return errors.New("\"password\" cannot be longer than 72 bytes")
+	}
+	return nil
+}
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+// CheckPassword reports whether the password matches the hash. An empty hash
+// never matches, but costs the same time to check.
+func CheckPassword(hash, password string) bool {
+	if hash == "" {
+		_ = bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"github.com/alirezamastery/graph_task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InitialRole is the role of a user about to be created in a workspace. The
+// first user of a workspace becomes its admin, so that someone can assign
+// roles; the ones after get the default role. It must be called in the
+// transaction creating the user: the workspace stays locked until its end, so
+// that users signing up at once can't all count none and become admins.
+func InitialRole(tx *gorm.DB, workspaceID uint) (string, error) {
+	var workspace models.Workspace
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&workspace, workspaceID).Error; err != nil {
+		return "", err
+	}
+
+	var n int64
+	if err := tx.Model(&models.User{}).Where("workspace_id = ?", workspaceID).Count(&n).Error; err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return models.RoleAdmin, nil
+	}
+	return models.DefaultRole, nil
+}
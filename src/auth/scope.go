@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Scopes of the API. Routes require one of them; access tokens of users carry
+// all of them, API keys the ones they were created with.
+const (
+	ScopeTodosRead     = "todos:read"
+	ScopeTodosWrite    = "todos:write"
+	ScopeTagsRead      = "tags:read"
+	ScopeTagsWrite     = "tags:write"
+	ScopeProjectsRead  = "projects:read"
+	ScopeProjectsWrite = "projects:write"
+	ScopeKeysRead      = "keys:read"
+	ScopeKeysWrite     = "keys:write"
+	ScopeUsersRead     = "users:read"
+	ScopeUsersWrite    = "users:write"
+)
+
+// AllScopes lists every scope, in the order they are documented.
+var AllScopes = []string{
+	ScopeTodosRead, ScopeTodosWrite,
+	ScopeTagsRead, ScopeTagsWrite,
+	ScopeProjectsRead, ScopeProjectsWrite,
+	ScopeKeysRead, ScopeKeysWrite,
+	ScopeUsersRead, ScopeUsersWrite,
+}
+
+const (
+	// APIKeyHeader is the header API keys are sent in.
+	APIKeyHeader = "X-API-Key"
+	// APIKeyPrefix starts every API key, so that leaked keys are easy to spot.
+	APIKeyPrefix = "gt_"
+	// apiKeyVisible is how many characters of a key are kept to tell it apart.
+	apiKeyVisible = len(APIKeyPrefix) + 6
+)
+
+// ParseScopes validates a list of scopes and returns it sorted, without
+// duplicates.
+func ParseScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	parsed := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(AllScopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		parsed = append(parsed, scope)
+	}
+	slices.Sort(parsed)
+	return slices.Compact(parsed), nil
+}
+
+// NewAPIKey returns a random API key, the prefix it is listed by and the hash
+// to store for it.
+func NewAPIKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:apiKeyVisible], HashAPIKey(key), nil
+}
+
+// HashAPIKey is the hash API keys are stored and looked up by.
+func HashAPIKey(key string) string {
+	return hashSecret(key)
+}
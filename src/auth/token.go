@@ -0,0 +1,173 @@
+// Package auth issues and verifies the credentials of API users: bcrypt
+// password hashes, HS256 JWT access tokens, opaque refresh tokens and scoped
+// API keys.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// SecretEnv names the environment variable holding the key access tokens
+	// are signed with. It is required.
+	SecretEnv = "JWT_SECRET"
+	// AccessTTLEnv and RefreshTTLEnv name the environment variables holding
+	// token lifetimes, as Go durations (e.g. "10m").
+	AccessTTLEnv  = "ACCESS_TOKEN_TTL"
+	RefreshTTLEnv = "REFRESH_TOKEN_TTL"
+
+	DefaultAccessTTL  = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+
+	// TokenIssuer is the "iss" claim of the access tokens issued here.
+	TokenIssuer = "graph-task"
+
+	minSecretLength = 32
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token has expired")
+)
+
+// header is the only JOSE header access tokens are signed with.
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Claims are the claims of an access token. The subject is the user ID.
+type Claims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Issuer signs and verifies access tokens.
+type Issuer struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+func NewIssuer(secret []byte, accessTTL, refreshTTL time.Duration) *Issuer {
+	return &Issuer{secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL, now: time.Now}
+}
+
+// FromEnv builds the issuer from JWT_SECRET, ACCESS_TOKEN_TTL and
+// REFRESH_TOKEN_TTL.
+func FromEnv() (*Issuer, error) {
+	secret := os.Getenv(SecretEnv)
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("%s must be set to at least %d characters", SecretEnv, minSecretLength)
+	}
+	accessTTL, err := durationFromEnv(AccessTTLEnv, DefaultAccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	refreshTTL, err := durationFromEnv(RefreshTTLEnv, DefaultRefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	return NewIssuer([]byte(secret), accessTTL, refreshTTL), nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return d, nil
+}
+
+// AccessToken signs an access token for the user, valid for AccessTTL.
+func (i *Issuer) AccessToken(userID uint) (string, time.Time, error) {
+	now := i.now()
+	expiresAt := now.Add(i.AccessTTL)
+	payload, err := json.Marshal(Claims{
+		Issuer:    TokenIssuer,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + i.sign(signed), expiresAt, nil
+}
+
+// Verify checks the signature and expiry of an access token and returns the
+// user it was issued to.
+func (i *Issuer) Verify(token string) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return 0, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(i.sign(parts[0]+"."+parts[1]))) {
+		return 0, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return 0, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Issuer != TokenIssuer {
+		return 0, ErrInvalidToken
+	}
+	if i.now().Unix() >= claims.ExpiresAt {
+		return 0, ErrExpiredToken
+	}
+
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || userID == 0 {
+		return 0, ErrInvalidToken
+	}
+	return uint(userID), nil
+}
+
+func (i *Issuer) sign(data string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewRefreshToken returns a random refresh token and the hash to store for it.
+func NewRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken is the hash refresh tokens are stored and looked up by.
+func HashRefreshToken(token string) string {
+	return hashSecret(token)
+}
+
+// hashSecret hashes random secrets for storage. Unlike passwords, they are
+// too long to be guessed, so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
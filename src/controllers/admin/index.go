@@ -0,0 +1,21 @@
+package adminctrl
+
+import (
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type Controller struct {
+	db     *gorm.DB
+	policy *rbac.Policy
+}
+
+func NewAdminController(db *gorm.DB, policy *rbac.Policy) *Controller {
+	return &Controller{db: db, policy: policy}
+}
+
+// dbFor returns the database scoped to the workspace of the request.
+func (ctl *Controller) dbFor(c *gin.Context) *gorm.DB {
+	return ctl.db.WithContext(c.Request.Context())
+}
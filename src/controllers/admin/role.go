@@ -0,0 +1,253 @@
+package adminctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errLastAdmin = errors.New("the last admin can't be given another role")
+
+// RoleResponse is a role with the permissions it grants.
+type RoleResponse struct {
+	Name        string   `json:"name" example:"editor"`
+	Permissions []string `json:"permissions" example:"todos:read,todos:create,todos:update,todos:delete"`
+}
+
+type RoleListResponse struct {
+	Items []RoleResponse `json:"items"`
+}
+
+type UserListResponse struct {
+	Items []models.User `json:"items"`
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List the roles users can have and the permissions each grants, from the most to the least privileged
+// @Tags admin
+// @Produce json
+// @Success 200 {object} RoleListResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 500 {object} problem.Problem
+// @Router /admin/roles [get]
+func (ctl *Controller) ListRoles() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.UsersRead) {
+			return
+		}
+
+		items := make([]RoleResponse, 0, len(models.Roles))
+		for _, role := range models.Roles {
+			items = append(items, RoleResponse{Name: role, Permissions: rbac.Permissions(role)})
+		}
+
+		c.JSON(http.StatusOK, RoleListResponse{Items: items})
+	}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List the users of the workspace with their roles, ordered by ID
+// @Tags admin
+// @Produce json
+// @Success 200 {object} UserListResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 500 {object} problem.Problem
+// @Router /admin/users [get]
+func (ctl *Controller) ListUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.UsersRead) {
+			return
+		}
+
+		items := []models.User{}
+		if err := ctl.dbFor(c).Order("id").Find(&items).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, UserListResponse{Items: items})
+	}
+}
+
+// CreateUser godoc
+// @Summary Add a user
+// @Description Create a user account in the workspace of the admin, with the given role or the default one. Emails
+// @Description are lower-cased and must be unique; passwords must be 8 to 72 bytes long. Only available when
+// @Description passwords are managed here rather than by an OpenID Connect provider.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body adminctrl.CreateUser.Payload true "User"
+// @Success 201 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /admin/users [post]
+func (ctl *Controller) CreateUser() gin.HandlerFunc {
+	type Payload struct {
+		Email    string `json:"email" example:"bob@example.com"`
+		Password string `json:"password" example:"correct horse battery staple"`
+		Role     string `json:"role" example:"editor"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		email, err := models.NormalizeEmail(p.Email)
+		if err != nil {
+			return nil, problem.Invalid("email", err.Error())
+		}
+		p.Email = email
+
+		if err := auth.ValidatePassword(p.Password); err != nil {
+			return nil, problem.Invalid("password", err.Error())
+		}
+
+		p.Role = strings.ToLower(strings.TrimSpace(p.Role))
+		switch {
+		case p.Role == "":
+			p.Role = models.DefaultRole
+		case !models.ValidRole(p.Role):
+			return nil, problem.Invalid("role", "\"role\" must be one of "+strings.Join(models.Roles, ", "))
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.UsersCreate) {
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		hash, err := auth.HashPassword(payload.Password)
+		if err != nil {
+			problem.Write(c, problem.Internal(err))
+			return
+		}
+
+		// The workspace is set from the request by the tenant plugin.
+		user := models.User{Email: &payload.Email, PasswordHash: hash, Role: payload.Role}
+		if err := ctl.dbFor(c).Create(&user).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// SetUserRole godoc
+// @Summary Assign a role
+// @Description Assign a role to a user. The change applies to the next request of the user. The last admin can't be
+// @Description given another role.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param request body adminctrl.SetUserRole.Payload true "Role"
+// @Success 200 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /admin/users/{id}/role [put]
+func (ctl *Controller) SetUserRole() gin.HandlerFunc {
+	type Payload struct {
+		Role string `json:"role" example:"viewer"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		p.Role = strings.ToLower(strings.TrimSpace(p.Role))
+		if !models.ValidRole(p.Role) {
+			return nil, problem.Invalid("role", "\"role\" must be one of "+strings.Join(models.Roles, ", "))
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.RolesAssign) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var user models.User
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			// Admins are locked before the user, in the same order by every
+			// request, so that two admins can't demote each other at once.
+			var admins []uint
+			if payload.Role != models.RoleAdmin {
+				err := tx.Model(&models.User{}).
+					Clauses(clause.Locking{Strength: "UPDATE"}).
+					Where("role = ?", models.RoleAdmin).
+					Order("id").
+					Pluck("id", &admins).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, id).Error; err != nil {
+				return err
+			}
+			if user.Role == payload.Role {
+				return nil
+			}
+			if user.Role == models.RoleAdmin && len(admins) <= 1 {
+				return errLastAdmin
+			}
+			return tx.Model(&user).Update("role", payload.Role).Error
+		})
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, user)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			problem.Write(c, problem.NotFound("user not found"))
+		case errors.Is(err, errLastAdmin):
+			problem.Write(c, problem.New(http.StatusConflict, problem.CodeLastAdmin, err.Error()))
+		default:
+			problem.Write(c, problem.FromDB(err))
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package authctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errInvalidRefreshToken = errors.New("the refresh token is invalid, expired or already used")
+
+// TokenResponse is the answer to a login or a refresh.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token" example:"eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."`
+	TokenType    string `json:"token_type" example:"Bearer"`
+	ExpiresIn    int    `json:"expires_in" example:"900"`
+	RefreshToken string `json:"refresh_token" example:"h3Xr0Jf5kq1c0wz4b3ZB6n8b0d5xGq1R2yJt9mU7sLk"`
+}
+
+type RefreshPayload struct {
+	RefreshToken string `json:"refresh_token" example:"h3Xr0Jf5kq1c0wz4b3ZB6n8b0d5xGq1R2yJt9mU7sLk"`
+}
+
+// Register godoc
+// @Summary Register a user
+// @Description Create a user account along with a workspace, of which the user is the admin. Emails are lower-cased
+// @Description and must be unique; passwords must be 8 to 72 bytes long. Admins add other users to their workspace
+// @Description with POST /admin/users.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body authctrl.Register.Payload true "Credentials"
+// @Success 201 {object} models.User
+// @Failure 400 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/register [post]
+func (ctl *Controller) Register() gin.HandlerFunc {
+	type Payload struct {
+		Email    string `json:"email" example:"ada@example.com"`
+		Password string `json:"password" example:"correct horse battery staple"`
+		// Workspace names the workspace created for the user, their email
+		// by default.
+		Workspace string `json:"workspace" example:"Analytical Engines"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		email, err := normalizeEmail(p.Email)
+		if err != nil {
+			return nil, err
+		}
+		p.Email = email
+
+		if err := auth.ValidatePassword(p.Password); err != nil {
+			return nil, problem.Invalid("password", err.Error())
+		}
+
+		p.Workspace = strings.TrimSpace(p.Workspace)
+		switch {
+		case p.Workspace == "":
+			p.Workspace = p.Email
+		case len(p.Workspace) > 255:
+			return nil, problem.Invalid("workspace", "\"workspace\" cannot be longer than 255 characters")
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		hash, err := auth.HashPassword(payload.Password)
+		if err != nil {
+			problem.Write(c, problem.Internal(err))
+			return
+		}
+
+		user := models.User{Email: &payload.Email, PasswordHash: hash, Role: models.RoleAdmin}
+		err = ctl.db.Transaction(func(tx *gorm.DB) error {
+			workspace := models.Workspace{Name: payload.Workspace}
+			if _, err := tenant.CreateWorkspace(tx, &workspace); err != nil {
+				return err
+			}
+			user.WorkspaceID = workspace.ID
+			return tx.Create(&user).Error
+		})
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// Login godoc
+// @Summary Log in
+// @Description Exchange an email and password for a short-lived access token and a refresh token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body authctrl.Login.Payload true "Credentials"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/login [post]
+func (ctl *Controller) Login() gin.HandlerFunc {
+	type Payload struct {
+		Email    string `json:"email" example:"ada@example.com"`
+		Password string `json:"password" example:"correct horse battery staple"`
+	}
+
+	return func(c *gin.Context) {
+		payload := &Payload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var user models.User
+		err := ctl.db.Where("email = ?", strings.ToLower(strings.TrimSpace(payload.Email))).First(&user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+		if !auth.CheckPassword(user.PasswordHash, payload.Password) {
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidCredentials, "wrong email or password"))
+			return
+		}
+
+		var resp *TokenResponse
+		err = ctl.db.Transaction(func(tx *gorm.DB) error {
+			resp, err = ctl.issueTokens(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used
+// @Description once.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshPayload true "Refresh token"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/refresh [post]
+func (ctl *Controller) Refresh() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload := &RefreshPayload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var resp *TokenResponse
+		err := ctl.db.Transaction(func(tx *gorm.DB) error {
+			userID, err := revokeRefreshToken(tx, payload.RefreshToken)
+			if err != nil {
+				return err
+			}
+			resp, err = ctl.issueTokens(tx, userID)
+			return err
+		})
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, resp)
+		case errors.Is(err, errInvalidRefreshToken):
+			problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, err.Error()))
+		default:
+			problem.Write(c, problem.FromDB(err))
+		}
+	}
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revoke a refresh token. Access tokens already issued stay valid until they expire.
+// @Tags auth
+// @Accept json
+// @Param request body RefreshPayload true "Refresh token"
+// @Success 204
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/logout [post]
+func (ctl *Controller) Logout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		payload := &RefreshPayload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		if _, err := revokeRefreshToken(ctl.db, payload.RefreshToken); err != nil && !errors.Is(err, errInvalidRefreshToken) {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// GetCurrentUser godoc
+// @Summary Get the current user
+// @Description Get the user the access token was issued to
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.User
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/me [get]
+func (ctl *Controller) GetCurrentUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.UserID(c)
+		if !ok {
+			problem.Write(c, problem.Status(http.StatusUnauthorized, "an access token is required"))
+			return
+		}
+
+		var user models.User
+		if err := ctl.db.First(&user, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "the user no longer exists"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, user)
+	}
+}
+
+// issueTokens signs an access token and stores a new refresh token.
+func (ctl *Controller) issueTokens(tx *gorm.DB, userID uint) (*TokenResponse, error) {
+	access, _, err := ctl.issuer.AccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+	refresh, hash, err := auth.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ctl.issuer.RefreshTTL),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(ctl.issuer.AccessTTL.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// revokeRefreshToken revokes a valid refresh token and returns its user.
+func revokeRefreshToken(tx *gorm.DB, token string) (uint, error) {
+	if token == "" {
+		return 0, errInvalidRefreshToken
+	}
+
+	now := time.Now()
+	var record models.RefreshToken
+	res := tx.Model(&record).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "user_id"}}}).
+		Where("token_hash = ? AND revoked_at IS NULL AND expires_at > ?", auth.HashRefreshToken(token), now).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return 0, errInvalidRefreshToken
+	}
+	return record.UserID, nil
+}
+
+func normalizeEmail(email string) (string, error) {
+	email, err := models.NormalizeEmail(email)
+	if err != nil {
+		return "", problem.Invalid("email", err.Error())
+	}
+	return email, nil
+}
@@ -0,0 +1,15 @@
+package authctrl
+
+import (
+	"github.com/alirezamastery/graph_task/auth"
+	"gorm.io/gorm"
+)
+
+type Controller struct {
+	db     *gorm.DB
+	issuer *auth.Issuer
+}
+
+func NewAuthController(db *gorm.DB, issuer *auth.Issuer) *Controller {
+	return &Controller{db: db, issuer: issuer}
+}
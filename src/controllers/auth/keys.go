@@ -0,0 +1,205 @@
+package authctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIKeyResponse is an API key as listed. The key itself is only returned
+// once, when it is created.
+type APIKeyResponse struct {
+	models.APIKey
+	Scopes []string `json:"scopes" example:"todos:read,todos:write"`
+	Key    string   `json:"key,omitempty" example:"gt_Q2hhbmdlIG1lIHRvIGEgcmFuZG9tIGtleQ"`
+}
+
+type APIKeyListResponse struct {
+	Items []APIKeyResponse `json:"items"`
+}
+
+// CreateAPIKey godoc
+// @Summary Create an API key
+// @Description Create an API key for the current user, sent in the X-API-Key header. It only grants the listed scopes,
+// @Description which must be carried by the credentials creating it. The key is only returned in this response.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body authctrl.CreateAPIKey.Payload true "API key"
+// @Success 201 {object} APIKeyResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/keys [post]
+func (ctl *Controller) CreateAPIKey() gin.HandlerFunc {
+	type Payload struct {
+		Name      string     `json:"name" example:"nightly import"`
+		Scopes    []string   `json:"scopes" example:"todos:read,todos:write"`
+		ExpiresAt *time.Time `json:"expires_at" example:"2027-01-01T00:00:00Z"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		p.Name = strings.TrimSpace(p.Name)
+		switch {
+		case p.Name == "":
+			return nil, problem.Invalid("name", "\"name\" cannot be empty")
+		case len(p.Name) > 100:
+			return nil, problem.Invalid("name", "\"name\" cannot be longer than 100 characters")
+		}
+
+		scopes, err := auth.ParseScopes(p.Scopes)
+		if err != nil {
+			return nil, problem.Invalid("scopes", err.Error())
+		}
+		p.Scopes = scopes
+
+		if p.ExpiresAt != nil && !p.ExpiresAt.After(time.Now()) {
+			return nil, problem.Invalid("expires_at", "\"expires_at\" must be in the future")
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		userID, ok := auth.UserID(c)
+		if !ok {
+			problem.Write(c, problem.Status(http.StatusUnauthorized, "an access token is required"))
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		// A key can't grant more than the credentials creating it.
+		for _, scope := range payload.Scopes {
+			if !auth.HasScope(c, scope) {
+				problem.Write(c, problem.New(http.StatusForbidden, problem.CodeInsufficientScope,
+					fmt.Sprintf("the credentials lack the %s scope, so they can't grant it", scope)))
+				return
+			}
+		}
+
+		key, prefix, hash, err := auth.NewAPIKey()
+		if err != nil {
+			problem.Write(c, problem.Internal(err))
+			return
+		}
+
+		apiKey := models.APIKey{
+			UserID:    userID,
+			Name:      payload.Name,
+			Prefix:    prefix,
+			KeyHash:   hash,
+			Scopes:    strings.Join(payload.Scopes, ","),
+			ExpiresAt: payload.ExpiresAt,
+		}
+		if err := ctl.db.Create(&apiKey).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		resp := newAPIKeyResponse(apiKey)
+		resp.Key = key
+		c.JSON(http.StatusCreated, resp)
+	}
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description List the API keys of the current user, revoked ones included, newest first
+// @Tags auth
+// @Produce json
+// @Success 200 {object} APIKeyListResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/keys [get]
+func (ctl *Controller) ListAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.UserID(c)
+		if !ok {
+			problem.Write(c, problem.Status(http.StatusUnauthorized, "an access token is required"))
+			return
+		}
+
+		keys := []models.APIKey{}
+		if err := ctl.db.Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		items := make([]APIKeyResponse, 0, len(keys))
+		for _, key := range keys {
+			items = append(items, newAPIKeyResponse(key))
+		}
+		c.JSON(http.StatusOK, APIKeyListResponse{Items: items})
+	}
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke an API key
+// @Description Revoke an API key of the current user. Requests made with it are refused from then on.
+// @Tags auth
+// @Param id path int true "API key ID"
+// @Success 204
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /auth/keys/{id} [delete]
+func (ctl *Controller) RevokeAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := auth.UserID(c)
+		if !ok {
+			problem.Write(c, problem.Status(http.StatusUnauthorized, "an access token is required"))
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var key models.APIKey
+		if err := ctl.db.Where("user_id = ?", userID).First(&key, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("API key not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		if key.RevokedAt == nil {
+			if err := ctl.db.Model(&key).Update("revoked_at", time.Now()).Error; err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func newAPIKeyResponse(key models.APIKey) APIKeyResponse {
+	return APIKeyResponse{APIKey: key, Scopes: key.ScopeList()}
+}
@@ -0,0 +1,279 @@
+package projectctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errDefaultProject = errors.New("the default project cannot be deleted")
+
+type ProjectListResponse struct {
+	Items []models.Project `json:"items"`
+}
+
+// GetProjectList godoc
+// @Summary List projects
+// @Description List all projects ordered by name
+// @Tags projects
+// @Produce json
+// @Success 200 {object} ProjectListResponse
+// @Failure 500 {object} problem.Problem
+// @Router /projects [get]
+func (ctl *Controller) GetProjectList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items := []models.Project{}
+		if err := ctl.dbFor(c).Order("name").Find(&items).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, ProjectListResponse{Items: items})
+	}
+}
+
+// GetProjectByID godoc
+// @Summary Get a project
+// @Description Get a project by ID
+// @Tags projects
+// @Produce json
+// @Param pid path int true "Project ID"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /projects/{pid} [get]
+func (ctl *Controller) GetProjectByID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("pid"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var project models.Project
+		if err := ctl.dbFor(c).First(&project, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("project not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// CreateProject godoc
+// @Summary Create project
+// @Description Create a new project. Project names are unique.
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param request body projectctrl.CreateProject.Payload true "Project payload"
+// @Success 201 {object} models.Project
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 409 {object} problem.Problem
+// @Router /projects [post]
+func (ctl *Controller) CreateProject() gin.HandlerFunc {
+	type Payload struct {
+		Name        string `json:"name" example:"Platform team"`
+		Description string `json:"description"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" {
+			return nil, problem.Invalid("name", "\"name\" cannot be empty")
+		}
+		if len(p.Name) > 100 {
+			return nil, problem.Invalid("name", "\"name\" cannot be longer than 100 characters")
+		}
+		p.Description = strings.TrimSpace(p.Description)
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.ProjectsWrite) {
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		project := models.Project{Name: payload.Name, Description: payload.Description}
+		if err := ctl.dbFor(c).Create(&project).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, project)
+	}
+}
+
+// UpdateProject godoc
+// @Summary Update a project
+// @Description Rename a project or change its description
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param pid path int true "Project ID"
+// @Param payload body projectctrl.UpdateProject.Payload true "Fields to update"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /projects/{pid} [patch]
+func (ctl *Controller) UpdateProject() gin.HandlerFunc {
+	type Payload struct {
+		Name        *string `json:"name" example:"Platform team"`
+		Description *string `json:"description"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		if p.Name != nil {
+			*p.Name = strings.TrimSpace(*p.Name)
+			if *p.Name == "" {
+				return nil, problem.Invalid("name", "\"name\" cannot be empty")
+			}
+			if len(*p.Name) > 100 {
+				return nil, problem.Invalid("name", "\"name\" cannot be longer than 100 characters")
+			}
+		}
+		if p.Description != nil {
+			*p.Description = strings.TrimSpace(*p.Description)
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.ProjectsWrite) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("pid"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		updates := map[string]any{}
+		if payload.Name != nil {
+			updates["name"] = *payload.Name
+		}
+		if payload.Description != nil {
+			updates["description"] = *payload.Description
+		}
+		if len(updates) == 0 {
+			problem.Write(c, problem.BadRequest("no fields to update"))
+			return
+		}
+
+		var project models.Project
+		if err := ctl.dbFor(c).First(&project, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("project not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		if err := ctl.dbFor(c).Model(&project).Updates(updates).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// DeleteProject godoc
+// @Summary Delete a project
+// @Description Delete a project together with all of its todos, which also needs the todos:delete permission. The default project cannot be deleted.
+// @Tags projects
+// @Produce json
+// @Param pid path int true "Project ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /projects/{pid} [delete]
+func (ctl *Controller) DeleteProject() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.ProjectsWrite) {
+			return
+		}
+		if !ctl.policy.Authorize(c, rbac.TodosDelete) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("pid"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var removed int64
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			var project models.Project
+			if err := tx.First(&project, id).Error; err != nil {
+				return err
+			}
+			if project.IsDefault {
+				return errDefaultProject
+			}
+
+			if err := tx.Model(&models.TodoItem{}).Where("project_id = ?", project.ID).Count(&removed).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&project).Error
+		})
+
+		switch {
+		case err == nil:
+			middleware.TasksCount.Sub(float64(removed))
+			c.Status(http.StatusNoContent)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			problem.Write(c, problem.NotFound("project not found"))
+		case errors.Is(err, errDefaultProject):
+			problem.Write(c, problem.New(http.StatusConflict, problem.CodeConflict, err.Error()))
+		default:
+			problem.Write(c, problem.FromDB(err))
+		}
+	}
+}
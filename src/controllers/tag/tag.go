@@ -0,0 +1,231 @@
+package tagctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+type TagListResponse struct {
+	Items []models.Tag `json:"items"`
+}
+
+// GetTagList godoc
+// @Summary List tags
+// @Description List all tags ordered by name
+// @Tags tags
+// @Produce json
+// @Success 200 {object} TagListResponse
+// @Failure 500 {object} problem.Problem
+// @Router /tags [get]
+func (ctl *Controller) GetTagList() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		items := []models.Tag{}
+		if err := ctl.dbFor(c).Order("name").Find(&items).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, TagListResponse{Items: items})
+	}
+}
+
+// GetTagByID godoc
+// @Summary Get a tag
+// @Description Get a tag by ID
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tags/{id} [get]
+func (ctl *Controller) GetTagByID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var tag models.Tag
+		if err := ctl.dbFor(c).First(&tag, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("tag not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+// CreateTag godoc
+// @Summary Create tag
+// @Description Create a new tag. Names are trimmed and lower-cased.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param request body tagctrl.CreateTag.Payload true "Tag payload"
+// @Success 201 {object} models.Tag
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 409 {object} problem.Problem
+// @Router /tags [post]
+func (ctl *Controller) CreateTag() gin.HandlerFunc {
+	type Payload struct {
+		Name string `json:"name" example:"backend"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		name, err := models.NormalizeTagName(p.Name)
+		if err != nil {
+			return nil, problem.Invalid("name", err.Error())
+		}
+		p.Name = name
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.TagsWrite) {
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		tag := models.Tag{Name: payload.Name}
+		if err := ctl.dbFor(c).Create(&tag).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, tag)
+	}
+}
+
+// UpdateTag godoc
+// @Summary Rename a tag
+// @Description Rename a tag. Todos keep the tag under its new name.
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param payload body tagctrl.UpdateTag.Payload true "Fields to update"
+// @Success 200 {object} models.Tag
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tags/{id} [patch]
+func (ctl *Controller) UpdateTag() gin.HandlerFunc {
+	type Payload struct {
+		Name string `json:"name" example:"frontend"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		name, err := models.NormalizeTagName(p.Name)
+		if err != nil {
+			return nil, problem.Invalid("name", err.Error())
+		}
+		p.Name = name
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.TagsWrite) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var tag models.Tag
+		if err := ctl.dbFor(c).First(&tag, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("tag not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		if err := ctl.dbFor(c).Model(&tag).Update("name", payload.Name).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, tag)
+	}
+}
+
+// DeleteTag godoc
+// @Summary Delete a tag
+// @Description Delete a tag and remove it from every todo
+// @Tags tags
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /tags/{id} [delete]
+func (ctl *Controller) DeleteTag() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.policy.Authorize(c, rbac.TagsWrite) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		res := ctl.dbFor(c).Delete(&models.Tag{}, id)
+		if res.Error != nil {
+			problem.Write(c, problem.FromDB(res.Error))
+			return
+		}
+		if res.RowsAffected == 0 {
+			problem.Write(c, problem.NotFound("tag not found"))
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
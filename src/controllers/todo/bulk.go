@@ -0,0 +1,712 @@
+package todoctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// MaxBulkItems caps the number of items of one bulk request.
+const MaxBulkItems = 1000
+
+var (
+	errNotApplied = errors.New("not applied, another item failed")
+	errBulkFailed = errors.New("bulk request failed")
+)
+
+// BulkResult is the outcome of the item at the same index of a bulk request.
+// Error is the problem of a failed item.
+type BulkResult struct {
+	Index  int              `json:"index" example:"0"`
+	Status int              `json:"status" example:"201"`
+	ID     uint             `json:"id,omitempty" example:"12"`
+	NextID *uint            `json:"next_occurrence_id,omitempty"`
+	Error  *problem.Problem `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Succeeded int          `json:"succeeded" example:"2"`
+	Failed    int          `json:"failed" example:"1"`
+	Results   []BulkResult `json:"results"`
+}
+
+// BulkUpdateItem is one update of a bulk update, the todo's ID along with
+// the fields to change. Version plays the role of If-Match.
+type BulkUpdateItem struct {
+	ID      uint  `json:"id" example:"1"`
+	Version *uint `json:"version" example:"3"`
+	UpdateTodoPayload
+}
+
+// bulkResults collects the outcome of every item of a bulk request. In
+// atomic mode a single failure rolls back every item.
+type bulkResults struct {
+	results    []BulkResult
+	bestEffort bool
+}
+
+func newBulkResults(n int, bestEffort bool) *bulkResults {
+	results := make([]BulkResult, n)
+	for i := range results {
+		results[i].Index = i
+	}
+	return &bulkResults{results: results, bestEffort: bestEffort}
+}
+
+func (b *bulkResults) fail(i int, err error) {
+	e, ok := err.(*todoError)
+	if !ok {
+		e = &todoError{body: problem.FromDB(err)}
+	}
+	p := e.body.Base()
+	b.results[i] = BulkResult{Index: i, Status: p.Status, Error: p}
+}
+
+func (b *bulkResults) failAll(err error) {
+	for i := range b.results {
+		if !b.failed(i) {
+			b.fail(i, err)
+		}
+	}
+}
+
+func (b *bulkResults) succeed(i, status int, id uint) {
+	b.results[i].Status = status
+	b.results[i].ID = id
+}
+
+func (b *bulkResults) failed(i int) bool {
+	return b.results[i].Error != nil
+}
+
+// aborted tells whether an atomic request has to stop.
+func (b *bulkResults) aborted() bool {
+	if b.bestEffort {
+		return false
+	}
+	for i := range b.results {
+		if b.failed(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// respond answers with the results. An aborted atomic request is answered
+// with the status of its first failure, and its other items are reported as
+// not applied.
+func (b *bulkResults) respond(c *gin.Context, okStatus int) {
+	status := okStatus
+	if b.aborted() {
+		status = 0
+		for i := range b.results {
+			if !b.failed(i) {
+				p := problem.New(http.StatusFailedDependency, problem.CodeNotApplied, errNotApplied.Error())
+				b.results[i] = BulkResult{Index: i, Status: p.Status, Error: p}
+			} else if status == 0 {
+				status = b.results[i].Status
+			}
+		}
+	}
+
+	res := BulkResponse{Results: b.results}
+	for i := range b.results {
+		if b.failed(i) {
+			res.Failed++
+		} else {
+			res.Succeeded++
+		}
+	}
+	c.JSON(status, res)
+}
+
+// parseBulkMode reads the "best_effort" query param.
+func parseBulkMode(c *gin.Context) (bool, error) {
+	value := c.Query("best_effort")
+	if value == "" {
+		return false, nil
+	}
+	bestEffort, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, errors.New("invalid \"best_effort\" query param")
+	}
+	return bestEffort, nil
+}
+
+func checkBulkSize(n int) error {
+	if n == 0 {
+		return errors.New("no items")
+	}
+	if n > MaxBulkItems {
+		return fmt.Errorf("at most %d items are allowed", MaxBulkItems)
+	}
+	return nil
+}
+
+// BulkCreateTodos godoc
+// @Summary Create todos in bulk
+// @Description Create many todos at once, inserted in batches. Projects are resolved as for a single create. By default
+// @Description nothing is created if any item fails; with best_effort=true the valid items are created anyway.
+// @Description Results are aligned with the items.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Param best_effort query bool false "Create the valid items even if others fail" default(false)
+// @Param request body todoctrl.BulkCreateTodos.Payload true "Todos to create"
+// @Success 201 {object} BulkResponse
+// @Success 200 {object} BulkResponse "best effort, some items failed"
+// @Failure 400 {object} BulkResponse
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 409 {object} BulkResponse
+// @Failure 500 {object} problem.Problem
+// @Router /todos/bulk [post]
+func (ctl *Controller) BulkCreateTodos() gin.HandlerFunc {
+	type Payload struct {
+		Items []CreateTodoPayload `json:"items"`
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosCreate) {
+			return
+		}
+
+		bestEffort, err := parseBulkMode(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		payload := &Payload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		if err := checkBulkSize(len(payload.Items)); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		b := newBulkResults(len(payload.Items), bestEffort)
+		for i := range payload.Items {
+			if err := ctl.validateCreate(&payload.Items[i]); err != nil {
+				b.fail(i, newTodoError(http.StatusBadRequest, err))
+			}
+		}
+		if b.aborted() {
+			b.respond(c, http.StatusCreated)
+			return
+		}
+
+		projectIDs, err := ctl.bulkProjects(ctl.dbFor(c), payload.Items, b)
+		if err == nil {
+			err = bulkTitleConflicts(ctl.dbFor(c), payload.Items, projectIDs, b)
+		}
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+		if b.aborted() {
+			b.respond(c, http.StatusCreated)
+			return
+		}
+
+		var indexes []int
+		var names []string
+		for i, p := range payload.Items {
+			if !b.failed(i) {
+				indexes = append(indexes, i)
+				names = append(names, p.Tags...)
+			}
+		}
+		names, _ = normalizeTagNames(names)
+
+		owner := requestUser(c)
+		items := make([]models.TodoItem, len(indexes))
+		build := func(tx *gorm.DB) error {
+			tags, err := resolveTags(tx, names)
+			if err != nil {
+				return err
+			}
+			byName := make(map[string]models.Tag, len(tags))
+			for _, t := range tags {
+				byName[t.Name] = t
+			}
+			for j, i := range indexes {
+				items[j] = newTodoItem(projectIDs[i], owner, &payload.Items[i])
+				for _, name := range payload.Items[i].Tags {
+					items[j].Tags = append(items[j].Tags, byName[name])
+				}
+			}
+			return nil
+		}
+
+		// The items are inserted in batches of the configured
+		// CreateBatchSize. In best effort mode a failed batch insert is
+		// retried item by item to find the culprits.
+		if bestEffort {
+			err = build(ctl.dbFor(c))
+			if err == nil && len(items) > 0 {
+				if err := ctl.dbFor(c).Create(&items).Error; err != nil {
+					for j := range items {
+						items[j].ID = 0
+						if err := ctl.dbFor(c).Create(&items[j]).Error; err != nil {
+							b.fail(indexes[j], err)
+						}
+					}
+				}
+			}
+		} else {
+			err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+				if err := build(tx); err != nil {
+					return err
+				}
+				return tx.Create(&items).Error
+			})
+			if err != nil {
+				b.failAll(err)
+				err = nil
+			}
+		}
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		created := 0
+		for j, i := range indexes {
+			if !b.failed(i) {
+				b.succeed(i, http.StatusCreated, items[j].ID)
+				created++
+			}
+		}
+		middleware.TasksCount.Add(float64(created))
+
+		status := http.StatusCreated
+		if created < len(payload.Items) {
+			status = http.StatusOK
+		}
+		b.respond(c, status)
+	}
+}
+
+// bulkProjects resolves the project of every new todo that is still valid, as
+// CreateTodo does: its own, its parent's or the default one. Items with an
+// unknown project or parent fail.
+func (ctl *Controller) bulkProjects(db *gorm.DB, items []CreateTodoPayload, b *bulkResults) ([]uint, error) {
+	var projectIDs, parentIDs []uint
+	for i, p := range items {
+		if b.failed(i) {
+			continue
+		}
+		if p.ProjectID != nil && !slices.Contains(projectIDs, *p.ProjectID) {
+			projectIDs = append(projectIDs, *p.ProjectID)
+		}
+		if p.ParentID != nil && !slices.Contains(parentIDs, *p.ParentID) {
+			parentIDs = append(parentIDs, *p.ParentID)
+		}
+	}
+
+	projects := map[uint]bool{}
+	if len(projectIDs) > 0 {
+		var found []uint
+		if err := db.Model(&models.Project{}).Where("id IN ?", projectIDs).Pluck("id", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range found {
+			projects[id] = true
+		}
+	}
+
+	parents := map[uint]uint{}
+	if len(parentIDs) > 0 {
+		var found []models.TodoItem
+		if err := db.Select("id", "project_id").Where("id IN ?", parentIDs).Find(&found).Error; err != nil {
+			return nil, err
+		}
+		for _, t := range found {
+			parents[t.ID] = t.ProjectID
+		}
+	}
+
+	resolved := make([]uint, len(items))
+	for i, p := range items {
+		if b.failed(i) {
+			continue
+		}
+
+		var projectID uint
+		if p.ProjectID != nil {
+			if !projects[*p.ProjectID] {
+				b.fail(i, newTodoError(http.StatusBadRequest, errProjectNotFound))
+				continue
+			}
+			projectID = *p.ProjectID
+		}
+		if p.ParentID != nil {
+			parentProject, ok := parents[*p.ParentID]
+			if !ok {
+				b.fail(i, newTodoError(http.StatusBadRequest, errParentNotFound))
+				continue
+			}
+			if projectID == 0 {
+				projectID = parentProject
+			}
+			if parentProject != projectID {
+				b.fail(i, newTodoError(http.StatusBadRequest, errParentInOtherProject))
+				continue
+			}
+		}
+		if projectID == 0 {
+			var err error
+			if projectID, err = ctl.defaultProject(db); err != nil {
+				return nil, err
+			}
+		}
+		resolved[i] = projectID
+	}
+	return resolved, nil
+}
+
+// bulkTitleConflicts fails the new todos whose title is already taken in their
+// project, by an existing todo or by an earlier item.
+func bulkTitleConflicts(db *gorm.DB, items []CreateTodoPayload, projectIDs []uint, b *bulkResults) error {
+	type key struct {
+		ProjectID uint
+		Title     string
+	}
+
+	var pairs [][]any
+	for i, p := range items {
+		if !b.failed(i) {
+			pairs = append(pairs, []any{projectIDs[i], p.Title})
+		}
+	}
+	if len(pairs) == 0 {
+		return nil
+	}
+
+	var existing []key
+	if err := db.Model(&models.TodoItem{}).
+		Select("project_id", "title").
+		Where("(project_id, title) IN ?", pairs).
+		Find(&existing).Error; err != nil {
+		return err
+	}
+
+	taken := make(map[key]bool, len(existing)+len(pairs))
+	for _, k := range existing {
+		taken[k] = true
+	}
+	for i, p := range items {
+		if b.failed(i) {
+			continue
+		}
+		k := key{ProjectID: projectIDs[i], Title: p.Title}
+		if taken[k] {
+			b.fail(i, newTodoError(http.StatusConflict, fmt.Errorf("title %q is already used in the project", p.Title)))
+			continue
+		}
+		taken[k] = true
+	}
+	return nil
+}
+
+// BulkUpdateTodos godoc
+// @Summary Update todos in bulk
+// @Description Apply many updates at once, in order, each with the rules of a single update. An item with a "version"
+// @Description is only applied if the todo is still at that version (412 otherwise); when REQUIRE_IF_MATCH is set the
+// @Description version is mandatory. By default nothing is changed if any item fails; with best_effort=true every item
+// @Description is applied on its own. Results are aligned with the items.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Param best_effort query bool false "Apply the valid items even if others fail" default(false)
+// @Param request body todoctrl.BulkUpdateTodos.Payload true "Updates, each with the ID of its todo"
+// @Success 200 {object} BulkResponse
+// @Failure 400 {object} BulkResponse
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} BulkResponse
+// @Failure 409 {object} BulkResponse
+// @Failure 412 {object} BulkResponse
+// @Failure 428 {object} BulkResponse
+// @Failure 500 {object} problem.Problem
+// @Router /todos/bulk [patch]
+func (ctl *Controller) BulkUpdateTodos() gin.HandlerFunc {
+	type Payload struct {
+		Items []BulkUpdateItem `json:"items"`
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		bestEffort, err := parseBulkMode(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		payload := &Payload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		if err := checkBulkSize(len(payload.Items)); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		b := newBulkResults(len(payload.Items), bestEffort)
+		seen := map[uint]bool{}
+		for i := range payload.Items {
+			p := &payload.Items[i]
+			switch {
+			case p.ID == 0:
+				b.fail(i, newTodoError(http.StatusBadRequest, errors.New("\"id\" is required")))
+			case seen[p.ID]:
+				b.fail(i, newTodoError(http.StatusBadRequest, errors.New("todo is updated twice")))
+			case p.Version == nil && ctl.requireIfMatch:
+				b.fail(i, newTodoError(http.StatusPreconditionRequired, errors.New("\"version\" is required")))
+			default:
+				seen[p.ID] = true
+				if err := validateUpdate(&p.UpdateTodoPayload); err != nil {
+					b.fail(i, newTodoError(http.StatusBadRequest, err))
+				}
+			}
+		}
+		if b.aborted() {
+			b.respond(c, http.StatusOK)
+			return
+		}
+
+		// update plans and applies one item. Items are loaded one at a time,
+		// as earlier ones may have changed them (e.g. by cascading). created
+		// counts the occurrences each item created.
+		created := make([]int, len(payload.Items))
+		update := func(tx *gorm.DB, i int) error {
+			p := &payload.Items[i]
+
+			var item models.TodoItem
+			if err := tx.First(&item, p.ID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return newTodoError(http.StatusNotFound, errors.New("todo not found"))
+				}
+				return newTodoError(http.StatusInternalServerError, err)
+			}
+			if p.Version != nil && *p.Version != item.Version {
+				return newTodoError(http.StatusPreconditionFailed, errPreconditionFailed)
+			}
+			u, err := ctl.planUpdate(tx, &item, &p.UpdateTodoPayload)
+			if err != nil {
+				return err
+			}
+			u.version = p.Version
+			next, n, err := ctl.applyUpdate(tx, &item, u)
+			if err != nil {
+				return err
+			}
+			created[i] = n
+
+			b.succeed(i, http.StatusOK, item.ID)
+			if next != nil {
+				b.results[i].NextID = &next.ID
+			}
+			return nil
+		}
+
+		if bestEffort {
+			for i := range payload.Items {
+				if b.failed(i) {
+					continue
+				}
+				if err := ctl.dbFor(c).Transaction(func(tx *gorm.DB) error { return update(tx, i) }); err != nil {
+					b.fail(i, err)
+				}
+			}
+		} else {
+			err := ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+				for i := range payload.Items {
+					if err := update(tx, i); err != nil {
+						b.fail(i, err)
+						return errBulkFailed
+					}
+				}
+				return nil
+			})
+			if err != nil && !errors.Is(err, errBulkFailed) {
+				b.failAll(err)
+			}
+		}
+
+		if !b.aborted() {
+			for i := range b.results {
+				if !b.failed(i) {
+					middleware.TasksCount.Add(float64(created[i]))
+				}
+			}
+		}
+		b.respond(c, http.StatusOK)
+	}
+}
+
+// BulkDeleteTodos godoc
+// @Summary Delete todos in bulk
+// @Description Delete many todos at once. By default nothing is deleted if any of them doesn't exist; with
+// @Description best_effort=true the existing ones are deleted anyway. Results are aligned with the IDs.
+// @Description With "versions", aligned with the IDs, a todo is only deleted if it is still at that version (412
+// @Description otherwise); when REQUIRE_IF_MATCH is set they are mandatory.
+// @Tags todos
+// @Accept json
+// @Produce json
+// @Param best_effort query bool false "Delete the existing todos even if others are missing" default(false)
+// @Param request body todoctrl.BulkDeleteTodos.Payload true "IDs of the todos to delete"
+// @Success 200 {object} BulkResponse
+// @Failure 400 {object} BulkResponse
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} BulkResponse
+// @Failure 412 {object} BulkResponse
+// @Failure 428 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/bulk [delete]
+func (ctl *Controller) BulkDeleteTodos() gin.HandlerFunc {
+	type Payload struct {
+		IDs      []uint `json:"ids" example:"1,2,3"`
+		Versions []uint `json:"versions" example:"1,4,2"`
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosDelete) {
+			return
+		}
+
+		bestEffort, err := parseBulkMode(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		payload := &Payload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		if err := checkBulkSize(len(payload.IDs)); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+		versioned := payload.Versions != nil
+		if versioned && len(payload.Versions) != len(payload.IDs) {
+			problem.Write(c, problem.BadRequest("\"versions\" must have one version per id"))
+			return
+		}
+		if !versioned && ctl.requireIfMatch {
+			problem.Write(c, problem.New(http.StatusPreconditionRequired, problem.CodePreconditionRequired, "\"versions\" is required"))
+			return
+		}
+
+		b := newBulkResults(len(payload.IDs), bestEffort)
+		seen := map[uint]bool{}
+		var ids []uint
+		for i, id := range payload.IDs {
+			switch {
+			case id == 0:
+				b.fail(i, newTodoError(http.StatusBadRequest, errors.New("invalid id")))
+			case seen[id]:
+				b.fail(i, newTodoError(http.StatusBadRequest, errors.New("todo is deleted twice")))
+			default:
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+
+		var found []models.TodoItem
+		if len(ids) > 0 {
+			if err := ctl.dbFor(c).Select("id", "version").Where("id IN ?", ids).Find(&found).Error; err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
+		versions := make(map[uint]uint, len(found))
+		for _, t := range found {
+			versions[t.ID] = t.Version
+		}
+		var pairs [][]any
+		for i, id := range payload.IDs {
+			if b.failed(i) {
+				continue
+			}
+			version, ok := versions[id]
+			switch {
+			case !ok:
+				b.fail(i, newTodoError(http.StatusNotFound, errors.New("todo not found")))
+			case versioned && payload.Versions[i] != version:
+				b.fail(i, newTodoError(http.StatusPreconditionFailed, errPreconditionFailed))
+			default:
+				pairs = append(pairs, []any{id, version})
+			}
+		}
+		if b.aborted() {
+			b.respond(c, http.StatusOK)
+			return
+		}
+
+		// With versions, a todo changed since it was read above is not
+		// deleted. In atomic mode that rolls back the whole request.
+		removed := 0
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if len(pairs) == 0 {
+				return nil
+			}
+			query := tx.Where("id IN ?", idsOf(pairs))
+			if versioned {
+				query = tx.Where("(id, version) IN ?", pairs)
+			}
+			var deleted []models.TodoItem
+			if err := query.Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+				Delete(&deleted).Error; err != nil {
+				return err
+			}
+			gone := make(map[uint]bool, len(deleted))
+			for _, t := range deleted {
+				gone[t.ID] = true
+			}
+			for i, id := range payload.IDs {
+				if !b.failed(i) && !gone[id] {
+					b.fail(i, newTodoError(http.StatusPreconditionFailed, errPreconditionFailed))
+				}
+			}
+			if b.aborted() {
+				return errBulkFailed
+			}
+			removed = len(deleted)
+			return nil
+		})
+		if err != nil && !errors.Is(err, errBulkFailed) {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+		middleware.TasksCount.Sub(float64(removed))
+
+		for i, id := range payload.IDs {
+			if !b.failed(i) {
+				b.succeed(i, http.StatusNoContent, id)
+			}
+		}
+		b.respond(c, http.StatusOK)
+	}
+}
+
+func idsOf(pairs [][]any) []any {
+	ids := make([]any, len(pairs))
+	for i, p := range pairs {
+		ids[i] = p[0]
+	}
+	return ids
+}
@@ -0,0 +1,148 @@
+package todoctrl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/cursor"
+	"github.com/alirezamastery/graph_task/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errCursorSort = errors.New("cursor was issued for another sort")
+
+// nullableSortFields are the sortable fields that can be NULL. Postgres sorts
+// NULLs after every value ascending and before every value descending.
+var nullableSortFields = map[string]bool{
+	"due_at": true,
+}
+
+// sortValues returns the values of the sort keys for a todo, in the form they
+// are stored in cursors.
+func sortValues(item *models.TodoItem, keys []sortKey) []any {
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		switch k.field {
+		case "id":
+			values[i] = item.ID
+		case "title":
+			values[i] = item.Title
+		case "status":
+			values[i] = item.Status
+		case "priority":
+			values[i] = item.Priority
+		case "due_at":
+			if item.DueAt != nil {
+				values[i] = item.DueAt.Format(time.RFC3339Nano)
+			}
+		case "created_at":
+			values[i] = item.CreatedAt.Format(time.RFC3339Nano)
+		case "updated_at":
+			values[i] = item.UpdatedAt.Format(time.RFC3339Nano)
+		}
+	}
+	return values
+}
+
+// cursorValues converts the values of a decoded cursor back into query
+// arguments, checking that they fit the sort keys.
+func cursorValues(keys []sortKey, raw []any) ([]any, error) {
+	if len(raw) != len(keys) {
+		return nil, cursor.ErrInvalid
+	}
+
+	values := make([]any, len(keys))
+	for i, k := range keys {
+		if raw[i] == nil {
+			if !nullableSortFields[k.field] {
+				return nil, cursor.ErrInvalid
+			}
+			continue
+		}
+
+		var err error
+		switch k.field {
+		case "id", "priority":
+			n, ok := raw[i].(json.Number)
+			if !ok {
+				return nil, cursor.ErrInvalid
+			}
+			values[i], err = strconv.ParseInt(n.String(), 10, 64)
+		case "title", "status":
+			s, ok := raw[i].(string)
+			if !ok {
+				return nil, cursor.ErrInvalid
+			}
+			values[i] = s
+		default:
+			s, ok := raw[i].(string)
+			if !ok {
+				return nil, cursor.ErrInvalid
+			}
+			values[i], err = time.Parse(time.RFC3339Nano, s)
+		}
+		if err != nil {
+			return nil, cursor.ErrInvalid
+		}
+	}
+	return values, nil
+}
+
+// reverseKeys flips every sort direction, to walk the list backward.
+func reverseKeys(keys []sortKey) []sortKey {
+	reversed := make([]sortKey, len(keys))
+	for i, k := range keys {
+		reversed[i] = sortKey{field: k.field, desc: !k.desc}
+	}
+	return reversed
+}
+
+// keysetCondition matches the rows that come after the row with the given
+// sort key values, in the order of keys:
+//
+//	(a > ?) OR (a = ? AND b > ?) OR ...
+func keysetCondition(keys []sortKey, values []any) (string, []any) {
+	var branches []string
+	var args []any
+
+	var prefix []string
+	var prefixArgs []any
+	for i, k := range keys {
+		column := k.column()
+		v := values[i]
+
+		var after string
+		var afterArgs []any
+		switch {
+		case v == nil && !k.desc:
+			// Nothing sorts after NULL ascending.
+		case v == nil:
+			after = column + " IS NOT NULL"
+		case k.desc:
+			after, afterArgs = column+" < ?", []any{v}
+		case nullableSortFields[k.field]:
+			after, afterArgs = fmt.Sprintf("(%s > ? OR %s IS NULL)", column, column), []any{v}
+		default:
+			after, afterArgs = column+" > ?", []any{v}
+		}
+
+		if after != "" {
+			branches = append(branches, "("+strings.Join(append(append([]string{}, prefix...), after), " AND ")+")")
+			args = append(append(args, prefixArgs...), afterArgs...)
+		}
+
+		if v == nil {
+			prefix = append(prefix, column+" IS NULL")
+		} else {
+			prefix = append(prefix, column+" = ?")
+			prefixArgs = append(prefixArgs, v)
+		}
+	}
+
+	if len(branches) == 0 {
+		return "1 = 0", nil
+	}
+	return "(" + strings.Join(branches, " OR ") + ")", args
+}
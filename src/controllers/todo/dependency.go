@@ -0,0 +1,316 @@
+package todoctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/graph"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	DependencyBlockedBy = "blocked_by"
+	DependencyBlocks    = "blocks"
+)
+
+var (
+	errTodoNotFound     = errors.New("todo not found")
+	errDependencyExists = errors.New("dependency already exists")
+)
+
+type cycleError struct {
+	cycle []uint
+}
+
+func (e *cycleError) Error() string {
+	parts := make([]string, len(e.cycle))
+	for i, id := range e.cycle {
+		parts[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return "dependency would create a cycle: " + strings.Join(parts, " -> ")
+}
+
+// CycleErrorResponse is the problem of a dependency that would close a cycle.
+type CycleErrorResponse struct {
+	problem.Problem
+	Cycle []uint `json:"cycle" example:"1,2,1"`
+}
+
+type DependencyItem struct {
+	ID     uint   `json:"id" example:"7"`
+	TodoID uint   `json:"todo_id" example:"2"`
+	Title  string `json:"title" example:"write tests"`
+	IsDone bool   `json:"is_done" example:"false"`
+}
+
+type DependencyListResponse struct {
+	BlockedBy []DependencyItem `json:"blocked_by"`
+	Blocks    []DependencyItem `json:"blocks"`
+}
+
+// AddTodoDependency godoc
+// @Summary Add a dependency
+// @Description Mark the todo as blocked by (or blocking) another todo. Edges that would create a cycle are rejected.
+// @Tags dependencies
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body todoctrl.AddTodoDependency.Payload true "Dependency payload"
+// @Success 201 {object} models.TodoDependency
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} CycleErrorResponse
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/dependencies [post]
+func (ctl *Controller) AddTodoDependency() gin.HandlerFunc {
+	type Payload struct {
+		TodoID uint   `json:"todo_id" example:"2"`
+		Type   string `json:"type" enums:"blocked_by,blocks" example:"blocked_by"`
+	}
+
+	validate := func(c *gin.Context, id uint) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		if p.TodoID == 0 {
+			return nil, problem.Invalid("todo_id", "\"todo_id\" is required")
+		}
+		if p.TodoID == id {
+			return nil, errors.New("a todo cannot depend on itself")
+		}
+
+		p.Type = strings.TrimSpace(p.Type)
+		if p.Type == "" {
+			p.Type = DependencyBlockedBy
+		}
+		if p.Type != DependencyBlockedBy && p.Type != DependencyBlocks {
+			return nil, problem.Invalid("type", fmt.Sprintf("\"type\" must be %q or %q", DependencyBlockedBy, DependencyBlocks))
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload, err := validate(c, uint(id))
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		dep := models.TodoDependency{BlockerID: payload.TodoID, BlockedID: uint(id)}
+		if payload.Type == DependencyBlocks {
+			dep.BlockerID, dep.BlockedID = uint(id), payload.TodoID
+		}
+
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			if err := lockDependencyGraph(tx); err != nil {
+				return err
+			}
+
+			var found int64
+			if err := tx.Model(&models.TodoItem{}).
+				Where("id IN ?", []uint{dep.BlockerID, dep.BlockedID}).
+				Count(&found).Error; err != nil {
+				return err
+			}
+			if found != 2 {
+				return errTodoNotFound
+			}
+
+			g, err := loadDependencyGraph(tx)
+			if err != nil {
+				return err
+			}
+			for _, next := range g.Successors(dep.BlockerID) {
+				if next == dep.BlockedID {
+					return errDependencyExists
+				}
+			}
+			if cycle := g.CycleWith(dep.BlockerID, dep.BlockedID); cycle != nil {
+				return &cycleError{cycle: cycle}
+			}
+
+			return tx.Create(&dep).Error
+		})
+
+		var cycleErr *cycleError
+		switch {
+		case err == nil:
+			c.JSON(http.StatusCreated, dep)
+		case errors.Is(err, errTodoNotFound):
+			problem.Write(c, problem.NotFound(err.Error()))
+		case errors.Is(err, errDependencyExists):
+			problem.Write(c, problem.New(http.StatusConflict, problem.CodeConflict, err.Error()))
+		case errors.As(err, &cycleErr):
+			problem.Write(c, &CycleErrorResponse{
+				Problem: *problem.New(http.StatusConflict, problem.CodeDependencyCycle, cycleErr.Error()),
+				Cycle:   cycleErr.cycle,
+			})
+		default:
+			problem.Write(c, problem.FromDB(err))
+		}
+	}
+}
+
+// ListTodoDependencies godoc
+// @Summary List dependencies
+// @Description List the todos blocking this todo and the todos it blocks
+// @Tags dependencies
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} DependencyListResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/dependencies [get]
+func (ctl *Controller) ListTodoDependencies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var item models.TodoItem
+		if err := ctl.dbFor(c).Select("id").First(&item, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		res := DependencyListResponse{
+			BlockedBy: []DependencyItem{},
+			Blocks:    []DependencyItem{},
+		}
+
+		if err := dependencyItems(ctl.dbFor(c), "blocker_id", "blocked_id", item.ID).
+			Scan(&res.BlockedBy).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+		if err := dependencyItems(ctl.dbFor(c), "blocked_id", "blocker_id", item.ID).
+			Scan(&res.Blocks).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// RemoveTodoDependency godoc
+// @Summary Remove a dependency
+// @Description Remove a dependency edge of the todo
+// @Tags dependencies
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param dep_id path int true "Dependency ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/dependencies/{dep_id} [delete]
+func (ctl *Controller) RemoveTodoDependency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+		depID, err := strconv.ParseUint(c.Param("dep_id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid dependency id"))
+			return
+		}
+
+		res := ctl.dbFor(c).
+			Where("id = ? AND (blocker_id = ? OR blocked_id = ?)", depID, id, id).
+			Delete(&models.TodoDependency{})
+		if res.Error != nil {
+			problem.Write(c, problem.FromDB(res.Error))
+			return
+		}
+		if res.RowsAffected == 0 {
+			problem.Write(c, problem.NotFound("dependency not found"))
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// dependencyItems selects the todos on the "other" side of the edges whose
+// "own" column equals id.
+func dependencyItems(db *gorm.DB, other, own string, id uint) *gorm.DB {
+	return db.Model(&models.TodoDependency{}).
+		Select("todo_dependencies.id, todo_items.id AS todo_id, todo_items.title, todo_items.is_done").
+		Joins(fmt.Sprintf("JOIN todo_items ON todo_items.id = todo_dependencies.%s", other)).
+		Where(fmt.Sprintf("todo_dependencies.%s = ?", own), id).
+		Order("todo_dependencies.id")
+}
+
+// openBlockers returns the IDs of unfinished todos that block the given todo.
+func openBlockers(db *gorm.DB, id uint) ([]uint, error) {
+	blockers := []uint{}
+	err := db.Model(&models.TodoDependency{}).
+		Joins("JOIN todo_items ON todo_items.id = todo_dependencies.blocker_id").
+		Where("todo_dependencies.blocked_id = ? AND todo_items.is_done = ?", id, false).
+		Order("todo_dependencies.blocker_id").
+		Pluck("todo_dependencies.blocker_id", &blockers).Error
+	return blockers, err
+}
+
+// lockDependencyGraph serializes the edge inserts into the dependency graph of
+// the workspace of tx until the end of the transaction, so that two concurrent
+// requests can't close a cycle that neither of them sees on its own. The graphs
+// of other workspaces aren't held up.
+func lockDependencyGraph(tx *gorm.DB) error {
+	workspaceID, _ := tenant.ID(tx)
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext('dependency_graph'), ?::int)", workspaceID).Error
+}
+
+func loadDependencyGraph(db *gorm.DB) (*graph.Graph, error) {
+	var edges []models.TodoDependency
+	if err := db.Select("blocker_id", "blocked_id").Find(&edges).Error; err != nil {
+		return nil, err
+	}
+
+	g := graph.New()
+	for _, e := range edges {
+		g.AddEdge(e.BlockerID, e.BlockedID)
+	}
+	return g, nil
+}
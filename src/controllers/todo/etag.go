@@ -0,0 +1,95 @@
+package todoctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RequireIfMatchEnv names the environment variable that, when true, makes the
+// If-Match header mandatory for changing or deleting a todo.
+const RequireIfMatchEnv = "REQUIRE_IF_MATCH"
+
+var (
+	errPreconditionFailed   = errors.New("todo was changed in the meantime, reload it and retry")
+	errPreconditionRequired = errors.New("the If-Match header is required, send the ETag of the todo")
+)
+
+// bumpVersion is the update of the version column that goes with every change
+// of a todo.
+var bumpVersion = gorm.Expr("version + 1")
+
+// etag is the entity tag of a todo at a version.
+func etag(version uint) string {
+	return `"` + strconv.FormatUint(uint64(version), 10) + `"`
+}
+
+func setETag(c *gin.Context, item *models.TodoItem) {
+	c.Header("ETag", etag(item.Version))
+}
+
+// ifMatch is a parsed If-Match header.
+type ifMatch struct {
+	any  bool
+	tags []string
+}
+
+// matches compares the header with the version of a todo. Weak tags never
+// match, as If-Match uses the strong comparison.
+func (m *ifMatch) matches(version uint) bool {
+	if m.any {
+		return true
+	}
+	for _, tag := range m.tags {
+		if tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// requireIfMatchFromEnv reads REQUIRE_IF_MATCH.
+func requireIfMatchFromEnv() bool {
+	required, _ := strconv.ParseBool(os.Getenv(RequireIfMatchEnv))
+	return required
+}
+
+// RequireIfMatch makes the If-Match header mandatory for changing or deleting
+// a todo; requests without it are refused with 428.
+func (ctl *Controller) RequireIfMatch(required bool) {
+	ctl.requireIfMatch = required
+}
+
+// precondition reads the If-Match header of a request. It is nil without one.
+// When the header is required but missing, it answers 428 and returns false.
+func (ctl *Controller) precondition(c *gin.Context) (*ifMatch, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		if ctl.requireIfMatch {
+			problem.Write(c, problem.New(http.StatusPreconditionRequired, problem.CodePreconditionRequired, errPreconditionRequired.Error()))
+			return nil, false
+		}
+		return nil, true
+	}
+
+	if header == "*" {
+		return &ifMatch{any: true}, true
+	}
+	m := &ifMatch{}
+	for _, tag := range strings.Split(header, ",") {
+		m.tags = append(m.tags, strings.TrimSpace(tag))
+	}
+	return m, true
+}
+
+// preconditionFailed answers 412 with the current ETag of the todo.
+func preconditionFailed(c *gin.Context, item *models.TodoItem) {
+	setETag(c, item)
+	problem.Write(c, problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, errPreconditionFailed.Error()))
+}
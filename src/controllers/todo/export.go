@@ -0,0 +1,105 @@
+package todoctrl
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/alirezamastery/graph_task/graph"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+)
+
+var exportMediaTypes = map[string]string{
+	graph.FormatDOT:     "text/vnd.graphviz",
+	graph.FormatMermaid: "text/vnd.mermaid",
+	graph.FormatGraphML: "application/graphml+xml",
+}
+
+// ExportTodoGraph godoc
+// @Summary Export the task graph
+// @Description Serialize all todos and their relationships (dependencies and subtasks) as Graphviz DOT, Mermaid
+// @Description flowchart text or GraphML.
+// @Description The format comes from the "format" query param, or from the Accept header when it is missing.
+// @Description Finished todos are styled differently.
+// @Tags dependencies
+// @Produce text/vnd.graphviz
+// @Produce text/vnd.mermaid
+// @Produce application/graphml+xml
+// @Param format query string false "Output format" Enums(dot, mermaid, graphml)
+// @Success 200 {string} string "Serialized graph"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 406 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/export [get]
+func (ctl *Controller) ExportTodoGraph() gin.HandlerFunc {
+	formatByMediaType := map[string]string{}
+	offered := []string{}
+	for _, format := range []string{graph.FormatDOT, graph.FormatMermaid, graph.FormatGraphML} {
+		formatByMediaType[exportMediaTypes[format]] = format
+		offered = append(offered, exportMediaTypes[format])
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		format := c.Query("format")
+		if format != "" {
+			if _, ok := exportMediaTypes[format]; !ok {
+				problem.Write(c, problem.BadRequest(fmt.Sprintf("unknown \"format\" %q", format)))
+				return
+			}
+		} else {
+			format = formatByMediaType[c.NegotiateFormat(offered...)]
+			if format == "" {
+				problem.Write(c, problem.New(http.StatusNotAcceptable, problem.CodeInvalidRequest, "supported media types are text/vnd.graphviz, text/vnd.mermaid and application/graphml+xml"))
+				return
+			}
+		}
+
+		doc, err := graphDocument(ctl.dbFor(c))
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := graph.Write(&buf, format, doc); err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.Data(http.StatusOK, exportMediaTypes[format]+"; charset=utf-8", buf.Bytes())
+	}
+}
+
+func graphDocument(db *gorm.DB) (graph.Document, error) {
+	var items []models.TodoItem
+	if err := db.Select("id", "title", "is_done", "parent_id").Order("id").Find(&items).Error; err != nil {
+		return graph.Document{}, err
+	}
+
+	var deps []models.TodoDependency
+	if err := db.Select("blocker_id", "blocked_id").Order("id").Find(&deps).Error; err != nil {
+		return graph.Document{}, err
+	}
+
+	doc := graph.Document{}
+	for _, item := range items {
+		doc.Nodes = append(doc.Nodes, graph.Node{ID: item.ID, Title: item.Title, Done: item.IsDone})
+	}
+	for _, item := range items {
+		if item.ParentID != nil {
+			doc.Edges = append(doc.Edges, graph.Edge{From: *item.ParentID, To: item.ID, Kind: graph.EdgeSubtask})
+		}
+	}
+	for _, d := range deps {
+		doc.Edges = append(doc.Edges, graph.Edge{From: d.BlockerID, To: d.BlockedID, Kind: graph.EdgeBlocks})
+	}
+	return doc, nil
+}
@@ -1,11 +1,50 @@
 package todoctrl
 
-import "gorm.io/gorm"
+import (
+	"github.com/alirezamastery/graph_task/cursor"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/search"
+	"github.com/alirezamastery/graph_task/workflow"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"sync"
+)
 
 type Controller struct {
-	db *gorm.DB
+	db       *gorm.DB
+	workflow *workflow.Workflow
+	searcher search.Searcher
+	cursors  *cursor.Codec
+	policy   *rbac.Policy
+
+	requireIfMatch bool
+
+	mu              sync.Mutex
+	defaultProjects map[uint]uint
 }
 
 func NewTodoController(db *gorm.DB) *Controller {
-	return &Controller{db: db}
+	return &Controller{db: db, workflow: workflow.Default(), searcher: search.For(db), cursors: cursor.FromEnv(), policy: rbac.NewPolicy(), requireIfMatch: requireIfMatchFromEnv()}
+}
+
+// UseWorkflow replaces the default workflow todo statuses move through.
+func (ctl *Controller) UseWorkflow(wf *workflow.Workflow) {
+	ctl.workflow = wf
+}
+
+// UsePolicy replaces the policy every handler checks the permission of its
+// operation with. Without one, everything is denied.
+func (ctl *Controller) UsePolicy(policy *rbac.Policy) {
+	ctl.policy = policy
+}
+
+// dbFor returns the database scoped to the workspace of the request.
+func (ctl *Controller) dbFor(c *gin.Context) *gorm.DB {
+	return ctl.db.WithContext(c.Request.Context())
+}
+
+// authorize checks the permission with the policy, answering 403 when the
+// user of the request lacks it or there is no policy.
+func (ctl *Controller) authorize(c *gin.Context, permission string) bool {
+	return ctl.policy.Authorize(c, permission)
 }
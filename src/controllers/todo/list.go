@@ -0,0 +1,110 @@
+package todoctrl
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"strings"
+	"time"
+)
+
+// DefaultSort is the order of the todo list when no "sort" param is given.
+const DefaultSort = "-created_at"
+
+// sortableFields maps the fields the list can be sorted by to their columns.
+var sortableFields = map[string]string{
+	"id":         "id",
+	"title":      "title",
+	"status":     "status",
+	"priority":   "priority",
+	"due_at":     "due_at",
+	"created_at": "created_at",
+	"updated_at": "updated_at",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// sortKey is one field of the list order.
+type sortKey struct {
+	field string
+	desc  bool
+}
+
+func (k sortKey) column() string {
+	return sortableFields[k.field]
+}
+
+// parseSort parses a sort param like "-created_at,title". A leading "-" sorts
+// descending. The id is always appended as a tie breaker so that pages don't
+// overlap or skip rows, and so that every row has a unique position for
+// cursors.
+func parseSort(value string) ([]sortKey, error) {
+	if value == "" {
+		value = DefaultSort
+	}
+
+	var keys []sortKey
+	seen := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		desc := strings.HasPrefix(field, "-")
+		field = strings.TrimPrefix(field, "-")
+
+		if _, ok := sortableFields[field]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q", field)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%q is used twice", field)
+		}
+		seen[field] = true
+		keys = append(keys, sortKey{field: field, desc: desc})
+	}
+
+	if !seen["id"] {
+		keys = append(keys, sortKey{field: "id"})
+	}
+	return keys, nil
+}
+
+// orderClause turns sort keys into an ORDER BY clause.
+func orderClause(keys []sortKey) string {
+	columns := make([]string, len(keys))
+	for i, k := range keys {
+		direction := "ASC"
+		if k.desc {
+			direction = "DESC"
+		}
+		columns[i] = k.column() + " " + direction
+	}
+	return strings.Join(columns, ", ")
+}
+
+// sortParam formats sort keys back into a normalized sort param.
+func sortParam(keys []sortKey) string {
+	fields := make([]string, len(keys))
+	for i, k := range keys {
+		fields[i] = k.field
+		if k.desc {
+			fields[i] = "-" + k.field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// parseTimeParam reads an optional RFC 3339 query param.
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %q query param, expected RFC 3339", name)
+	}
+	return &t, nil
+}
+
+// containsPattern builds an ILIKE pattern matching values that contain s.
+func containsPattern(s string) string {
+	return "%" + likeEscaper.Replace(s) + "%"
+}
@@ -0,0 +1,142 @@
+package todoctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+// DefaultEstimateHours is the weight of a todo without an estimate when
+// computing the critical path.
+const DefaultEstimateHours = 1.0
+
+type CriticalPath struct {
+	IDs                []uint  `json:"ids" example:"3,5,8"`
+	TotalEstimateHours float64 `json:"total_estimate_hours" example:"6.5"`
+}
+
+type TodoOrderResponse struct {
+	Count        int64             `json:"count" example:"42"`
+	Page         int               `json:"page" example:"1"`
+	PageSize     int               `json:"page_size" example:"20"`
+	PageCount    int               `json:"page_count" example:"3"`
+	Items        []models.TodoItem `json:"items"`
+	CriticalPath CriticalPath      `json:"critical_path"`
+}
+
+// GetTodoExecutionOrder godoc
+// @Summary Execution order
+// @Description Open todos in a valid execution order (every todo comes after its open blockers) plus the critical path,
+// @Description the heaviest chain of open work. Todos without an estimate count as 1 hour. With "root", only the root
+// @Description and its open prerequisites are included.
+// @Tags dependencies
+// @Produce json
+// @Param page query int false "page number" default(1)
+// @Param page_size query int false "page size" default(20)
+// @Param root query int false "Only order this todo and its prerequisites"
+// @Success 200 {object} TodoOrderResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/order [get]
+func (ctl *Controller) GetTodoExecutionOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		page, pageSize, err := parsePagination(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var root uint
+		if rootStr := c.Query("root"); rootStr != "" {
+			r, err := strconv.ParseUint(rootStr, 10, 64)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"root\" query param"))
+				return
+			}
+			root = uint(r)
+
+			var item models.TodoItem
+			if err := ctl.dbFor(c).Select("id").First(&item, root).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					problem.Write(c, problem.NotFound("root todo not found"))
+					return
+				}
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
+
+		var open []models.TodoItem
+		if err := ctl.dbFor(c).Where("is_done = ?", false).Find(&open).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		deps, err := loadDependencyGraph(ctl.dbFor(c))
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		// Finished todos no longer block anything, so only edges between
+		// open todos take part in the ordering.
+		byID := make(map[uint]models.TodoItem, len(open))
+		ids := make([]uint, 0, len(open))
+		for _, item := range open {
+			byID[item.ID] = item
+			ids = append(ids, item.ID)
+			deps.AddNode(item.ID)
+		}
+		g := deps.Subgraph(ids)
+		if root != 0 {
+			g = g.Subgraph(g.Ancestors(root))
+		}
+
+		order, err := g.TopologicalSort()
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		path, total, err := g.CriticalPath(func(id uint) float64 {
+			if est := byID[id].EstimateHours; est != nil {
+				return *est
+			}
+			return DefaultEstimateHours
+		})
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		count := int64(len(order))
+		offset := (page - 1) * pageSize
+		items := []models.TodoItem{}
+		for i := offset; i < len(order) && i < offset+pageSize; i++ {
+			items = append(items, byID[order[i]])
+		}
+
+		c.JSON(http.StatusOK, TodoOrderResponse{
+			Count:     count,
+			Page:      page,
+			PageSize:  pageSize,
+			PageCount: int((count + int64(pageSize) - 1) / int64(pageSize)),
+			Items:     items,
+			CriticalPath: CriticalPath{
+				IDs:                path,
+				TotalEstimateHours: total,
+			},
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package todoctrl
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/jsonpatch"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+// PatchErrorResponse is the problem of a patch that couldn't be applied, or
+// whose result is not a valid todo, with one entry per failing operation.
+type PatchErrorResponse struct {
+	problem.Problem
+	Operations []PatchOperationError `json:"operations"`
+}
+
+// PatchOperationError is the failure of one operation. Index is the position
+// of the operation in a JSON Patch; merge patches only have a path.
+type PatchOperationError struct {
+	Index *int   `json:"index,omitempty" example:"0"`
+	Op    string `json:"op,omitempty" example:"replace"`
+	Path  string `json:"path" example:"/title"`
+	Error string `json:"error" example:"\"title\" cannot be empty"`
+}
+
+// todoPatch is a patch of a todo, in one of the supported formats.
+type todoPatch interface {
+	// apply patches the document of a todo. Failures are *todoError.
+	apply(doc map[string]any) (map[string]any, error)
+	// locate returns the operation that last changed a field.
+	locate(field string) PatchOperationError
+}
+
+// isPatch tells whether a request carries a patch rather than plain JSON.
+func isPatch(c *gin.Context) bool {
+	ct := c.ContentType()
+	return ct == mergePatchType || ct == jsonPatchType
+}
+
+// operationError is the problem of a single failing operation of a JSON Patch.
+func operationError(p *problem.Problem, opErr *jsonpatch.OperationError) *PatchErrorResponse {
+	return &PatchErrorResponse{
+		Problem: *p,
+		Operations: []PatchOperationError{{
+			Index: &opErr.Index,
+			Op:    opErr.Op.Op,
+			Path:  opErr.Op.Path,
+			Error: opErr.Err.Error(),
+		}},
+	}
+}
+
+// decodeTodoPatch reads the patch in the body of a request.
+func decodeTodoPatch(c *gin.Context) (todoPatch, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ContentType() == mergePatchType {
+		doc, err := jsonpatch.Decode(body)
+		if err != nil {
+			return nil, err
+		}
+		patch, ok := doc.(map[string]any)
+		if !ok {
+			return nil, errors.New("a merge patch of a todo must be a JSON object")
+		}
+		return mergePatch(patch), nil
+	}
+
+	ops, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, err
+	}
+	return jsonPatch(ops), nil
+}
+
+type mergePatch map[string]any
+
+func (p mergePatch) apply(doc map[string]any) (map[string]any, error) {
+	return jsonpatch.MergePatch(doc, map[string]any(p)).(map[string]any), nil
+}
+
+func (p mergePatch) locate(field string) PatchOperationError {
+	return PatchOperationError{Path: "/" + field}
+}
+
+type jsonPatch jsonpatch.Patch
+
+func (p jsonPatch) apply(doc map[string]any) (map[string]any, error) {
+	patched, err := jsonpatch.Patch(p).Apply(doc)
+	var opErr *jsonpatch.OperationError
+	if errors.As(err, &opErr) {
+		p := problem.New(http.StatusUnprocessableEntity, problem.CodeInvalidPatch, opErr.Error())
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			p = problem.New(http.StatusConflict, problem.CodePatchTestFailed, opErr.Error())
+		}
+		return nil, &todoError{body: operationError(p, opErr)}
+	}
+	if err != nil {
+		return nil, newTodoError(http.StatusInternalServerError, err)
+	}
+
+	result, ok := patched.(map[string]any)
+	if !ok {
+		return nil, newTodoError(http.StatusUnprocessableEntity, errors.New("the patched todo must be a JSON object"))
+	}
+	return result, nil
+}
+
+func (p jsonPatch) locate(field string) PatchOperationError {
+	for i := len(p) - 1; i >= 0; i-- {
+		op := p[i]
+		if touches(op.Path, field) || (op.Op == "move" && touches(op.From, field)) {
+			return PatchOperationError{Index: &i, Op: op.Op, Path: op.Path}
+		}
+	}
+	return PatchOperationError{Path: "/" + field}
+}
+
+// touches tells whether a pointer addresses a field of the todo, or the
+// whole todo.
+func touches(pointer, field string) bool {
+	tokens := jsonpatch.Tokens(pointer)
+	return len(tokens) == 0 || tokens[0] == field
+}
+
+// todoDocument is the todo as patches see it. The fields that can't be
+// patched are only there to be tested.
+func todoDocument(item *models.TodoItem) (map[string]any, error) {
+	tags := make([]string, 0, len(item.Tags))
+	for _, tag := range item.Tags {
+		tags = append(tags, tag.Name)
+	}
+	sort.Strings(tags)
+
+	data, err := json.Marshal(map[string]any{
+		"id":             item.ID,
+		"version":        item.Version,
+		"parent_id":      item.ParentID,
+		"project_id":     item.ProjectID,
+		"title":          item.Title,
+		"description":    item.Description,
+		"status":         item.Status,
+		"is_done":        item.IsDone,
+		"estimate_hours": item.EstimateHours,
+		"priority":       item.Priority,
+		"due_at":         item.DueAt,
+		"recurrence":     item.Recurrence,
+		"tags":           tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonpatch.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.(map[string]any), nil
+}
+
+// readOnlyFields are in the document of a todo but can't be patched.
+var readOnlyFields = []string{"id", "version", "parent_id"}
+
+// patchFields set the field of an update from its patched value, nil when
+// it was removed or set to null.
+var patchFields = map[string]func(p *UpdateTodoPayload, value any) error{
+	"project_id": func(p *UpdateTodoPayload, value any) (err error) {
+		p.ProjectID, err = requiredField[uint]("project_id", "a project ID", value)
+		return err
+	},
+	"title": func(p *UpdateTodoPayload, value any) (err error) {
+		p.Title, err = requiredField[string]("title", "a string", value)
+		return err
+	},
+	"description": func(p *UpdateTodoPayload, value any) (err error) {
+		p.Description, err = optionalField[string]("description", "a string", value)
+		if p.Description == nil {
+			p.Description = new(string)
+		}
+		return err
+	},
+	"status": func(p *UpdateTodoPayload, value any) (err error) {
+		p.Status, err = requiredField[string]("status", "a string", value)
+		return err
+	},
+	"is_done": func(p *UpdateTodoPayload, value any) (err error) {
+		p.IsDone, err = requiredField[bool]("is_done", "a boolean", value)
+		return err
+	},
+	"estimate_hours": func(p *UpdateTodoPayload, value any) (err error) {
+		p.EstimateHours, err = optionalField[float64]("estimate_hours", "a number", value)
+		p.clearEstimate = p.EstimateHours == nil
+		return err
+	},
+	"priority": func(p *UpdateTodoPayload, value any) (err error) {
+		p.Priority, err = requiredField[int]("priority", "an integer", value)
+		return err
+	},
+	"due_at": func(p *UpdateTodoPayload, value any) (err error) {
+		p.DueAt, err = optionalField[time.Time]("due_at", "an RFC 3339 date-time", value)
+		p.clearDueAt = p.DueAt == nil
+		return err
+	},
+	"recurrence": func(p *UpdateTodoPayload, value any) (err error) {
+		p.Recurrence, err = optionalField[string]("recurrence", "a string", value)
+		if p.Recurrence == nil {
+			p.Recurrence = new(string)
+		}
+		return err
+	},
+	"tags": func(p *UpdateTodoPayload, value any) error {
+		tags, err := optionalField[[]string]("tags", "an array of strings", value)
+		if tags == nil {
+			tags = &[]string{}
+		}
+		p.Tags = tags
+		return err
+	},
+}
+
+// optionalField converts the patched value of a field, nil staying nil.
+func optionalField[T any](field, kind string, value any) (*T, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	v := new(T)
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("%q must be %s", field, kind)
+	}
+	return v, nil
+}
+
+// requiredField converts the patched value of a field that can't be removed.
+func requiredField[T any](field, kind string, value any) (*T, error) {
+	if value == nil {
+		return nil, fmt.Errorf("%q cannot be removed", field)
+	}
+	return optionalField[T](field, kind, value)
+}
+
+// patchPayload applies a patch to a todo, whose tags must be loaded, and turns
+// the fields it changed into an update. Every changed field is validated on
+// its own, and the failures are reported against the operations that changed
+// them. Failures are *todoError. A patch that changes nothing gives no
+// payload.
+func patchPayload(item *models.TodoItem, patch todoPatch, cascade bool) (*UpdateTodoPayload, error) {
+	doc, err := todoDocument(item)
+	if err != nil {
+		return nil, newTodoError(http.StatusInternalServerError, err)
+	}
+	original, err := todoDocument(item)
+	if err != nil {
+		return nil, newTodoError(http.StatusInternalServerError, err)
+	}
+	patched, err := patch.apply(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]string, 0, len(patched)+len(original))
+	for field := range original {
+		fields = append(fields, field)
+	}
+	for field := range patched {
+		if _, ok := original[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	payload := &UpdateTodoPayload{Cascade: cascade}
+	changed := false
+	var failures []PatchOperationError
+	for _, field := range fields {
+		value := patched[field]
+		if jsonpatch.Equal(original[field], value) {
+			continue
+		}
+		changed = true
+
+		err := patchField(payload, field, value)
+		if err == nil {
+			// Each field is validated on its own, so that every
+			// failure is reported.
+			single := &UpdateTodoPayload{}
+			_ = patchField(single, field, value)
+			err = validateUpdate(single)
+		}
+		if err != nil {
+			failure := patch.locate(field)
+			failure.Error = err.Error()
+			failures = append(failures, failure)
+		}
+	}
+	if len(failures) > 0 {
+		res := &PatchErrorResponse{
+			Problem:    *problem.New(http.StatusUnprocessableEntity, problem.CodeValidationFailed, "the patched todo is invalid"),
+			Operations: failures,
+		}
+		for _, failure := range failures {
+			res.Errors = append(res.Errors, problem.FieldError{Field: strings.TrimPrefix(failure.Path, "/"), Detail: failure.Error})
+		}
+		return nil, &todoError{body: res}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	if err := validateUpdate(payload); err != nil {
+		return nil, newTodoError(http.StatusUnprocessableEntity, err)
+	}
+	return payload, nil
+}
+
+func patchField(p *UpdateTodoPayload, field string, value any) error {
+	if slices.Contains(readOnlyFields, field) {
+		return fmt.Errorf("%q cannot be changed", field)
+	}
+	set, ok := patchFields[field]
+	if !ok {
+		return fmt.Errorf("%q is not a field of a todo", field)
+	}
+	return set(p, value)
+}
@@ -0,0 +1,119 @@
+package todoctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"strconv"
+)
+
+var (
+	errProjectNotFound      = errors.New("project not found")
+	errParentInOtherProject = errors.New("a subtask must belong to its parent's project")
+)
+
+// defaultProject returns the ID of the project that takes todos created
+// without one in the workspace of db. It is looked up once per workspace and
+// then cached.
+func (ctl *Controller) defaultProject(db *gorm.DB) (uint, error) {
+	workspaceID, _ := tenant.ID(db)
+
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+
+	if id, ok := ctl.defaultProjects[workspaceID]; ok {
+		return id, nil
+	}
+
+	var project models.Project
+	if err := db.Select("id").Where("is_default = ?", true).First(&project).Error; err != nil {
+		return 0, err
+	}
+	if ctl.defaultProjects == nil {
+		ctl.defaultProjects = map[uint]uint{}
+	}
+	ctl.defaultProjects[workspaceID] = project.ID
+	return project.ID, nil
+}
+
+// routeProject resolves the :pid param of the nested /projects/:pid/todos
+// routes. It returns 0 on the top level routes. When the project is invalid it
+// writes the error response and returns false.
+func (ctl *Controller) routeProject(c *gin.Context) (uint, bool) {
+	pidStr := c.Param("pid")
+	if pidStr == "" {
+		return 0, true
+	}
+
+	pid, err := strconv.ParseUint(pidStr, 10, 64)
+	if err != nil {
+		problem.Write(c, problem.BadRequest("invalid project id"))
+		return 0, false
+	}
+
+	if err := projectExists(ctl.dbFor(c), uint(pid)); err != nil {
+		if errors.Is(err, errProjectNotFound) {
+			problem.Write(c, problem.NotFound(err.Error()))
+			return 0, false
+		}
+		problem.Write(c, problem.FromDB(err))
+		return 0, false
+	}
+
+	return uint(pid), true
+}
+
+func projectExists(db *gorm.DB, id uint) error {
+	var project models.Project
+	if err := db.Select("id").First(&project, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errProjectNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// ListProjectTodos godoc
+// @Summary List the todos of a project
+// @Description List the todos of a project. Takes the same filters and pagination params as GET /todos.
+// @Tags projects
+// @Produce json
+// @Param pid path int true "Project ID"
+// @Param page query int false "page number" default(1)
+// @Param page_size query int false "page size" default(20)
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
+// @Success 200 {object} TodoListResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /projects/{pid}/todos [get]
+func (ctl *Controller) ListProjectTodos() gin.HandlerFunc {
+	return ctl.GetTodoItemList()
+}
+
+// CreateProjectTodo godoc
+// @Summary Create a todo in a project
+// @Description Create a new todo in the project from the path, which takes precedence over "project_id" in the body
+// @Tags projects
+// @Accept json
+// @Produce json
+// @Param pid path int true "Project ID"
+// @Param request body todoctrl.CreateTodoPayload true "Todo payload"
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
+// @Success 201 {object} models.TodoItem
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /projects/{pid}/todos [post]
+func (ctl *Controller) CreateProjectTodo() gin.HandlerFunc {
+	return ctl.CreateTodo()
+}
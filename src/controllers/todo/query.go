@@ -0,0 +1,116 @@
+package todoctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/querylang"
+	"strings"
+	"time"
+)
+
+var dateColumns = map[string]string{
+	"due":     "due_at",
+	"created": "created_at",
+	"updated": "updated_at",
+}
+
+// queryCondition translates a parsed "q" query into a WHERE condition. Values
+// are always passed as bind vars, never spliced into the SQL.
+func (ctl *Controller) queryCondition(node querylang.Node, now time.Time) (string, []any, error) {
+	switch n := node.(type) {
+	case *querylang.And:
+		return ctl.joinConditions(n.Nodes, " AND ", now)
+
+	case *querylang.Or:
+		return ctl.joinConditions(n.Nodes, " OR ", now)
+
+	case *querylang.Not:
+		sql, vars, err := ctl.queryCondition(n.Node, now)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + sql + ")", vars, nil
+
+	case *querylang.Text:
+		pattern := containsPattern(n.Value)
+		return "(title ILIKE ? OR description ILIKE ?)", []any{pattern, pattern}, nil
+
+	case *querylang.Title:
+		return "title ILIKE ?", []any{containsPattern(n.Value)}, nil
+
+	case *querylang.Is:
+		switch n.Value {
+		case "open":
+			return "is_done = ?", []any{false}, nil
+		case "done":
+			return "is_done = ?", []any{true}, nil
+		case "overdue":
+			return "(is_done = ? AND due_at < ?)", []any{false, now}, nil
+		case "recurring":
+			return "recurrence <> ''", nil, nil
+		}
+
+	case *querylang.Status:
+		if err := ctl.checkStatus(n.Value); err != nil {
+			return "", nil, &querylang.Error{Pos: n.At, Msg: err.Error()}
+		}
+		return "status = ?", []any{n.Value}, nil
+
+	case *querylang.Tag:
+		return taggedTodosSQL, []any{[]string{n.Name}}, nil
+
+	case *querylang.Project:
+		return "project_id = ?", []any{n.ID}, nil
+
+	case *querylang.Priority:
+		return fmt.Sprintf("priority %s ?", n.Op), []any{n.Level}, nil
+
+	case *querylang.Date:
+		column := dateColumns[n.Field]
+		if n.Value.None {
+			return column + " IS NULL", nil, nil
+		}
+
+		t := n.Value.Resolve(now)
+		if n.Op == querylang.OpEq {
+			// "=" matches the whole day.
+			day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+			return fmt.Sprintf("(%s >= ? AND %s < ?)", column, column), []any{day, day.AddDate(0, 0, 1)}, nil
+		}
+		return fmt.Sprintf("%s %s ?", column, n.Op), []any{t}, nil
+	}
+
+	return "", nil, &querylang.Error{Pos: node.Pos(), Msg: "unsupported term"}
+}
+
+func (ctl *Controller) joinConditions(nodes []querylang.Node, sep string, now time.Time) (string, []any, error) {
+	parts := make([]string, 0, len(nodes))
+	var vars []any
+	for _, node := range nodes {
+		sql, v, err := ctl.queryCondition(node, now)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, sql)
+		vars = append(vars, v...)
+	}
+	return "(" + strings.Join(parts, sep) + ")", vars, nil
+}
+
+// QueryErrorResponse is the problem of an invalid "q" param, pointing at the
+// column of the error when there is one.
+type QueryErrorResponse struct {
+	problem.Problem
+	Position *int `json:"position,omitempty" example:"7"`
+}
+
+// queryError turns an error of the "q" param into a problem.
+func queryError(err error) *QueryErrorResponse {
+	res := &QueryErrorResponse{Problem: *problem.BadRequest("invalid \"q\" query param: " + err.Error())}
+	var qErr *querylang.Error
+	if errors.As(err, &qErr) {
+		res.Position = &qErr.Pos
+	}
+	return res
+}
@@ -0,0 +1,155 @@
+package todoctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/recurrence"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// maxTitleLength mirrors the size of models.TodoItem.Title.
+const maxTitleLength = 50
+
+var (
+	errRecurrenceWithoutDue = problem.Invalid("due_at", "a recurring todo needs a \"due_at\"")
+
+	occurrenceSuffix = regexp.MustCompile(` \(\d{4}-\d{2}-\d{2}( \d{2}:\d{2}(:\d{2})?)?\)$`)
+)
+
+type TodoOccurrencesResponse struct {
+	ID          uint        `json:"id" example:"3"`
+	Recurrence  string      `json:"recurrence" example:"FREQ=WEEKLY;BYDAY=MO"`
+	DueAt       *time.Time  `json:"due_at" example:"2026-01-05T09:00:00Z"`
+	Occurrences []time.Time `json:"occurrences"`
+}
+
+// ListTodoOccurrences godoc
+// @Summary Preview occurrences
+// @Description Preview the due dates of the next occurrences of a recurring todo without creating them
+// @Tags todos
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param count query int false "Number of occurrences (at most 100)" default(5)
+// @Success 200 {object} TodoOccurrencesResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/occurrences [get]
+func (ctl *Controller) ListTodoOccurrences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		count := 5
+		if countStr := c.Query("count"); countStr != "" {
+			count, err = strconv.Atoi(countStr)
+			if err != nil || count < 1 {
+				problem.Write(c, problem.BadRequest("\"count\" must be a positive number"))
+				return
+			}
+		}
+		count = min(count, recurrence.MaxPreview)
+
+		var item models.TodoItem
+		if err := ctl.dbFor(c).Select("id", "recurrence", "due_at").First(&item, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		res := TodoOccurrencesResponse{
+			ID:          item.ID,
+			Recurrence:  item.Recurrence,
+			DueAt:       item.DueAt,
+			Occurrences: []time.Time{},
+		}
+		if item.Recurrence != "" && item.DueAt != nil {
+			res.Occurrences, err = recurrence.Preview(item.Recurrence, *item.DueAt, count)
+			if err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, res)
+	}
+}
+
+// createNextOccurrence creates the todo that follows a completed occurrence of
+// a recurring series, copying it with the due date rolled forward. It returns
+// nil when the series is over.
+func (ctl *Controller) createNextOccurrence(tx *gorm.DB, id uint, rule string) (*models.TodoItem, error) {
+	var done models.TodoItem
+	if err := tx.Preload("Tags").First(&done, id).Error; err != nil {
+		return nil, err
+	}
+	if done.DueAt == nil {
+		return nil, errRecurrenceWithoutDue
+	}
+
+	due, nextRule, ok, err := recurrence.Next(rule, *done.DueAt)
+	if err != nil || !ok {
+		return nil, err
+	}
+	layout, err := recurrence.Layout(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesID := done.SeriesID
+	if seriesID == nil {
+		seriesID = &done.ID
+	}
+
+	next := models.TodoItem{
+		WorkspaceID:   done.WorkspaceID,
+		ProjectID:     done.ProjectID,
+		Title:         occurrenceTitle(done.Title, due.Format(layout)),
+		Description:   done.Description,
+		Status:        ctl.workflow.Initial,
+		EstimateHours: done.EstimateHours,
+		Priority:      done.Priority,
+		DueAt:         &due,
+		Tags:          done.Tags,
+		ParentID:      done.ParentID,
+		Recurrence:    nextRule,
+		SeriesID:      seriesID,
+		OwnerID:       done.OwnerID,
+	}
+	if err := tx.Create(&next).Error; err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// occurrenceTitle names an occurrence after the series with its due date
+// appended, so that occurrences don't clash on the per-project unique title.
+// The date carries the time for rules repeating within a day.
+func occurrenceTitle(title, due string) string {
+	suffix := fmt.Sprintf(" (%s)", due)
+
+	base := []rune(occurrenceSuffix.ReplaceAllString(title, ""))
+	if len(base)+len([]rune(suffix)) > maxTitleLength {
+		base = base[:maxTitleLength-len([]rune(suffix))]
+	}
+	return string(base) + suffix
+}
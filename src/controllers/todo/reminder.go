@@ -0,0 +1,179 @@
+package todoctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type ReminderListResponse struct {
+	Items []models.Reminder `json:"items"`
+}
+
+// ListTodoReminders godoc
+// @Summary List reminders
+// @Description List the reminders of a todo, fired or not, ordered by time
+// @Tags reminders
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} ReminderListResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/reminders [get]
+func (ctl *Controller) ListTodoReminders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		var todo models.TodoItem
+		if err := ctl.dbFor(c).Select("id").First(&todo, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		items := []models.Reminder{}
+		if err := ctl.dbFor(c).Where("todo_item_id = ?", id).Order("remind_at, id").Find(&items).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, ReminderListResponse{Items: items})
+	}
+}
+
+// AddTodoReminder godoc
+// @Summary Add a reminder
+// @Description Add a reminder to a todo. It is fired once by the reminder scheduler when its time comes.
+// @Tags reminders
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body todoctrl.AddTodoReminder.Payload true "Reminder payload"
+// @Success 201 {object} models.Reminder
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/reminders [post]
+func (ctl *Controller) AddTodoReminder() gin.HandlerFunc {
+	type Payload struct {
+		RemindAt *time.Time `json:"remind_at" example:"2026-01-31T09:00:00Z"`
+	}
+
+	validate := func(c *gin.Context) (*Payload, error) {
+		p := &Payload{}
+		if err := c.ShouldBindJSON(p); err != nil {
+			return nil, err
+		}
+
+		if p.RemindAt == nil {
+			return nil, problem.Invalid("remind_at", "\"remind_at\" is required")
+		}
+		if !p.RemindAt.After(time.Now()) {
+			return nil, problem.Invalid("remind_at", "\"remind_at\" must be in the future")
+		}
+
+		return p, nil
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload, err := validate(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var todo models.TodoItem
+		if err := ctl.dbFor(c).Select("id").First(&todo, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		reminder := models.Reminder{TodoItemID: todo.ID, RemindAt: payload.RemindAt.UTC()}
+		if err := ctl.dbFor(c).Create(&reminder).Error; err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusCreated, reminder)
+	}
+}
+
+// RemoveTodoReminder godoc
+// @Summary Remove a reminder
+// @Description Remove a reminder of the todo
+// @Tags reminders
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param reminder_id path int true "Reminder ID"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/reminders/{reminder_id} [delete]
+func (ctl *Controller) RemoveTodoReminder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+		reminderID, err := strconv.ParseUint(c.Param("reminder_id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid reminder id"))
+			return
+		}
+
+		res := ctl.dbFor(c).
+			Where("id = ? AND todo_item_id = ?", reminderID, id).
+			Delete(&models.Reminder{})
+		if res.Error != nil {
+			problem.Write(c, problem.FromDB(res.Error))
+			return
+		}
+		if res.RowsAffected == 0 {
+			problem.Write(c, problem.NotFound("reminder not found"))
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,67 @@
+package todoctrl
+
+import (
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/search"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+type TodoSearchResponse struct {
+	Count     int64        `json:"count" example:"42"`
+	Page      int          `json:"page" example:"1"`
+	PageSize  int          `json:"page_size" example:"20"`
+	PageCount int          `json:"page_count" example:"3"`
+	Items     []search.Hit `json:"items"`
+}
+
+// SearchTodos godoc
+// @Summary Search todos
+// @Description Full-text search over todo titles and descriptions, best match first. Matched words are wrapped in
+// @Description <b></b> in the title and in the description snippet, whose text is otherwise HTML-escaped. On Postgres the query supports the web search
+// @Description syntax: words, "quoted phrases", OR and -excluded words.
+// @Tags todos
+// @Produce json
+// @Param q query string true "Search text"
+// @Param page query int false "page number" default(1)
+// @Param page_size query int false "page size" default(20)
+// @Success 200 {object} TodoSearchResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 500 {object} problem.Problem
+// @Router /todos/search [get]
+func (ctl *Controller) SearchTodos() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		q := strings.TrimSpace(c.Query("q"))
+		if q == "" {
+			problem.Write(c, problem.BadRequest("\"q\" query param is required"))
+			return
+		}
+
+		page, pageSize, err := parsePagination(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		hits, total, err := ctl.searcher.Search(ctl.dbFor(c), q, pageSize, (page-1)*pageSize)
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, TodoSearchResponse{
+			Count:     total,
+			Page:      page,
+			PageSize:  pageSize,
+			PageCount: int((total + int64(pageSize) - 1) / int64(pageSize)),
+			Items:     hits,
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package todoctrl
+
+import (
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+)
+
+var (
+	errUnknownStatus  = errors.New("unknown status")
+	errStatusMismatch = problem.Invalid("is_done", "\"is_done\" contradicts \"status\"")
+)
+
+// TransitionErrorResponse is the problem of a refused status change, with the
+// statuses the todo can move to instead.
+type TransitionErrorResponse struct {
+	problem.Problem
+	From    string   `json:"from" example:"done"`
+	To      string   `json:"to" example:"in_review"`
+	Allowed []string `json:"allowed" example:"todo"`
+}
+
+// GetWorkflow godoc
+// @Summary Get the workflow
+// @Description Get the statuses todos can be in and the transitions allowed between them
+// @Tags todos
+// @Produce json
+// @Success 200 {object} workflow.Workflow
+// @Failure 403 {object} rbac.DeniedResponse
+// @Router /workflow [get]
+func (ctl *Controller) GetWorkflow() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		c.JSON(http.StatusOK, ctl.workflow)
+	}
+}
+
+// checkStatus makes sure status is one of the workflow's states.
+func (ctl *Controller) checkStatus(status string) error {
+	if !ctl.workflow.HasState(status) {
+		return fmt.Errorf("%w %q", errUnknownStatus, status)
+	}
+	return nil
+}
+
+// targetStatus works out the status a todo ends up in from the "status" and
+// the legacy "is_done" fields of a request. Setting is_done moves the todo to
+// the workflow's done state, clearing it moves it back to the initial state.
+func (ctl *Controller) targetStatus(current string, status *string, isDone *bool) (string, error) {
+	wf := ctl.workflow
+
+	if status != nil {
+		if err := ctl.checkStatus(*status); err != nil {
+			return "", err
+		}
+		if isDone != nil && *isDone != wf.IsDone(*status) {
+			return "", errStatusMismatch
+		}
+		return *status, nil
+	}
+
+	if isDone == nil || *isDone == wf.IsDone(current) {
+		return current, nil
+	}
+	if *isDone {
+		return wf.DoneState, nil
+	}
+	return wf.Initial, nil
+}
+
+// transitionError builds the 409 body for a refused status change.
+func (ctl *Controller) transitionError(from, to string) *TransitionErrorResponse {
+	detail := fmt.Sprintf("cannot move a todo from %q to %q", from, to)
+	return &TransitionErrorResponse{
+		Problem: *problem.New(http.StatusConflict, problem.CodeIllegalTransition, detail),
+		From:    from,
+		To:      to,
+		Allowed: ctl.workflow.Allowed(from),
+	}
+}
+
+// parseStatusFilter splits a comma separated list of statuses from a query
+// param.
+func (ctl *Controller) parseStatusFilter(value string) ([]string, error) {
+	var statuses []string
+	for _, part := range strings.Split(value, ",") {
+		status := strings.TrimSpace(part)
+		if err := ctl.checkStatus(status); err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// createStatus picks the status of a new todo: the requested one, or else the
+// done or initial state depending on is_done.
+func (ctl *Controller) createStatus(status string, isDone bool) (string, error) {
+	if status == "" {
+		if isDone {
+			return ctl.workflow.DoneState, nil
+		}
+		return ctl.workflow.Initial, nil
+	}
+
+	if err := ctl.checkStatus(status); err != nil {
+		return "", err
+	}
+	if isDone && !ctl.workflow.IsDone(status) {
+		return "", errStatusMismatch
+	}
+	return status, nil
+}
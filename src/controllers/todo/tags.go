@@ -0,0 +1,75 @@
+package todoctrl
+
+import (
+	"github.com/alirezamastery/graph_task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"strings"
+)
+
+// taggedTodosSQL keeps the todos that carry at least one of the tags.
+const taggedTodosSQL = "todo_items.id IN (SELECT todo_item_tags.todo_item_id FROM todo_item_tags " +
+	"JOIN tags ON tags.id = todo_item_tags.tag_id WHERE tags.name IN ?)"
+
+// normalizeTagNames normalizes and de-duplicates tag names, keeping their
+// original order.
+func normalizeTagNames(names []string) ([]string, error) {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		n, err := models.NormalizeTagName(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[n] {
+			seen[n] = true
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
+
+// resolveTags returns the tags with the given (normalized) names, creating the
+// ones that don't exist yet.
+func resolveTags(tx *gorm.DB, names []string) ([]models.Tag, error) {
+	tags := []models.Tag{}
+	if len(names) == 0 {
+		return tags, nil
+	}
+
+	missing := make([]models.Tag, len(names))
+	for i, name := range names {
+		missing[i] = models.Tag{Name: name}
+	}
+	if err := tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "name"}},
+		DoNothing: true,
+	}).Create(&missing).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("name IN ?", names).Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// parseTagFilter splits a comma separated list of tag names from a query param.
+func parseTagFilter(value string) ([]string, error) {
+	return normalizeTagNames(strings.Split(value, ","))
+}
+
+// withAnyTag keeps the todos that carry at least one of the tags.
+func withAnyTag(query *gorm.DB, names []string) *gorm.DB {
+	return query.Where(taggedTodosSQL, names)
+}
+
+// withAllTags keeps the todos that carry every one of the tags.
+func withAllTags(query *gorm.DB, names []string) *gorm.DB {
+	return query.Where(
+		"todo_items.id IN (SELECT todo_item_tags.todo_item_id FROM todo_item_tags "+
+			"JOIN tags ON tags.id = todo_item_tags.tag_id WHERE tags.name IN ? "+
+			"GROUP BY todo_item_tags.todo_item_id HAVING COUNT(DISTINCT tags.id) = ?)",
+		names, len(names),
+	)
+}
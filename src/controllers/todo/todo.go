@@ -3,350 +3,1121 @@ package todoctrl
 import (
 	"errors"
 	"fmt"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/cursor"
+	"github.com/alirezamastery/graph_task/jsonpatch"
 	"github.com/alirezamastery/graph_task/middleware"
 	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/querylang"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/recurrence"
 	"github.com/gin-gonic/gin"
 	"go.opentelemetry.io/otel"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
-type ErrorResponse struct {
-	Error string `json:"error" example:"something went wrong"`
+// todoError is a refused operation on a todo, with the problem it is answered
+// with.
+type todoError struct {
+	body problem.Details
 }
 
+func (e *todoError) Error() string {
+	return e.body.Base().Detail
+}
+
+// newTodoError is a todoError with the default code of its status. Validation
+// failures and database errors get their own codes.
+func newTodoError(status int, err error) *todoError {
+	switch status {
+	case http.StatusBadRequest:
+		return &todoError{body: problem.Validation(err)}
+	case http.StatusInternalServerError:
+		return &todoError{body: problem.FromDB(err)}
+	default:
+		return &todoError{body: problem.Status(status, err.Error())}
+	}
+}
+
+// writeTodoError answers with a *todoError, or with a problem made from other
+// errors.
+func writeTodoError(c *gin.Context, err error) {
+	var e *todoError
+	if errors.As(err, &e) {
+		problem.Write(c, e.body)
+		return
+	}
+	problem.Write(c, problem.FromDB(err))
+}
+
+// TodoListResponse is a page of todos. Page is 0 when paging with cursors.
 type TodoListResponse struct {
-	Count     int64             `json:"count" example:"42"`
-	Page      int               `json:"page" example:"1"`
-	PageSize  int               `json:"page_size" example:"20"`
-	PageCount int               `json:"page_count" example:"3"`
-	Items     []models.TodoItem `json:"items"`
+	Count      int64             `json:"count" example:"42"`
+	Page       int               `json:"page" example:"1"`
+	PageSize   int               `json:"page_size" example:"20"`
+	PageCount  int               `json:"page_count" example:"3"`
+	NextCursor string            `json:"next_cursor,omitempty" example:"eyJzIjoiLWNyZWF0ZWRfYXQsaWQiLCJ2IjpbXX0.c2ln"`
+	PrevCursor string            `json:"prev_cursor,omitempty" example:"eyJzIjoiLWNyZWF0ZWRfYXQsaWQiLCJ2IjpbXSwiYiI6dHJ1ZX0.c2ln"`
+	Items      []models.TodoItem `json:"items"`
 }
 
 // GetTodoItemByID godoc
 // @Summary Get a todo
-// @Description Get a todo item by ID
+// @Description Get a todo item by ID, including whether it is blocked by unfinished prerequisites. The ETag header
+// @Description carries its version, to send back in If-Match when changing it.
 // @Tags todos
 // @Produce json
 // @Param id path int true "Todo ID"
-// @Success 200 {object} models.TodoItem
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
+// @Success 200 {object} todoctrl.GetTodoItemByID.Response
+// @Header 200 {string} ETag "Version of the todo"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [get]
 func (ctl *Controller) GetTodoItemByID() gin.HandlerFunc {
 	type Response struct {
-		ID          uint   `json:"id"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		IsDone      bool   `json:"is_done"`
+		models.TodoItem
+		Progress  float64 `json:"progress"`
+		IsBlocked bool    `json:"is_blocked"`
+		BlockedBy []uint  `json:"blocked_by"`
 	}
 
 	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
 		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		v, err := parseView(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
 			return
 		}
 
 		var item models.TodoItem
 
-		if err := ctl.db.First(&item, id).Error; err != nil {
+		if err := ctl.dbFor(c).Preload("Tags").First(&item, id).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "item not found"})
+				problem.Write(c, problem.NotFound("item not found"))
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		blockers, err := openBlockers(ctl.dbFor(c), item.ID)
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		tree, err := ctl.loadTree(ctl.dbFor(c), item.ID)
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
 			return
 		}
 
 		res := &Response{
-			ID:          item.ID,
-			Title:       item.Title,
-			Description: item.Description,
-			IsDone:      item.IsDone,
+			TodoItem:  item,
+			Progress:  tree.Progress,
+			IsBlocked: len(blockers) > 0,
+			BlockedBy: blockers,
 		}
 
-		c.JSON(http.StatusOK, res)
+		setETag(c, &item)
+		ctl.writeTodo(c, http.StatusOK, res, &item, v)
+	}
+}
+
+type CreateTodoPayload struct {
+	ProjectID     *uint      `json:"project_id" example:"1"`
+	Title         string     `json:"title"`
+	Description   string     `json:"description"`
+	Status        string     `json:"status" example:"todo"`
+	IsDone        bool       `json:"is_done"`
+	EstimateHours *float64   `json:"estimate_hours" example:"2.5"`
+	ParentID      *uint      `json:"parent_id" example:"1"`
+	Priority      int        `json:"priority" enums:"1,2,3,4" example:"2"`
+	DueAt         *time.Time `json:"due_at" example:"2026-01-31T17:00:00Z"`
+	Recurrence    string     `json:"recurrence" example:"FREQ=WEEKLY;BYDAY=MO"`
+	Tags          []string   `json:"tags" example:"backend,customer-acme"`
+}
+
+// validateCreate checks a new todo and fills in the defaults.
+func (ctl *Controller) validateCreate(p *CreateTodoPayload) error {
+	p.Title = strings.TrimSpace(p.Title)
+	if p.Title == "" {
+		return problem.Invalid("title", "\"title\" cannot be empty")
+	}
+	p.Description = strings.TrimSpace(p.Description)
+	status, err := ctl.createStatus(p.Status, p.IsDone)
+	if err != nil {
+		return err
+	}
+	p.Status = status
+	p.IsDone = ctl.workflow.IsDone(status)
+	if p.EstimateHours != nil && *p.EstimateHours < 0 {
+		return problem.Invalid("estimate_hours", "\"estimate_hours\" cannot be negative")
+	}
+	if p.Priority == 0 {
+		p.Priority = models.PriorityMedium
+	}
+	if !models.ValidPriority(p.Priority) {
+		return problem.Invalid("priority", "\"priority\" must be between 1 (low) and 4 (urgent)")
+	}
+	p.Recurrence, err = recurrence.Normalize(p.Recurrence)
+	if err != nil {
+		return problem.Invalid("recurrence", "invalid \"recurrence\": "+err.Error())
+	}
+	if p.Recurrence != "" && p.DueAt == nil {
+		return errRecurrenceWithoutDue
+	}
+	tags, err := normalizeTagNames(p.Tags)
+	if err != nil {
+		return problem.Invalid("tags", err.Error())
+	}
+	p.Tags = tags
+
+	return nil
+}
+
+// newTodoItem builds the todo for a validated payload. Its tags are resolved
+// separately.
+func newTodoItem(projectID uint, ownerID *uint, p *CreateTodoPayload) models.TodoItem {
+	return models.TodoItem{
+		ProjectID:     projectID,
+		OwnerID:       ownerID,
+		Title:         p.Title,
+		Description:   p.Description,
+		Status:        p.Status,
+		IsDone:        p.IsDone,
+		EstimateHours: p.EstimateHours,
+		ParentID:      p.ParentID,
+		Priority:      p.Priority,
+		DueAt:         p.DueAt,
+		Recurrence:    p.Recurrence,
 	}
 }
 
+// requestUser is the authenticated user of a request, recorded as the owner
+// of the todos it creates.
+func requestUser(c *gin.Context) *uint {
+	if id, ok := auth.UserID(c); ok {
+		return &id
+	}
+	return nil
+}
+
 // CreateTodo godoc
 // @Summary Create todo item
-// @Description Create a new todo item
+// @Description Create a new todo item. Without "project_id" it goes into its parent's project, or into the default
+// @Description project. Titles are unique within a project.
 // @Tags todos
 // @Accept json
 // @Produce json
-// @Param request body todoctrl.CreateTodo.Payload true "Todo payload"
+// @Param request body todoctrl.CreateTodoPayload true "Todo payload"
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
 // @Success 201 {object} models.TodoItem
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos [post]
 func (ctl *Controller) CreateTodo() gin.HandlerFunc {
-	type Payload struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		IsDone      bool   `json:"is_done"`
-	}
-
-	validate := func(c *gin.Context) (*Payload, error) {
-		p := &Payload{}
+	validate := func(c *gin.Context) (*CreateTodoPayload, error) {
+		p := &CreateTodoPayload{}
 		if err := c.ShouldBindJSON(p); err != nil {
 			return nil, err
 		}
-
-		p.Title = strings.TrimSpace(p.Title)
-		if p.Title == "" {
-			return nil, errors.New("\"title\" cannot be empty")
+		if err := ctl.validateCreate(p); err != nil {
+			return nil, err
 		}
-		p.Description = strings.TrimSpace(p.Description)
-
 		return p, nil
 	}
 
 	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosCreate) {
+			return
+		}
+
 		tr := otel.Tracer("todo")
 		_, span := tr.Start(c.Request.Context(), "CreateTodo")
 		defer span.End()
 
+		projectID, ok := ctl.routeProject(c)
+		if !ok {
+			return
+		}
+
+		v, err := parseView(c)
+		if err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
 		payload, err := validate(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			problem.Write(c, problem.Validation(err))
 			return
 		}
 		fmt.Printf("payload: %+v\n", payload)
 
-		item := models.TodoItem{
-			Title:       payload.Title,
-			Description: payload.Description,
-			IsDone:      payload.IsDone,
+		if projectID == 0 && payload.ProjectID != nil {
+			if err := projectExists(ctl.dbFor(c), *payload.ProjectID); err != nil {
+				if errors.Is(err, errProjectNotFound) {
+					problem.Write(c, problem.Validation(err))
+					return
+				}
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+			projectID = *payload.ProjectID
+		}
+
+		if payload.ParentID != nil {
+			var parent models.TodoItem
+			if err := ctl.dbFor(c).Select("id", "project_id").First(&parent, *payload.ParentID).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					problem.Write(c, problem.BadRequest(errParentNotFound.Error()))
+					return
+				}
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+			if projectID == 0 {
+				projectID = parent.ProjectID
+			}
+			if parent.ProjectID != projectID {
+				problem.Write(c, problem.BadRequest(errParentInOtherProject.Error()))
+				return
+			}
 		}
-		if err := ctl.db.Create(&item).Error; err != nil {
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+
+		if projectID == 0 {
+			projectID, err = ctl.defaultProject(ctl.dbFor(c))
+			if err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
+
+		item := newTodoItem(projectID, requestUser(c), payload)
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			tags, err := resolveTags(tx, payload.Tags)
+			if err != nil {
+				return err
+			}
+			item.Tags = tags
+			return tx.Create(&item).Error
+		})
+		if err != nil {
+			problem.Write(c, problem.FromDB(err))
 			return
 		}
 
 		middleware.TasksCount.Inc()
 
-		c.JSON(http.StatusCreated, item)
+		setETag(c, &item)
+		ctl.writeTodo(c, http.StatusCreated, item, &item, v)
 	}
 }
 
 // GetTodoItemList godoc
 // @Summary List todos
-// @Description List todos with optional done filter and pagination
+// @Description List todos with optional filters, sorting and pagination. Pages can be requested by number or, faster
+// @Description and stable while todos are added, by following the next_cursor and prev_cursor of the previous page.
 // @Tags todos
 // @Produce json
+// @Param project_id query int false "Only todos of this project"
 // @Param page query int false "page number" default(1)
 // @Param page_size query int false "page size" default(20)
-// @Param done query bool false "Filter by is_done"
+// @Param cursor query string false "next_cursor or prev_cursor of a previous page, instead of page"
+// @Param sort query string false "Comma separated fields, \"-\" for descending: id, title, status, priority, due_at, created_at, updated_at" default(-created_at)
+// @Param is_done query bool false "Filter by is_done"
+// @Param status query string false "Comma separated workflow statuses (e.g. in_progress,in_review)"
+// @Param priority query string false "Comma separated priorities, by name or level (e.g. high,urgent or 3,4)"
+// @Param due_before query string false "Only todos due before this RFC 3339 time"
+// @Param due_after query string false "Only todos due after this RFC 3339 time"
+// @Param overdue query bool false "Only open todos past their due date (or, with false, everything else)"
+// @Param tags_any query string false "Comma separated tag names, todos carrying at least one of them"
+// @Param tags_all query string false "Comma separated tag names, todos carrying all of them"
+// @Param title query string false "Only todos whose title contains this text (case insensitive)"
+// @Param created_after query string false "Only todos created after this RFC 3339 time"
+// @Param created_before query string false "Only todos created before this RFC 3339 time"
+// @Param updated_after query string false "Only todos updated after this RFC 3339 time"
+// @Param updated_before query string false "Only todos updated before this RFC 3339 time"
+// @Param has_description query bool false "Only todos with (or, with false, without) a description"
+// @Param q query string false "Search query, e.g. is:open tag:backend due:<7d \"release\" (see the README for the syntax)"
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
 // @Success 200 {object} TodoListResponse
-// @Failure 400 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 500 {object} problem.Problem
 // @Router /todos [get]
 func (ctl *Controller) GetTodoItemList() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		pageStr := c.Query("page")
-		if pageStr == "" {
-			pageStr = "1"
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
 		}
-		page, err := strconv.Atoi(pageStr)
+
+		page, pageSize, err := parsePagination(c)
 		if err != nil {
-			page = 1
+			problem.Write(c, problem.Validation(err))
+			return
 		}
 
-		pageSizeStr := c.Query("page_size")
-		if pageSizeStr == "" {
-			pageSizeStr = "20"
-		}
-		pageSize, err := strconv.Atoi(pageSizeStr)
+		v, err := parseView(c)
 		if err != nil {
-			pageSize = 20
+			problem.Write(c, problem.Validation(err))
+			return
 		}
 
-		if page < 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "\"page\" must be at least 1"})
+		var cur *cursor.Cursor
+		if token := c.Query("cursor"); token != "" {
+			if c.Query("page") != "" {
+				problem.Write(c, problem.BadRequest("\"cursor\" and \"page\" cannot be combined"))
+				return
+			}
+			decoded, err := ctl.cursors.Decode(token)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"cursor\" query param"))
+				return
+			}
+			cur = &decoded
+		}
+
+		// A cursor carries its sort, repeating it is optional.
+		sortStr := c.Query("sort")
+		if sortStr == "" && cur != nil {
+			sortStr = cur.Sort
+		}
+		keys, err := parseSort(sortStr)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid \"sort\" query param: "+err.Error()))
 			return
 		}
-		if pageSize < 1 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "\"page_size\" must be at least 1"})
+
+		var after []any
+		if cur != nil {
+			if cur.Sort != sortParam(keys) {
+				problem.Write(c, problem.BadRequest(errCursorSort.Error()))
+				return
+			}
+			if after, err = cursorValues(keys, cur.Values); err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"cursor\" query param"))
+				return
+			}
+		}
+
+		projectID, ok := ctl.routeProject(c)
+		if !ok {
 			return
 		}
-		if pageSize > 100 {
-			pageSize = 100
+		if projectStr := c.Query("project_id"); projectID == 0 && projectStr != "" {
+			pid, err := strconv.ParseUint(projectStr, 10, 64)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"project_id\" query param"))
+				return
+			}
+			projectID = uint(pid)
 		}
 
-		query := ctl.db.Model(&models.TodoItem{})
+		query := ctl.dbFor(c).Model(&models.TodoItem{})
+
+		if projectID != 0 {
+			query = query.Where("project_id = ?", projectID)
+		}
 
 		if doneStr := c.Query("is_done"); doneStr != "" {
 			done, err := strconv.ParseBool(doneStr)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid \"is_done\" query param"})
+				problem.Write(c, problem.BadRequest("invalid \"is_done\" query param"))
 				return
 			}
 			query = query.Where("is_done = ?", done)
 		}
 
+		if statusStr := c.Query("status"); statusStr != "" {
+			statuses, err := ctl.parseStatusFilter(statusStr)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"status\" query param: "+err.Error()))
+				return
+			}
+			query = query.Where("status IN ?", statuses)
+		}
+
+		if priorityStr := c.Query("priority"); priorityStr != "" {
+			var priorities []int
+			for _, part := range strings.Split(priorityStr, ",") {
+				p, err := models.ParsePriority(part)
+				if err != nil {
+					problem.Write(c, problem.BadRequest("invalid \"priority\" query param: "+err.Error()))
+					return
+				}
+				priorities = append(priorities, p)
+			}
+			query = query.Where("priority IN ?", priorities)
+		}
+
+		for _, r := range []struct{ param, cond string }{
+			{"due_before", "due_at < ?"},
+			{"due_after", "due_at > ?"},
+			{"created_before", "created_at < ?"},
+			{"created_after", "created_at > ?"},
+			{"updated_before", "updated_at < ?"},
+			{"updated_after", "updated_at > ?"},
+		} {
+			t, err := parseTimeParam(c, r.param)
+			if err != nil {
+				problem.Write(c, problem.Validation(err))
+				return
+			}
+			if t != nil {
+				query = query.Where(r.cond, *t)
+			}
+		}
+
+		if title := strings.TrimSpace(c.Query("title")); title != "" {
+			query = query.Where("title ILIKE ?", containsPattern(title))
+		}
+
+		if q := c.Query("q"); q != "" {
+			node, err := querylang.Parse(q)
+			if err != nil {
+				problem.Write(c, queryError(err))
+				return
+			}
+			if node != nil {
+				sql, vars, err := ctl.queryCondition(node, time.Now())
+				if err != nil {
+					problem.Write(c, queryError(err))
+					return
+				}
+				query = query.Where(sql, vars...)
+			}
+		}
+
+		if hasDescStr := c.Query("has_description"); hasDescStr != "" {
+			hasDesc, err := strconv.ParseBool(hasDescStr)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"has_description\" query param"))
+				return
+			}
+			if hasDesc {
+				query = query.Where("description <> ''")
+			} else {
+				query = query.Where("description = ''")
+			}
+		}
+
+		if overdueStr := c.Query("overdue"); overdueStr != "" {
+			overdue, err := strconv.ParseBool(overdueStr)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"overdue\" query param"))
+				return
+			}
+			now := time.Now()
+			if overdue {
+				query = query.Where("is_done = ? AND due_at < ?", false, now)
+			} else {
+				query = query.Where("(is_done = ? OR due_at IS NULL OR due_at >= ?)", true, now)
+			}
+		}
+
+		if tagsStr := c.Query("tags_any"); tagsStr != "" {
+			names, err := parseTagFilter(tagsStr)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"tags_any\" query param: "+err.Error()))
+				return
+			}
+			query = withAnyTag(query, names)
+		}
+
+		if tagsStr := c.Query("tags_all"); tagsStr != "" {
+			names, err := parseTagFilter(tagsStr)
+			if err != nil {
+				problem.Write(c, problem.BadRequest("invalid \"tags_all\" query param: "+err.Error()))
+				return
+			}
+			query = withAllTags(query, names)
+		}
+
 		var total int64
 		if err := query.Count(&total).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			problem.Write(c, problem.FromDB(err))
 			return
 		}
 
-		offset := (page - 1) * pageSize
+		items := []models.TodoItem{}
+		var hasNext, hasPrev bool
+		if cur == nil {
+			offset := (page - 1) * pageSize
+			if err := query.
+				Preload("Tags").
+				Order(orderClause(keys)).
+				Limit(pageSize).
+				Offset(offset).
+				Find(&items).Error; err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+			hasNext = int64(offset+len(items)) < total
+			hasPrev = page > 1
+		} else {
+			// Walking backward, the page is read in reverse order from the
+			// cursor and flipped afterward. One extra row tells whether the
+			// list goes on.
+			walk := keys
+			if cur.Backward {
+				walk = reverseKeys(keys)
+			}
+			cond, args := keysetCondition(walk, after)
+			if err := query.
+				Preload("Tags").
+				Where(cond, args...).
+				Order(orderClause(walk)).
+				Limit(pageSize + 1).
+				Find(&items).Error; err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
 
-		var items []models.TodoItem
-		if err := query.
-			Find(&items).
-			Order("created_at desc").
-			Limit(pageSize).
-			Offset(offset).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			more := len(items) > pageSize
+			if more {
+				items = items[:pageSize]
+			}
+			hasNext, hasPrev = more, true
+			if cur.Backward {
+				slices.Reverse(items)
+				hasNext, hasPrev = true, more
+			}
+			page = 0
 		}
 
-		totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+		resp := TodoListResponse{
+			Count:     total,
+			Page:      page,
+			PageSize:  pageSize,
+			PageCount: int((total + int64(pageSize) - 1) / int64(pageSize)),
+			Items:     items,
+		}
+		if len(items) > 0 {
+			if hasNext {
+				resp.NextCursor, err = ctl.cursors.Encode(cursor.Cursor{Sort: sortParam(keys), Values: sortValues(&items[len(items)-1], keys)})
+			}
+			if hasPrev && err == nil {
+				resp.PrevCursor, err = ctl.cursors.Encode(cursor.Cursor{Sort: sortParam(keys), Values: sortValues(&items[0], keys), Backward: true})
+			}
+			if err != nil {
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"page":       page,
-			"page_size":  pageSize,
-			"count":      total,
-			"page_count": totalPages,
-			"items":      items,
-		})
+		ctl.writeTodoList(c, &resp, v)
 	}
 }
 
+type UpdateTodoPayload struct {
+	ProjectID     *uint      `json:"project_id" example:"1"`
+	Title         *string    `json:"title"`
+	Description   *string    `json:"description"`
+	Status        *string    `json:"status" example:"in_progress"`
+	IsDone        *bool      `json:"is_done"`
+	EstimateHours *float64   `json:"estimate_hours" example:"2.5"`
+	Priority      *int       `json:"priority" enums:"1,2,3,4" example:"3"`
+	DueAt         *time.Time `json:"due_at" example:"2026-01-31T17:00:00Z"`
+	Recurrence    *string    `json:"recurrence" example:"FREQ=MONTHLY;BYMONTHDAY=1"`
+	Tags          *[]string  `json:"tags" example:"backend,customer-acme"`
+	Cascade       bool       `json:"cascade" example:"false"`
+
+	// Plain JSON can't tell null from absent, so only patches (see patch.go)
+	// clear the due date and the estimate.
+	clearEstimate bool
+	clearDueAt    bool
+}
+
+// validateUpdate checks the fields of an update that don't depend on the todo.
+func validateUpdate(p *UpdateTodoPayload) error {
+	if p.Title != nil {
+		*p.Title = strings.TrimSpace(*p.Title)
+		if *p.Title == "" {
+			return problem.Invalid("title", "\"title\" cannot be empty")
+		}
+	}
+	if p.Description != nil {
+		*p.Description = strings.TrimSpace(*p.Description)
+	}
+	if p.EstimateHours != nil && *p.EstimateHours < 0 {
+		return problem.Invalid("estimate_hours", "\"estimate_hours\" cannot be negative")
+	}
+	if p.Priority != nil && !models.ValidPriority(*p.Priority) {
+		return problem.Invalid("priority", "\"priority\" must be between 1 (low) and 4 (urgent)")
+	}
+	if p.Recurrence != nil {
+		rule, err := recurrence.Normalize(*p.Recurrence)
+		if err != nil {
+			return problem.Invalid("recurrence", "invalid \"recurrence\": "+err.Error())
+		}
+		p.Recurrence = &rule
+	}
+	if p.Tags != nil {
+		tags, err := normalizeTagNames(*p.Tags)
+		if err != nil {
+			return problem.Invalid("tags", err.Error())
+		}
+		p.Tags = &tags
+	}
+
+	return nil
+}
+
+// todoUpdate is an update of a todo that passed the workflow, project and
+// subtask checks, ready to be written.
+type todoUpdate struct {
+	updates   map[string]any
+	tags      *[]string
+	subtasks  []subtaskUpdate
+	completes bool
+	rule      string
+
+	// version, when set, is the version the todo must still be at.
+	version *uint
+}
+
+// subtaskUpdate completes an open subtask along with the todo it belongs to.
+type subtaskUpdate struct {
+	item   models.TodoItem
+	update *todoUpdate
+}
+
+// planUpdate checks an update of a todo against its current state. It runs in
+// the transaction that applies the update, with the todo locked, and locks the
+// subtasks it completes. Failures are *todoError.
+func (ctl *Controller) planUpdate(tx *gorm.DB, item *models.TodoItem, payload *UpdateTodoPayload) (*todoUpdate, error) {
+	updates := map[string]any{}
+	if payload.ProjectID != nil && *payload.ProjectID != item.ProjectID {
+		if err := projectExists(tx, *payload.ProjectID); err != nil {
+			if errors.Is(err, errProjectNotFound) {
+				return nil, newTodoError(http.StatusBadRequest, err)
+			}
+			return nil, newTodoError(http.StatusInternalServerError, err)
+		}
+		if item.ParentID != nil {
+			return nil, newTodoError(http.StatusBadRequest, errParentInOtherProject)
+		}
+		updates["project_id"] = *payload.ProjectID
+	}
+	if payload.Title != nil {
+		updates["title"] = *payload.Title
+	}
+	if payload.Description != nil {
+		updates["description"] = *payload.Description
+	}
+	status, err := ctl.targetStatus(item.Status, payload.Status, payload.IsDone)
+	if err != nil {
+		if errors.Is(err, errUnknownStatus) {
+			return nil, &todoError{body: problem.New(http.StatusBadRequest, problem.CodeUnknownStatus, err.Error())}
+		}
+		return nil, newTodoError(http.StatusBadRequest, err)
+	}
+	if status != item.Status {
+		if !ctl.workflow.CanTransition(item.Status, status) {
+			return nil, &todoError{body: ctl.transitionError(item.Status, status)}
+		}
+		updates["status"] = status
+		updates["is_done"] = ctl.workflow.IsDone(status)
+	}
+	if payload.EstimateHours != nil {
+		updates["estimate_hours"] = *payload.EstimateHours
+	} else if payload.clearEstimate {
+		updates["estimate_hours"] = nil
+	}
+	if payload.Priority != nil {
+		updates["priority"] = *payload.Priority
+	}
+	if payload.DueAt != nil {
+		updates["due_at"] = *payload.DueAt
+	} else if payload.clearDueAt {
+		updates["due_at"] = nil
+	}
+	rule := item.Recurrence
+	if payload.Recurrence != nil {
+		rule = *payload.Recurrence
+		updates["recurrence"] = rule
+	}
+	if rule != "" && payload.DueAt == nil && (item.DueAt == nil || payload.clearDueAt) {
+		return nil, newTodoError(http.StatusBadRequest, errRecurrenceWithoutDue)
+	}
+
+	if len(updates) == 0 && payload.Tags == nil {
+		return nil, newTodoError(http.StatusBadRequest, errors.New("no fields to update"))
+	}
+
+	// Completing an occurrence of a recurring todo hands the rule over to
+	// the next occurrence, so that reopening and completing it again
+	// doesn't create a second one.
+	completes := ctl.workflow.IsDone(status) && !item.IsDone
+	if completes && rule != "" {
+		updates["recurrence"] = ""
+	}
+
+	var subtasks []subtaskUpdate
+	if completes {
+		subtree, err := lockSubtree(tx, item.ID)
+		if err != nil {
+			return nil, newTodoError(http.StatusInternalServerError, err)
+		}
+		var openSubtasks []uint
+		for _, t := range subtree {
+			if t.ID != item.ID && !t.IsDone {
+				openSubtasks = append(openSubtasks, t.ID)
+			}
+		}
+
+		if len(openSubtasks) > 0 && !payload.Cascade {
+			res := &OpenSubtasksResponse{
+				Problem:      *problem.New(http.StatusConflict, problem.CodeOpenSubtasks, "todo has open subtasks"),
+				OpenSubtasks: openSubtasks,
+			}
+			return nil, &todoError{body: res}
+		}
+
+		// Subtasks move to the same status, through the workflow like any
+		// other change.
+		for _, t := range subtree {
+			if t.ID == item.ID || t.IsDone {
+				continue
+			}
+			if !ctl.workflow.CanTransition(t.Status, status) {
+				res := ctl.transitionError(t.Status, status)
+				res.Detail = fmt.Sprintf("cannot move subtask %d from %q to %q", t.ID, t.Status, status)
+				return nil, &todoError{body: res}
+			}
+			u := &todoUpdate{
+				updates:   map[string]any{"status": status, "is_done": true},
+				completes: true,
+				rule:      t.Recurrence,
+			}
+			if t.Recurrence != "" {
+				u.updates["recurrence"] = ""
+			}
+			subtasks = append(subtasks, subtaskUpdate{item: t, update: u})
+		}
+	}
+
+	return &todoUpdate{
+		updates:   updates,
+		tags:      payload.Tags,
+		subtasks:  subtasks,
+		completes: completes,
+		rule:      rule,
+	}, nil
+}
+
+// applyUpdate writes a planned update. When it completes an occurrence of a
+// recurring todo it returns the next occurrence. created counts the
+// occurrences created, including the ones of the subtasks it completes.
+func (ctl *Controller) applyUpdate(tx *gorm.DB, item *models.TodoItem, u *todoUpdate) (next *models.TodoItem, created int, err error) {
+	if projectID, ok := u.updates["project_id"]; ok {
+		subtree, err := loadSubtree(tx, item.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		ids := make([]uint, 0, len(subtree))
+		for _, t := range subtree {
+			if t.ID != item.ID {
+				ids = append(ids, t.ID)
+			}
+		}
+		if len(ids) > 0 {
+			if err := tx.Model(&models.TodoItem{}).
+				Where("id IN ?", ids).
+				Updates(map[string]any{"project_id": projectID, "version": bumpVersion}).Error; err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	for _, s := range u.subtasks {
+		_, n, err := ctl.applyUpdate(tx, &s.item, s.update)
+		if err != nil {
+			return nil, 0, err
+		}
+		created += n
+	}
+	if u.tags != nil {
+		tags, err := resolveTags(tx, *u.tags)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := tx.Model(item).Association("Tags").Replace(tags); err != nil {
+			return nil, 0, err
+		}
+	}
+	// The version is bumped even when only the tags change.
+	u.updates["version"] = bumpVersion
+	query := tx.Model(item).Omit(clause.Associations)
+	if u.version != nil {
+		query = query.Where("version = ?", *u.version)
+	}
+	res := query.Updates(u.updates)
+	if res.Error != nil {
+		return nil, 0, res.Error
+	}
+	if u.version != nil && res.RowsAffected == 0 {
+		return nil, 0, newTodoError(http.StatusPreconditionFailed, errPreconditionFailed)
+	}
+	if u.completes && u.rule != "" {
+		if next, err = ctl.createNextOccurrence(tx, item.ID, u.rule); err != nil {
+			return nil, 0, err
+		}
+		if next != nil {
+			created++
+		}
+	}
+	return next, created, nil
+}
+
 // UpdateTodoItem godoc
 // @Summary Update a todo
-// @Description Update a todo item
+// @Description Update a todo item. Status changes must follow the workflow (see GET /workflow), illegal ones are
+// @Description refused with 409. "is_done" is still accepted: true moves the todo to the workflow's done state and
+// @Description false back to its initial state.
+// @Description Marking a todo with open subtasks as done is refused with 409 unless "cascade" is
+// @Description true, in which case all of its subtasks move to the same status too, following the workflow: if one
+// @Description of them can't, nothing is changed and 409 is returned. Completed recurring subtasks get their next occurrence.
+// @Description Completing an occurrence of a recurring todo creates the next occurrence, with the due date rolled
+// @Description forward according to its "recurrence" rule; its ID is returned as "next_occurrence_id". Moving a top level todo to another
+// @Description project moves its subtasks along with it.
+// @Description With If-Match set to the todo's ETag the update is only applied if nobody changed the todo since,
+// @Description otherwise it is refused with 412. When REQUIRE_IF_MATCH is set, updates without it are refused with 428.
+// @Description Besides plain JSON, where null means "unchanged", the body can be a JSON Merge Patch (RFC 7396,
+// @Description application/merge-patch+json) or a JSON Patch (RFC 6902, application/json-patch+json) of the todo, which
+// @Description can also clear "due_at" and "estimate_hours" and edit "tags" as an array. The patched todo is validated
+// @Description before anything is written; failures are reported per operation with 422, and a failed "test" with 409.
+// @Description A patch that leaves the todo as it is writes nothing and answers the todo with its current ETag.
 // @Tags todos
-// @Accept json
+// @Accept json,application/merge-patch+json,application/json-patch+json
 // @Produce json
 // @Param id path int true "Todo ID"
-// @Param payload body todoctrl.UpdateTodoItem.Payload true "Fields to update"
+// @Param If-Match header string false "ETag of the todo as last read"
+// @Param cascade query bool false "With a patch, also complete the open subtasks of a todo being completed"
+// @Param fields query string false "Comma separated fields to return, e.g. id,title (the id is always returned)"
+// @Param include query string false "Comma separated related resources to embed: project, tags, children"
+// @Param payload body todoctrl.UpdateTodoPayload true "Fields to update"
 // @Success 200 {object} todoctrl.UpdateTodoItem.Response
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Header 200 {string} ETag "New version of the todo"
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} TransitionErrorResponse
+// @Failure 409 {object} OpenSubtasksResponse
+// @Failure 412 {object} problem.Problem
+// @Failure 422 {object} PatchErrorResponse
+// @Failure 428 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [patch]
 func (ctl *Controller) UpdateTodoItem() gin.HandlerFunc {
-	type Payload struct {
-		Title       *string `json:"title"`
-		Description *string `json:"description"`
-		IsDone      *bool   `json:"is_done"`
-	}
-
 	type Response struct {
-		ID          uint   `json:"id"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		IsDone      bool   `json:"is_done"`
+		models.TodoItem
+		NextID *uint `json:"next_occurrence_id,omitempty"`
 	}
 
-	validate := func(c *gin.Context) (*Payload, error) {
-		p := &Payload{}
+	validate := func(c *gin.Context) (*UpdateTodoPayload, error) {
+		p := &UpdateTodoPayload{}
 		if err := c.ShouldBindJSON(p); err != nil {
 			return nil, err
 		}
-
-		if p.Title != nil {
-			t := strings.TrimSpace(*p.Title)
-			if t == "" {
-				return nil, errors.New("\"title\" cannot be empty")
-			}
-		}
-		if p.Description != nil {
-			*p.Description = strings.TrimSpace(*p.Description)
+		if err := validateUpdate(p); err != nil {
+			return nil, err
 		}
-
 		return p, nil
 	}
 
 	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
 		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			problem.Write(c, problem.BadRequest("invalid id"))
 			return
 		}
 
-		payload, err := validate(c)
+		cond, ok := ctl.precondition(c)
+		if !ok {
+			return
+		}
+
+		v, err := parseView(c)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			problem.Write(c, problem.Validation(err))
 			return
 		}
 
-		var item models.TodoItem
-		if err := ctl.db.First(&item, id).Error; err != nil {
-			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+		var payload *UpdateTodoPayload
+		var patch todoPatch
+		if isPatch(c) {
+			patch, err = decodeTodoPatch(c)
+		} else {
+			payload, err = validate(c)
+		}
+		if err != nil {
+			var opErr *jsonpatch.OperationError
+			if errors.As(err, &opErr) {
+				problem.Write(c, operationError(problem.New(http.StatusBadRequest, problem.CodeInvalidPatch, opErr.Error()), opErr))
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			problem.Write(c, problem.Validation(err))
 			return
 		}
 
-		updates := map[string]any{}
-		if payload.Title != nil {
-			updates["title"] = *payload.Title
-		}
-		if payload.Description != nil {
-			updates["description"] = *payload.Description
-		}
-		if payload.IsDone != nil {
-			updates["is_done"] = *payload.IsDone
-		}
+		// The todo is locked while the update is planned, so that the checks
+		// on it and on its subtasks still hold when it is written.
+		var item models.TodoItem
+		var next *models.TodoItem
+		var created int
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+			if patch != nil {
+				query = query.Preload("Tags")
+			}
+			if err := query.First(&item, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return newTodoError(http.StatusNotFound, errors.New("todo not found"))
+				}
+				return err
+			}
+			if cond != nil && !cond.matches(item.Version) {
+				return errPreconditionFailed
+			}
+
+			payload := payload
+			if patch != nil {
+				var err error
+				cascade, _ := strconv.ParseBool(c.Query("cascade"))
+				if payload, err = patchPayload(&item, patch, cascade); err != nil {
+					return err
+				}
+				// A patch that leaves the todo as it is changes nothing.
+				if payload == nil {
+					return nil
+				}
+			}
 
-		if len(updates) == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "no fields to update"})
+			update, err := ctl.planUpdate(tx, &item, payload)
+			if err != nil {
+				return err
+			}
+			if cond != nil && !cond.any {
+				update.version = &item.Version
+			}
+			if next, created, err = ctl.applyUpdate(tx, &item, update); err != nil {
+				return err
+			}
+			return tx.Preload("Tags").First(&item, id).Error
+		})
+		if errors.Is(err, errPreconditionFailed) {
+			preconditionFailed(c, &item)
 			return
 		}
-
-		if err := ctl.db.Model(&item).Updates(updates).Error; err != nil {
-			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		if err != nil {
+			writeTodoError(c, err)
 			return
 		}
+		middleware.TasksCount.Add(float64(created))
 
-		_ = ctl.db.First(&item, id).Error
-
-		res := &Response{
-			ID:          item.ID,
-			Title:       item.Title,
-			Description: item.Description,
-			IsDone:      item.IsDone,
+		res := &Response{TodoItem: item}
+		if next != nil {
+			res.NextID = &next.ID
 		}
-		c.JSON(http.StatusOK, res)
+		setETag(c, &item)
+		ctl.writeTodo(c, http.StatusOK, res, &item, v)
 	}
 }
 
 // DeleteTodoItem godoc
 // @Summary Delete a todo
-// @Description Delete a todo item by ID
+// @Description Delete a todo item by ID. With If-Match set to the todo's ETag it is only deleted if nobody changed it
+// @Description since, otherwise it is refused with 412. When REQUIRE_IF_MATCH is set, deletes without it are refused
+// @Description with 428.
 // @Tags todos
 // @Produce json
 // @Param id  path int true "Todo ID"
+// @Param If-Match header string false "ETag of the todo as last read"
 // @Success 204 {string} string "No Content"
-// @Failure 400 {object} ErrorResponse
-// @Failure 404 {object} ErrorResponse
-// @Failure 500 {object} ErrorResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 428 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /todos/{id} [delete]
 func (ctl *Controller) DeleteTodoItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosDelete) {
+			return
+		}
+
 		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			problem.Write(c, problem.BadRequest("invalid id"))
 			return
 		}
 
-		res := ctl.db.Delete(&models.TodoItem{}, id)
+		cond, ok := ctl.precondition(c)
+		if !ok {
+			return
+		}
+
+		query := ctl.dbFor(c)
+		if cond != nil && !cond.any {
+			var item models.TodoItem
+			if err := ctl.dbFor(c).Select("id", "version").First(&item, id).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					problem.Write(c, problem.NotFound("todo not found"))
+					return
+				}
+				problem.Write(c, problem.FromDB(err))
+				return
+			}
+			if !cond.matches(item.Version) {
+				preconditionFailed(c, &item)
+				return
+			}
+			query = query.Where("version = ?", item.Version)
+		}
+
+		res := query.Delete(&models.TodoItem{}, id)
 		if res.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": res.Error.Error()})
+			problem.Write(c, problem.FromDB(res.Error))
 			return
 		}
 		if res.RowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "todo not found"})
+			if cond != nil && !cond.any {
+				problem.Write(c, problem.New(http.StatusPreconditionFailed, problem.CodePreconditionFailed, errPreconditionFailed.Error()))
+				return
+			}
+			problem.Write(c, problem.NotFound("todo not found"))
 			return
 		}
 
@@ -355,3 +1126,35 @@ func (ctl *Controller) DeleteTodoItem() gin.HandlerFunc {
 		c.Status(http.StatusNoContent)
 	}
 }
+
+func parsePagination(c *gin.Context) (int, int, error) {
+	pageStr := c.Query("page")
+	if pageStr == "" {
+		pageStr = "1"
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil {
+		page = 1
+	}
+
+	pageSizeStr := c.Query("page_size")
+	if pageSizeStr == "" {
+		pageSizeStr = "20"
+	}
+	pageSize, err := strconv.Atoi(pageSizeStr)
+	if err != nil {
+		pageSize = 20
+	}
+
+	if page < 1 {
+		return 0, 0, errors.New("\"page\" must be at least 1")
+	}
+	if pageSize < 1 {
+		return 0, 0, errors.New("\"page_size\" must be at least 1")
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	return page, pageSize, nil
+}
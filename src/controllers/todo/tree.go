@@ -0,0 +1,309 @@
+package todoctrl
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+)
+
+var (
+	errParentNotFound  = errors.New("parent todo not found")
+	errMoveIntoSubtree = errors.New("a todo cannot be moved under itself or one of its subtasks")
+)
+
+type TodoTreeNode struct {
+	ID          uint            `json:"id" example:"3"`
+	Title       string          `json:"title" example:"release v2"`
+	Description string          `json:"description" example:""`
+	Status      string          `json:"status" example:"in_progress"`
+	IsDone      bool            `json:"is_done" example:"false"`
+	ParentID    *uint           `json:"parent_id" example:"1"`
+	Progress    float64         `json:"progress" example:"0.5"`
+	Children    []*TodoTreeNode `json:"children,omitempty"`
+
+	done  int
+	total int
+}
+
+type TodoChildrenResponse struct {
+	Items []*TodoTreeNode `json:"items"`
+}
+
+// OpenSubtasksResponse is the problem of completing a todo whose subtasks are
+// still open.
+type OpenSubtasksResponse struct {
+	problem.Problem
+	OpenSubtasks []uint `json:"open_subtasks" example:"4,7"`
+}
+
+// ListTodoChildren godoc
+// @Summary List subtasks
+// @Description List the direct subtasks of a todo with their progress (done descendants / total descendants)
+// @Tags subtasks
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} TodoChildrenResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/children [get]
+func (ctl *Controller) ListTodoChildren() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		root, err := ctl.loadTree(ctl.dbFor(c), uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		items := make([]*TodoTreeNode, 0, len(root.Children))
+		for _, child := range root.Children {
+			flat := *child
+			flat.Children = nil
+			items = append(items, &flat)
+		}
+
+		c.JSON(http.StatusOK, TodoChildrenResponse{Items: items})
+	}
+}
+
+// GetTodoSubtree godoc
+// @Summary Get a subtree
+// @Description Get a todo with all of its subtasks, nested to any depth, with progress on every node
+// @Tags subtasks
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Success 200 {object} TodoTreeNode
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/subtree [get]
+func (ctl *Controller) GetTodoSubtree() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosRead) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		root, err := ctl.loadTree(ctl.dbFor(c), uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				problem.Write(c, problem.NotFound("todo not found"))
+				return
+			}
+			problem.Write(c, problem.FromDB(err))
+			return
+		}
+
+		c.JSON(http.StatusOK, root)
+	}
+}
+
+// MoveTodoSubtree godoc
+// @Summary Move a subtree
+// @Description Move a todo, together with its subtasks, under a new parent. A null parent_id makes it a top level todo.
+// @Tags subtasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Todo ID"
+// @Param request body todoctrl.MoveTodoSubtree.Payload true "New parent"
+// @Success 200 {object} TodoTreeNode
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} rbac.DeniedResponse
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
+// @Router /todos/{id}/move [post]
+func (ctl *Controller) MoveTodoSubtree() gin.HandlerFunc {
+	type Payload struct {
+		ParentID *uint `json:"parent_id" example:"1"`
+	}
+
+	return func(c *gin.Context) {
+		if !ctl.authorize(c, rbac.TodosUpdate) {
+			return
+		}
+
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			problem.Write(c, problem.BadRequest("invalid id"))
+			return
+		}
+
+		payload := &Payload{}
+		if err := c.ShouldBindJSON(payload); err != nil {
+			problem.Write(c, problem.Validation(err))
+			return
+		}
+
+		var root *TodoTreeNode
+		err = ctl.dbFor(c).Transaction(func(tx *gorm.DB) error {
+			var item models.TodoItem
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&item, id).Error; err != nil {
+				return err
+			}
+
+			if payload.ParentID != nil {
+				var parent models.TodoItem
+				if err := tx.Select("id", "project_id").First(&parent, *payload.ParentID).Error; err != nil {
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return errParentNotFound
+					}
+					return err
+				}
+				if parent.ProjectID != item.ProjectID {
+					return errParentInOtherProject
+				}
+
+				subtree, err := loadSubtree(tx, item.ID)
+				if err != nil {
+					return err
+				}
+				for _, t := range subtree {
+					if t.ID == parent.ID {
+						return errMoveIntoSubtree
+					}
+				}
+			}
+
+			if err := tx.Model(&item).Updates(map[string]any{"parent_id": payload.ParentID, "version": bumpVersion}).Error; err != nil {
+				return err
+			}
+
+			root, err = ctl.loadTree(tx, item.ID)
+			return err
+		})
+
+		switch {
+		case err == nil:
+			c.JSON(http.StatusOK, root)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			problem.Write(c, problem.NotFound("todo not found"))
+		case errors.Is(err, errParentNotFound):
+			problem.Write(c, problem.NotFound(err.Error()))
+		case errors.Is(err, errMoveIntoSubtree), errors.Is(err, errParentInOtherProject):
+			problem.Write(c, problem.New(http.StatusConflict, problem.CodeConflict, err.Error()))
+		default:
+			problem.Write(c, problem.FromDB(err))
+		}
+	}
+}
+
+// loadSubtree returns the todo with the given ID followed by all of its
+// descendants. Raw SQL isn't scoped by the tenant plugin, so the todo is looked
+// up in the workspace of db here; its descendants are always in the same one.
+func loadSubtree(db *gorm.DB, id uint) ([]models.TodoItem, error) {
+	return querySubtree(db, id, "")
+}
+
+// lockSubtree is loadSubtree locking the todos until the end of the
+// transaction.
+func lockSubtree(tx *gorm.DB, id uint) ([]models.TodoItem, error) {
+	return querySubtree(tx, id, " FOR UPDATE OF todo_items")
+}
+
+func querySubtree(db *gorm.DB, id uint, locking string) ([]models.TodoItem, error) {
+	root, args := "id = ?", []any{id}
+	if workspaceID, ok := tenant.ID(db); ok {
+		root, args = "id = ? AND workspace_id = ?", append(args, workspaceID)
+	}
+
+	var items []models.TodoItem
+	err := db.Raw(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM todo_items WHERE `+root+`
+			UNION ALL
+			SELECT t.id FROM todo_items t JOIN subtree s ON t.parent_id = s.id
+		)
+		SELECT todo_items.* FROM todo_items JOIN subtree ON subtree.id = todo_items.id
+		ORDER BY todo_items.id`+locking, args...).
+		Scan(&items).Error
+	return items, err
+}
+
+// loadTree loads the subtree of the given todo and computes progress on every
+// node. It returns gorm.ErrRecordNotFound when the todo doesn't exist.
+func (ctl *Controller) loadTree(db *gorm.DB, id uint) (*TodoTreeNode, error) {
+	items, err := loadSubtree(db, id)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[uint]*TodoTreeNode, len(items))
+	for _, item := range items {
+		nodes[item.ID] = &TodoTreeNode{
+			ID:          item.ID,
+			Title:       item.Title,
+			Description: item.Description,
+			Status:      item.Status,
+			IsDone:      item.IsDone,
+			ParentID:    item.ParentID,
+		}
+	}
+
+	root, ok := nodes[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	for _, item := range items {
+		if item.ID == id || item.ParentID == nil {
+			continue
+		}
+		if parent, ok := nodes[*item.ParentID]; ok {
+			parent.Children = append(parent.Children, nodes[item.ID])
+		}
+	}
+
+	root.rollUp()
+	return root, nil
+}
+
+// rollUp counts done and total descendants bottom-up and fills in Progress.
+// A todo without subtasks is either 0 or 1 done.
+func (n *TodoTreeNode) rollUp() {
+	n.done, n.total = 0, 0
+	for _, child := range n.Children {
+		child.rollUp()
+		n.total += child.total + 1
+		n.done += child.done
+		if child.IsDone {
+			n.done++
+		}
+	}
+
+	switch {
+	case n.total > 0:
+		n.Progress = float64(n.done) / float64(n.total)
+	case n.IsDone:
+		n.Progress = 1
+	default:
+		n.Progress = 0
+	}
+}
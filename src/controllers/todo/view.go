@@ -0,0 +1,203 @@
+package todoctrl
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/alirezamastery/graph_task/jsonpatch"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	includeProject  = "project"
+	includeTags     = "tags"
+	includeChildren = "children"
+)
+
+// todoFields are the fields a todo can be projected on with the fields
+// param. The last ones only exist in some responses.
+var todoFields = []string{
+	"id", "project_id", "title", "description", "status", "is_done", "estimate_hours", "priority", "due_at",
+	"recurrence", "series_id", "tags", "parent_id", "created_at", "updated_at", "version", "owner_id",
+	"progress", "is_blocked", "blocked_by", "next_occurrence_id",
+}
+
+var includes = []string{includeProject, includeTags, includeChildren}
+
+// view is the shape of the todos in a response, as asked for with the fields
+// and include params. Without fields a todo has all of its fields, tags
+// included; with it only those listed, and the id. Included resources are
+// added in both cases.
+type view struct {
+	fields  []string
+	include []string
+}
+
+// parseView reads the fields and include params of a request.
+func parseView(c *gin.Context) (*view, error) {
+	v := &view{}
+	if fieldsStr, ok := c.GetQuery("fields"); ok {
+		v.fields = []string{"id"}
+		for _, field := range strings.Split(fieldsStr, ",") {
+			field = strings.TrimSpace(field)
+			if !slices.Contains(todoFields, field) {
+				return nil, fmt.Errorf("invalid \"fields\" query param: unknown field %q", field)
+			}
+			v.fields = append(v.fields, field)
+		}
+	}
+	if includeStr := c.Query("include"); includeStr != "" {
+		for _, include := range strings.Split(includeStr, ",") {
+			include = strings.TrimSpace(include)
+			if !slices.Contains(includes, include) {
+				return nil, fmt.Errorf("invalid \"include\" query param: unknown resource %q", include)
+			}
+			v.include = append(v.include, include)
+		}
+	}
+	return v, nil
+}
+
+// plain tells whether the todos keep their usual shape.
+func (v *view) plain() bool {
+	return v.fields == nil && len(v.include) == 0
+}
+
+func (v *view) includes(resource string) bool {
+	return slices.Contains(v.include, resource)
+}
+
+// keeps tells whether a field stays in the todos.
+func (v *view) keeps(field string) bool {
+	return v.fields == nil || slices.Contains(v.fields, field) || (field == includeTags && v.includes(includeTags))
+}
+
+// writeTodo answers with a response that is a todo.
+func (ctl *Controller) writeTodo(c *gin.Context, status int, body any, item *models.TodoItem, v *view) {
+	if v.plain() {
+		c.JSON(status, body)
+		return
+	}
+
+	doc, err := toDocument(body)
+	if err == nil {
+		err = ctl.shape(ctl.dbFor(c), v, []map[string]any{doc}, []models.TodoItem{*item})
+	}
+	if err != nil {
+		problem.Write(c, problem.FromDB(err))
+		return
+	}
+	c.JSON(status, doc)
+}
+
+// writeTodoList answers with a page of todos.
+func (ctl *Controller) writeTodoList(c *gin.Context, resp *TodoListResponse, v *view) {
+	if v.plain() {
+		c.JSON(http.StatusOK, resp)
+		return
+	}
+
+	body, err := toDocument(resp)
+	if err == nil {
+		items, _ := body["items"].([]any)
+		docs := make([]map[string]any, len(items))
+		for i, item := range items {
+			docs[i], _ = item.(map[string]any)
+		}
+		err = ctl.shape(ctl.dbFor(c), v, docs, resp.Items)
+	}
+	if err != nil {
+		problem.Write(c, problem.FromDB(err))
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+// toDocument turns a response into a JSON object that can be reshaped.
+func toDocument(body any) (map[string]any, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonpatch.Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.(map[string]any), nil
+}
+
+// shape projects the documents of todos on the fields of the view and embeds
+// the included resources. docs and items are aligned.
+func (ctl *Controller) shape(db *gorm.DB, v *view, docs []map[string]any, items []models.TodoItem) error {
+	for _, doc := range docs {
+		for field := range doc {
+			if !v.keeps(field) {
+				delete(doc, field)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	if v.includes(includeProject) {
+		ids := make([]uint, 0, len(items))
+		for _, item := range items {
+			if !slices.Contains(ids, item.ProjectID) {
+				ids = append(ids, item.ProjectID)
+			}
+		}
+		var projects []models.Project
+		if err := db.Where("id IN ?", ids).Find(&projects).Error; err != nil {
+			return err
+		}
+		for i, item := range items {
+			for _, project := range projects {
+				if project.ID == item.ProjectID {
+					docs[i][includeProject] = project
+				}
+			}
+		}
+	}
+
+	if v.includes(includeChildren) {
+		ids := make([]uint, len(items))
+		for i, item := range items {
+			ids[i] = item.ID
+		}
+		var children []models.TodoItem
+		if err := db.Preload("Tags").Where("parent_id IN ?", ids).Order("id").Find(&children).Error; err != nil {
+			return err
+		}
+		// Children are shaped like their parents, without includes of
+		// their own.
+		childView := &view{fields: v.fields}
+		if v.includes(includeTags) {
+			childView.include = []string{includeTags}
+		}
+		for i, item := range items {
+			embedded := []map[string]any{}
+			for _, child := range children {
+				if child.ParentID == nil || *child.ParentID != item.ID {
+					continue
+				}
+				doc, err := toDocument(child)
+				if err != nil {
+					return err
+				}
+				embedded = append(embedded, doc)
+			}
+			if err := ctl.shape(db, childView, embedded, nil); err != nil {
+				return err
+			}
+			docs[i][includeChildren] = embedded
+		}
+	}
+
+	return nil
+}
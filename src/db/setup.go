@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"github.com/alirezamastery/graph_task/middleware"
 	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/search"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/alirezamastery/graph_task/workflow"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
@@ -30,6 +33,12 @@ func SetupDB() *gorm.DB {
 		log.Println("Connected to Database")
 	}
 
+	// Every query run with the context of a request is scoped to the
+	// workspace of its user.
+	if err := db.Use(tenant.Plugin{}); err != nil {
+		log.Fatalln("error in registering the tenant plugin:", err)
+	}
+
 	sqlDB, err := db.DB()
 	sqlDB.SetMaxIdleConns(10)
 	sqlDB.SetMaxOpenConns(100)
@@ -37,16 +46,158 @@ func SetupDB() *gorm.DB {
 	return db
 }
 
-func MigrateDB(db *gorm.DB) {
-	err := db.Debug().AutoMigrate(
-		&models.TodoItem{},
-	)
+func MigrateDB(db *gorm.DB, wf *workflow.Workflow) {
+	err := db.Debug().AutoMigrate(&models.Workspace{})
+	if err == nil {
+		err = migrateWorkspaces(db.Debug())
+	}
+	if err == nil {
+		err = db.Debug().AutoMigrate(
+			&models.Project{},
+			&models.Tag{},
+			&models.IdempotencyKey{},
+			&models.User{},
+			&models.RefreshToken{},
+			&models.APIKey{},
+		)
+	}
+	if err == nil {
+		err = migrateDefaultProject(db.Debug())
+	}
+	if err == nil {
+		err = migrateFirstAdmin(db.Debug())
+	}
+	if err == nil {
+		backfillStatus := db.Migrator().HasTable(&models.TodoItem{}) &&
+			!db.Migrator().HasColumn(&models.TodoItem{}, "Status")
+
+		err = db.Debug().AutoMigrate(
+			&models.TodoItem{},
+			&models.TodoDependency{},
+			&models.Reminder{},
+		)
+
+		// Todos created before statuses were introduced get the workflow's
+		// initial or done state, depending on is_done.
+		if err == nil && backfillStatus {
+			err = db.Debug().
+				Exec("UPDATE todo_items SET status = CASE WHEN is_done THEN ? ELSE ? END", wf.DoneState, wf.Initial).
+				Error
+		}
+
+		// The full-text search column and its GIN index only exist on
+		// Postgres, other backends use the search package's fallback.
+		if err == nil && db.Dialector.Name() == "postgres" {
+			err = db.Debug().Exec(search.VectorColumnSQL).Error
+			if err == nil {
+				err = db.Debug().Exec(search.IndexSQL).Error
+			}
+		}
+	}
 
 	if err != nil {
 		log.Fatalln(fmt.Errorf("error migrating users: %v", err))
 	}
 }
 
+// tenantTables are the tables whose rows belong to a workspace.
+var tenantTables = []string{"users", "projects", "tags", "todo_items", "todo_dependencies", "reminders"}
+
+// migrateWorkspaces moves the data created before workspaces were introduced
+// into a workspace of its own, shared by the existing users. Names and titles
+// were unique across the deployment, the old constraints are dropped so that
+// AutoMigrate can create the ones per workspace.
+func migrateWorkspaces(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		m := tx.Migrator()
+		var legacy []string
+		for _, table := range tenantTables {
+			if m.HasTable(table) && !m.HasColumn(table, tenant.Column) {
+				legacy = append(legacy, table)
+			}
+		}
+		if len(legacy) == 0 {
+			return nil
+		}
+
+		workspace := models.Workspace{Name: "Default"}
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		for _, table := range legacy {
+			if err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN workspace_id bigint").Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE "+table+" SET workspace_id = ?", workspace.ID).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("ALTER TABLE " + table + " ALTER COLUMN workspace_id SET NOT NULL").Error; err != nil {
+				return err
+			}
+		}
+
+		for _, stmt := range []string{
+			"ALTER TABLE IF EXISTS projects DROP CONSTRAINT IF EXISTS uni_projects_name",
+			"ALTER TABLE IF EXISTS projects DROP CONSTRAINT IF EXISTS projects_name_key",
+			"ALTER TABLE IF EXISTS tags DROP CONSTRAINT IF EXISTS uni_tags_name",
+			"ALTER TABLE IF EXISTS tags DROP CONSTRAINT IF EXISTS tags_name_key",
+			"DROP INDEX IF EXISTS idx_todo_items_project_title",
+		} {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrateDefaultProject makes sure every workspace has a default project and
+// moves the todos created before projects were introduced into the one of
+// their workspace. The old global unique constraint on title is dropped by
+// AutoMigrate afterward.
+func migrateDefaultProject(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+			INSERT INTO projects (workspace_id, name, description, is_default, created_at, updated_at)
+			SELECT w.id, ?, '', true, now(), now() FROM workspaces w
+			WHERE NOT EXISTS (SELECT 1 FROM projects p WHERE p.workspace_id = w.id AND p.is_default)`,
+			models.DefaultProjectName,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		m := tx.Migrator()
+		if !m.HasTable(&models.TodoItem{}) || m.HasColumn(&models.TodoItem{}, "ProjectID") {
+			return nil
+		}
+
+		if err := tx.Exec("ALTER TABLE todo_items ADD COLUMN project_id bigint").Error; err != nil {
+			return err
+		}
+		err = tx.Exec(`
+			UPDATE todo_items t SET project_id = p.id FROM projects p
+			WHERE p.workspace_id = t.workspace_id AND p.is_default`,
+		).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Exec("ALTER TABLE todo_items ALTER COLUMN project_id SET NOT NULL").Error; err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// migrateFirstAdmin makes the oldest user of every workspace without an admin
+// one, as the users created before roles were introduced are all editors.
+func migrateFirstAdmin(db *gorm.DB) error {
+	return db.Exec(
+		"UPDATE users SET role = ? WHERE id IN (SELECT min(id) FROM users GROUP BY workspace_id HAVING NOT bool_or(role = ?))",
+		models.RoleAdmin, models.RoleAdmin,
+	).Error
+}
+
 func InitTasksCount(db *gorm.DB) {
 	var n int64
 	_ = db.Model(&models.TodoItem{}).Count(&n).Error
@@ -0,0 +1,189 @@
+package graph
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatGraphML = "graphml"
+)
+
+const (
+	EdgeBlocks  = "blocks"
+	EdgeSubtask = "subtask"
+)
+
+type Node struct {
+	ID    uint
+	Title string
+	Done  bool
+}
+
+type Edge struct {
+	From uint
+	To   uint
+	Kind string
+}
+
+// Document is a snapshot of todos and their relationships ready to be
+// serialized.
+type Document struct {
+	Nodes []Node
+	Edges []Edge
+}
+
+func Write(w io.Writer, format string, doc Document) error {
+	switch format {
+	case FormatDOT:
+		return WriteDOT(w, doc)
+	case FormatMermaid:
+		return WriteMermaid(w, doc)
+	case FormatGraphML:
+		return WriteGraphML(w, doc)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func WriteDOT(w io.Writer, doc Document) error {
+	var b strings.Builder
+
+	b.WriteString("digraph todos {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box, style=\"rounded,filled\", fillcolor=\"#ffffff\"];\n")
+	for _, n := range doc.Nodes {
+		fmt.Fprintf(&b, "  t%d [label=%s", n.ID, dotQuote(n.Title))
+		if n.Done {
+			b.WriteString(", fillcolor=\"#d4edda\", fontcolor=\"#6c757d\"")
+		}
+		b.WriteString("];\n")
+	}
+	for _, e := range doc.Edges {
+		fmt.Fprintf(&b, "  t%d -> t%d [label=%s", e.From, e.To, dotQuote(e.Kind))
+		if e.Kind == EdgeSubtask {
+			b.WriteString(", style=dashed, arrowhead=none")
+		}
+		b.WriteString("];\n")
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func WriteMermaid(w io.Writer, doc Document) error {
+	var b strings.Builder
+
+	b.WriteString("flowchart LR\n")
+	b.WriteString("  classDef done fill:#d4edda,color:#6c757d\n")
+	for _, n := range doc.Nodes {
+		fmt.Fprintf(&b, "  t%d[\"%s\"]\n", n.ID, mermaidEscape(n.Title))
+		if n.Done {
+			fmt.Fprintf(&b, "  class t%d done\n", n.ID)
+		}
+	}
+	for _, e := range doc.Edges {
+		arrow := "-->"
+		if e.Kind == EdgeSubtask {
+			arrow = "-.-"
+		}
+		fmt.Fprintf(&b, "  t%d %s|%s| t%d\n", e.From, arrow, mermaidEscape(e.Kind), e.To)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+func WriteGraphML(w io.Writer, doc Document) error {
+	out := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "title", For: "node", AttrName: "title", AttrType: "string"},
+			{ID: "done", For: "node", AttrName: "done", AttrType: "boolean"},
+			{ID: "kind", For: "edge", AttrName: "kind", AttrType: "string"},
+		},
+		Graph: graphMLGraph{ID: "todos", EdgeDefault: "directed"},
+	}
+
+	for _, n := range doc.Nodes {
+		out.Graph.Nodes = append(out.Graph.Nodes, graphMLNode{
+			ID: fmt.Sprintf("t%d", n.ID),
+			Data: []graphMLData{
+				{Key: "title", Value: n.Title},
+				{Key: "done", Value: fmt.Sprintf("%t", n.Done)},
+			},
+		})
+	}
+	for _, e := range doc.Edges {
+		out.Graph.Edges = append(out.Graph.Edges, graphMLEdge{
+			Source: fmt.Sprintf("t%d", e.From),
+			Target: fmt.Sprintf("t%d", e.To),
+			Data:   []graphMLData{{Key: "kind", Value: e.Kind}},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
+
+// mermaidEscape replaces the characters that would end a quoted Mermaid label
+// with their entity codes.
+func mermaidEscape(s string) string {
+	r := strings.NewReplacer(`"`, "#quot;", "|", "#124;", "<", "#lt;", ">", "#gt;", "\n", " ", "\r", "")
+	return r.Replace(s)
+}
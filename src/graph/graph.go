@@ -0,0 +1,110 @@
+package graph
+
+import "sort"
+
+// Graph is a directed graph over todo IDs. An edge from -> to means "from"
+// has to be finished before "to" can start.
+type Graph struct {
+	nodes map[uint]struct{}
+	out   map[uint][]uint
+	in    map[uint][]uint
+}
+
+func New() *Graph {
+	return &Graph{
+		nodes: map[uint]struct{}{},
+		out:   map[uint][]uint{},
+		in:    map[uint][]uint{},
+	}
+}
+
+func (g *Graph) AddNode(id uint) {
+	g.nodes[id] = struct{}{}
+}
+
+func (g *Graph) AddEdge(from, to uint) {
+	g.AddNode(from)
+	g.AddNode(to)
+	g.out[from] = append(g.out[from], to)
+	g.in[to] = append(g.in[to], from)
+}
+
+func (g *Graph) HasNode(id uint) bool {
+	_, ok := g.nodes[id]
+	return ok
+}
+
+// Nodes returns every node ID in ascending order.
+func (g *Graph) Nodes() []uint {
+	ids := make([]uint, 0, len(g.nodes))
+	for id := range g.nodes {
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	return ids
+}
+
+func (g *Graph) Successors(id uint) []uint {
+	return g.out[id]
+}
+
+func (g *Graph) Predecessors(id uint) []uint {
+	return g.in[id]
+}
+
+// Path returns the nodes of a path from "from" to "to" (both included), or nil
+// when "to" is not reachable. Neighbours are visited in ascending order so the
+// result is stable.
+func (g *Graph) Path(from, to uint) []uint {
+	if !g.HasNode(from) || !g.HasNode(to) {
+		return nil
+	}
+
+	prev := map[uint]uint{}
+	visited := map[uint]bool{from: true}
+	queue := []uint{from}
+
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+
+		if cur == to {
+			path := []uint{to}
+			for path[0] != from {
+				path = append([]uint{prev[path[0]]}, path...)
+			}
+			return path
+		}
+
+		next := append([]uint(nil), g.out[cur]...)
+		sortIDs(next)
+		for _, n := range next {
+			if visited[n] {
+				continue
+			}
+			visited[n] = true
+			prev[n] = cur
+			queue = append(queue, n)
+		}
+	}
+
+	return nil
+}
+
+// CycleWith reports the cycle that adding the edge from -> to would close, as
+// the list of nodes starting and ending with "from". It returns nil when the
+// edge is safe to add.
+func (g *Graph) CycleWith(from, to uint) []uint {
+	if from == to {
+		return []uint{from, to}
+	}
+	path := g.Path(to, from)
+	if path == nil {
+		return nil
+	}
+	return append([]uint{from}, path...)
+}
+
+func sortIDs(ids []uint) {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+}
@@ -0,0 +1,151 @@
+package graph
+
+import (
+	"container/heap"
+	"errors"
+)
+
+var ErrCycle = errors.New("graph contains a cycle")
+
+// Subgraph returns the graph induced by the given nodes. Unknown IDs are
+// ignored.
+func (g *Graph) Subgraph(ids []uint) *Graph {
+	keep := map[uint]bool{}
+	for _, id := range ids {
+		if g.HasNode(id) {
+			keep[id] = true
+		}
+	}
+
+	sub := New()
+	for id := range keep {
+		sub.AddNode(id)
+		for _, next := range g.out[id] {
+			if keep[next] {
+				sub.AddEdge(id, next)
+			}
+		}
+	}
+	return sub
+}
+
+// Ancestors returns id together with every node that has a path to it, in
+// ascending order.
+func (g *Graph) Ancestors(id uint) []uint {
+	if !g.HasNode(id) {
+		return nil
+	}
+
+	seen := map[uint]bool{id: true}
+	stack := []uint{id}
+	for len(stack) > 0 {
+		cur := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, prev := range g.in[cur] {
+			if !seen[prev] {
+				seen[prev] = true
+				stack = append(stack, prev)
+			}
+		}
+	}
+
+	ids := make([]uint, 0, len(seen))
+	for n := range seen {
+		ids = append(ids, n)
+	}
+	sortIDs(ids)
+	return ids
+}
+
+// TopologicalSort orders the nodes so that every edge points forward. When
+// several nodes are ready at once the smallest ID goes first, so the order is
+// deterministic.
+func (g *Graph) TopologicalSort() ([]uint, error) {
+	indegree := make(map[uint]int, len(g.nodes))
+	ready := &idHeap{}
+	for id := range g.nodes {
+		indegree[id] = len(g.in[id])
+		if indegree[id] == 0 {
+			heap.Push(ready, id)
+		}
+	}
+
+	order := make([]uint, 0, len(g.nodes))
+	for ready.Len() > 0 {
+		cur := heap.Pop(ready).(uint)
+		order = append(order, cur)
+		for _, next := range g.out[cur] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				heap.Push(ready, next)
+			}
+		}
+	}
+
+	if len(order) != len(g.nodes) {
+		return nil, ErrCycle
+	}
+	return order, nil
+}
+
+// CriticalPath returns the path with the largest total weight, where each node
+// weighs weight(id), together with that total.
+func (g *Graph) CriticalPath(weight func(id uint) float64) ([]uint, float64, error) {
+	order, err := g.TopologicalSort()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	dist := make(map[uint]float64, len(order))
+	prev := make(map[uint]uint, len(order))
+	var (
+		end   uint
+		best  float64
+		found bool
+	)
+
+	for _, id := range order {
+		// Predecessors come earlier in the topological order, so their
+		// distances are final by now.
+		d, hasPrev := 0.0, false
+		for _, p := range g.in[id] {
+			if !hasPrev || dist[p] > d || (dist[p] == d && p < prev[id]) {
+				d, hasPrev = dist[p], true
+				prev[id] = p
+			}
+		}
+		dist[id] = d + weight(id)
+
+		if !found || dist[id] > best {
+			end, best, found = id, dist[id], true
+		}
+	}
+
+	if !found {
+		return []uint{}, 0, nil
+	}
+
+	path := []uint{end}
+	for {
+		p, ok := prev[path[0]]
+		if !ok {
+			break
+		}
+		path = append([]uint{p}, path...)
+	}
+	return path, best, nil
+}
+
+type idHeap []uint
+
+func (h idHeap) Len() int           { return len(h) }
+func (h idHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h idHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *idHeap) Push(x any)        { *h = append(*h, x.(uint)) }
+func (h *idHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
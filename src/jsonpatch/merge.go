@@ -0,0 +1,116 @@
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+)
+
+// Decode parses a JSON document, keeping numbers as json.Number so that they
+// survive a round trip unchanged.
+func Decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, &json.SyntaxError{Offset: dec.InputOffset()}
+	}
+	return v, nil
+}
+
+// MergePatch applies a JSON Merge Patch (RFC 7396) to a decoded document.
+// Members set to null in the patch are removed, objects are merged
+// recursively, and any other value replaces the target. The target may be
+// modified in place.
+func MergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = MergePatch(t[name], value)
+	}
+	return t
+}
+
+// Equal compares two decoded documents. Numbers are equal when their values
+// are, regardless of how they are written.
+func Equal(a, b any) bool {
+	switch a := a.(type) {
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !Equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !Equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number, float64:
+		x, ok := number(a)
+		if !ok {
+			return false
+		}
+		y, ok := number(b)
+		return ok && x.Cmp(y) == 0
+	default:
+		return a == b
+	}
+}
+
+func number(v any) (*big.Float, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, _, err := big.ParseFloat(string(v), 10, 256, big.ToNearestEven)
+		return f, err == nil
+	case float64:
+		return big.NewFloat(v), true
+	}
+	return nil, false
+}
+
+// clone deep copies a decoded document.
+func clone(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for name, value := range v {
+			c[name] = clone(value)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, value := range v {
+			c[i] = clone(value)
+		}
+		return c
+	default:
+		return v
+	}
+}
@@ -0,0 +1,305 @@
+// Package jsonpatch implements JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396) on documents decoded into maps and slices.
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPointer = errors.New("invalid JSON pointer")
+	ErrPathNotFound   = errors.New("path does not exist")
+	ErrTestFailed     = errors.New("value does not match")
+)
+
+// Operation is one operation of a JSON Patch. Value is nil when the operation
+// has none, and the JSON literal null when it is null.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is a JSON Patch document: operations applied in order.
+type Patch []Operation
+
+// OperationError is the failure of one operation of a patch.
+type OperationError struct {
+	Index int
+	Op    Operation
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %d (%s %s): %v", e.Index, e.Op.Op, e.Op.Path, e.Err)
+}
+
+func (e *OperationError) Unwrap() error {
+	return e.Err
+}
+
+// DecodePatch parses a JSON Patch document and checks that every operation is
+// well formed. Failures are *OperationError, except for invalid JSON.
+func DecodePatch(data []byte) (Patch, error) {
+	var p Patch
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		if err := op.check(); err != nil {
+			return nil, &OperationError{Index: i, Op: op, Err: err}
+		}
+	}
+	return p, nil
+}
+
+func (op Operation) check() error {
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%q needs a value", op.Op)
+		}
+	case "move", "copy":
+		if _, err := parsePointer(op.From); err != nil {
+			return fmt.Errorf("invalid \"from\": %w", err)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown operation %q", op.Op)
+	}
+	if _, err := parsePointer(op.Path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Apply applies the patch to a decoded document and returns the result. The
+// document may be modified in place, even when an operation fails. Failures
+// are *OperationError.
+func (p Patch) Apply(doc any) (any, error) {
+	for i, op := range p {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return nil, &OperationError{Index: i, Op: op, Err: err}
+		}
+	}
+	return doc, nil
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	if err := op.check(); err != nil {
+		return nil, err
+	}
+	path, _ := parsePointer(op.Path)
+
+	switch op.Op {
+	case "add":
+		value, err := Decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "remove":
+		doc, _, err := remove(doc, path)
+		return doc, err
+	case "replace":
+		value, err := Decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = remove(doc, path); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move":
+		from, _ := parsePointer(op.From)
+		if len(from) < len(path) && isPrefix(from, path) {
+			return nil, errors.New("cannot move a value into one of its children")
+		}
+		doc, value, err := remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		from, _ := parsePointer(op.From)
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, clone(value))
+	default: // test
+		expected, err := Decode(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !Equal(value, expected) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped tokens.
+// The empty pointer is the whole document.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w %q, it must start with \"/\"", ErrInvalidPointer, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// Tokens returns the unescaped tokens of a JSON pointer, nil when it is
+// invalid or the whole document.
+func Tokens(pointer string) []string {
+	tokens, _ := parsePointer(pointer)
+	return tokens
+}
+
+func isPrefix(prefix, path []string) bool {
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// arrayIndex parses an array index token. With appending, "-" and the length
+// of the array are accepted too, to address the end.
+func arrayIndex(token string, length int, appending bool) (int, error) {
+	if appending && token == "-" {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > length || (i == length && !appending) {
+		return 0, fmt.Errorf("%w: index %d is out of range", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch c := doc.(type) {
+		case map[string]any:
+			value, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrPathNotFound, token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%w: %q is not in an object or array", ErrPathNotFound, token)
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, last := path[0], len(path) == 1
+
+	switch c := doc.(type) {
+	case map[string]any:
+		if last {
+			c[token] = value
+			return c, nil
+		}
+		child, ok := c[token]
+		if !ok {
+			return nil, fmt.Errorf("%w: no member %q", ErrPathNotFound, token)
+		}
+		child, err := add(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		c[token] = child
+		return c, nil
+	case []any:
+		i, err := arrayIndex(token, len(c), last)
+		if err != nil {
+			return nil, err
+		}
+		if last {
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		if c[i], err = add(c[i], path[1:], value); err != nil {
+			return nil, err
+		}
+		return c, nil
+	default:
+		return nil, fmt.Errorf("%w: %q is not in an object or array", ErrPathNotFound, token)
+	}
+}
+
+// remove removes the value at path and returns the document and that value.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	token, last := path[0], len(path) == 1
+
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("%w: no member %q", ErrPathNotFound, token)
+		}
+		if last {
+			delete(c, token)
+			return c, child, nil
+		}
+		child, removed, err := remove(child, path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		c[token] = child
+		return c, removed, nil
+	case []any:
+		i, err := arrayIndex(token, len(c), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if last {
+			removed := c[i]
+			return append(c[:i], c[i+1:]...), removed, nil
+		}
+		child, removed, err := remove(c[i], path[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		c[i] = child
+		return c, removed, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %q is not in an object or array", ErrPathNotFound, token)
+	}
+}
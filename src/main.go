@@ -3,15 +3,29 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/alirezamastery/graph_task/auth"
 	"github.com/alirezamastery/graph_task/db"
 	_ "github.com/alirezamastery/graph_task/docs"
 	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/reminder"
 	"github.com/alirezamastery/graph_task/routes"
 	"github.com/alirezamastery/graph_task/utils"
+	"github.com/alirezamastery/graph_task/workflow"
 	"log"
 	"os"
+	"time"
 )
 
+// @security BearerAuth
+// @security ApiKeyAuth
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description An access token from /auth/login, or of the OpenID Connect provider, as "Bearer <token>"
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description An API key from /auth/keys
 func main() {
 	docker := os.Getenv("DOCKER")
 	if docker == "" {
@@ -29,9 +43,24 @@ func main() {
 	dbConn := db.SetupDB()
 	db.InitTasksCount(dbConn)
 
-	db.MigrateDB(dbConn)
+	wf, err := workflow.FromEnv()
+	if err != nil {
+		log.Fatalln("error in loading workflow config:", err)
+	}
+
+	verifier, issuer, err := auth.VerifierFromEnv(dbConn)
+	if err != nil {
+		log.Fatalln("error in loading auth config:", err)
+	}
+
+	db.MigrateDB(dbConn, wf)
+
+	router := routes.SetupRoutes(dbConn, wf, verifier, issuer)
 
-	router := routes.SetupRoutes(dbConn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reminder.NewWorker(dbConn, reminder.NotifierFromEnv()).Run(ctx)
+	go middleware.PurgeIdempotencyKeys(ctx, dbConn, time.Hour)
 
 	apiPort := fmt.Sprintf("0.0.0.0:%s", os.Getenv("API_PORT"))
 
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"errors"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/tenant"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// publicPaths can be reached without an access token. Paths ending with a
+// slash match everything under them.
+var publicPaths = []string{
+	"/api/auth/register",
+	"/api/auth/login",
+	"/api/auth/refresh",
+	"/api/auth/logout",
+	"/swagger/",
+	"/metrics",
+}
+
+// apiKeyUseInterval is how often the last use of an API key is recorded.
+const apiKeyUseInterval = time.Minute
+
+var (
+	errUnknownAPIKey = errors.New("the API key is invalid or revoked")
+	errExpiredAPIKey = errors.New("the API key has expired")
+)
+
+// Authentication requires credentials on every request but the public ones:
+// a bearer token, sent as "Authorization: Bearer <token>" and checked by the
+// verifier, or an API key, sent in the X-API-Key header. It records the user
+// they belong to, with their role, and the scopes they carry; bearer tokens
+// carry all scopes. The request is scoped to the workspace of the user.
+func Authentication(verifier auth.Verifier, db *gorm.DB) gin.HandlerFunc {
+	db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	return func(c *gin.Context) {
+		if isPublic(c.Request.URL.Path) {
+			c.Next()
+			return
+		}
+
+		if key := c.GetHeader(auth.APIKeyHeader); key != "" {
+			apiKey, err := verifyAPIKey(db, key)
+			if err != nil {
+				if errors.Is(err, errUnknownAPIKey) || errors.Is(err, errExpiredAPIKey) {
+					problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, err.Error()))
+					return
+				}
+				problem.Abort(c, problem.FromDB(err))
+				return
+			}
+			if authenticate(c, db, apiKey.UserID, apiKey.ScopeList()) {
+				c.Next()
+			}
+			return
+		}
+
+		scheme, token, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			c.Header("WWW-Authenticate", `Bearer realm="graph-task"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, "an access token or API key is required"))
+			return
+		}
+
+		userID, err := verifier.UserFromToken(c.Request.Context(), strings.TrimSpace(token))
+		switch {
+		case err == nil:
+		case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrExpiredToken):
+			detail := "the access token is invalid"
+			if errors.Is(err, auth.ErrExpiredToken) {
+				detail = "the access token has expired"
+			}
+			c.Header("WWW-Authenticate", `Bearer realm="graph-task", error="invalid_token"`)
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, detail))
+			return
+		case errors.Is(err, auth.ErrEmailTaken):
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeEmailConflict, err.Error()))
+			return
+		default:
+			problem.Abort(c, problem.FromDB(err))
+			return
+		}
+
+		if authenticate(c, db, userID, auth.AllScopes) {
+			c.Next()
+		}
+	}
+}
+
+// authenticate records the user of a request, their role and the scopes of
+// their credentials, and scopes the request to their workspace.
+func authenticate(c *gin.Context, db *gorm.DB, userID uint, scopes []string) bool {
+	var user models.User
+	err := db.WithContext(c.Request.Context()).Select("id", "role", "workspace_id").First(&user, userID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			problem.Abort(c, problem.New(http.StatusUnauthorized, problem.CodeInvalidToken, "the user no longer exists"))
+			return false
+		}
+		problem.Abort(c, problem.FromDB(err))
+		return false
+	}
+
+	auth.SetUserID(c, user.ID)
+	auth.SetRole(c, user.Role)
+	auth.SetScopes(c, scopes)
+	c.Request = c.Request.WithContext(tenant.WithWorkspace(c.Request.Context(), user.WorkspaceID))
+	return true
+}
+
+// RequireScope refuses requests whose credentials don't carry the scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.HasScope(c, scope) {
+			c.Header("WWW-Authenticate", `Bearer realm="graph-task", error="insufficient_scope", scope="`+scope+`"`)
+			problem.Abort(c, problem.New(http.StatusForbidden, problem.CodeInsufficientScope,
+				"the credentials lack the "+scope+" scope"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// verifyAPIKey looks up a live API key and records its use, at most once per
+// apiKeyUseInterval.
+func verifyAPIKey(db *gorm.DB, key string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	err := db.Where("key_hash = ? AND revoked_at IS NULL", auth.HashAPIKey(key)).First(&apiKey).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errUnknownAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && !now.Before(*apiKey.ExpiresAt) {
+		return nil, errExpiredAPIKey
+	}
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyUseInterval {
+		if err := db.Model(&apiKey).Update("last_used_at", now).Error; err != nil {
+			log.Println("error recording API key use:", err)
+		}
+	}
+	return &apiKey, nil
+}
+
+func isPublic(path string) bool {
+	for _, public := range publicPaths {
+		if path == public || (strings.HasSuffix(public, "/") && strings.HasPrefix(path, public)) {
+			return true
+		}
+	}
+	return false
+}
@@ -20,7 +20,11 @@ func CorsMiddleware(engine *gin.Engine) {
 		"origin",
 		"Cache-Control",
 		"X-Requested-With",
+		"If-Match",
+		"Idempotency-Key",
+		"X-API-Key",
 	}
+	config.ExposeHeaders = []string{"ETag", "Idempotent-Replayed", "WWW-Authenticate"}
 
 	engine.Use(cors.New(config))
 }
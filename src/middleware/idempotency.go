@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+
+	// IdempotencyTTLEnv names the environment variable holding how long keys
+	// are kept, as a Go duration (e.g. "12h").
+	IdempotencyTTLEnv     = "IDEMPOTENCY_TTL"
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	// idempotencyLockTimeout is how long a key stays locked by a request
+	// that never finished, e.g. because the process died.
+	idempotencyLockTimeout = time.Minute
+
+	maxIdempotencyKeyLength = 255
+)
+
+// replayedHeaders are the response headers stored along with the body.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyTTLFromEnv reads IDEMPOTENCY_TTL, falling back to the default
+// when it is unset or invalid.
+func IdempotencyTTLFromEnv() time.Duration {
+	value := os.Getenv(IdempotencyTTLEnv)
+	if value == "" {
+		return DefaultIdempotencyTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("invalid %s %q, using %s", IdempotencyTTLEnv, value, DefaultIdempotencyTTL)
+		return DefaultIdempotencyTTL
+	}
+	return ttl
+}
+
+// IdempotencyFingerprint identifies a request by its method, URI and body.
+func IdempotencyFingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", method, uri)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Idempotency makes requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key is handled normally and its response is
+// stored for ttl; a retry with the same key and the same request gets that
+// response again, with an Idempotent-Replayed header. Reusing a key for a
+// different request is refused with 422, and a retry arriving while the first
+// request is still being handled with 409. Server errors are not stored, so
+// that they can be retried. Keys are scoped to the user sending them.
+func Idempotency(db *gorm.DB, ttl time.Duration) gin.HandlerFunc {
+	db = db.Session(&gorm.Session{SkipDefaultTransaction: true})
+
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(IdempotencyKeyHeader))
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Abort(c, problem.BadRequest(
+				fmt.Sprintf("%s cannot be longer than %d characters", IdempotencyKeyHeader, maxIdempotencyKeyLength),
+			))
+			return
+		}
+
+		// Keys are chosen by clients, the ones of different users must not
+		// collide.
+		if userID, ok := auth.UserID(c); ok {
+			key = fmt.Sprintf("%d:%s", userID, key)
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Abort(c, problem.BadRequest(err.Error()))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now()
+		record := models.IdempotencyKey{
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.RequestURI(),
+			Fingerprint: IdempotencyFingerprint(c.Request.Method, c.Request.URL.RequestURI(), body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(ttl),
+		}
+
+		claimed, err := claimIdempotencyKey(db, &record)
+		if err != nil {
+			problem.Abort(c, problem.FromDB(err))
+			return
+		}
+		if !claimed {
+			replayIdempotent(c, db, &record)
+			return
+		}
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		if w.Status() >= http.StatusInternalServerError {
+			if err := db.Delete(&models.IdempotencyKey{}, "key = ?", key).Error; err != nil {
+				log.Println("error releasing idempotency key:", err)
+			}
+			return
+		}
+
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := w.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		encoded, _ := json.Marshal(headers)
+		if err := db.Model(&models.IdempotencyKey{}).
+			Where("key = ?", key).
+			Updates(map[string]any{"status": w.Status(), "headers": string(encoded), "body": w.body.Bytes()}).
+			Error; err != nil {
+			log.Println("error storing idempotent response:", err)
+		}
+	}
+}
+
+// claimIdempotencyKey stores a new key, or takes over one that expired or
+// whose request never finished. It returns false when the key is in use.
+func claimIdempotencyKey(db *gorm.DB, record *models.IdempotencyKey) (bool, error) {
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return true, nil
+	}
+
+	res = db.Model(&models.IdempotencyKey{}).
+		Where("key = ? AND (expires_at <= ? OR (status = 0 AND created_at <= ?))",
+			record.Key, record.CreatedAt, record.CreatedAt.Add(-idempotencyLockTimeout)).
+		Updates(map[string]any{
+			"method":      record.Method,
+			"path":        record.Path,
+			"fingerprint": record.Fingerprint,
+			"status":      0,
+			"headers":     "",
+			"body":        nil,
+			"created_at":  record.CreatedAt,
+			"expires_at":  record.ExpiresAt,
+		})
+	return res.RowsAffected == 1, res.Error
+}
+
+// replayIdempotent answers a request whose key is already in use.
+func replayIdempotent(c *gin.Context, db *gorm.DB, record *models.IdempotencyKey) {
+	var stored models.IdempotencyKey
+	if err := db.Where("key = ?", record.Key).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Released by a failed request in the meantime.
+			c.Header("Retry-After", "1")
+			problem.Abort(c, problem.New(http.StatusConflict, problem.CodeRequestInProgress, "the request with this Idempotency-Key failed, retry it"))
+			return
+		}
+		problem.Abort(c, problem.FromDB(err))
+		return
+	}
+
+	if stored.Fingerprint != record.Fingerprint {
+		problem.Abort(c, problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused,
+			"this Idempotency-Key was already used for a different request"))
+		return
+	}
+	if stored.Status == 0 {
+		c.Header("Retry-After", "1")
+		problem.Abort(c, problem.New(http.StatusConflict, problem.CodeRequestInProgress,
+			"a request with this Idempotency-Key is still being processed"))
+		return
+	}
+
+	headers := map[string]string{}
+	_ = json.Unmarshal([]byte(stored.Headers), &headers)
+	for name, value := range headers {
+		c.Header(name, value)
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(stored.Status, headers["Content-Type"], stored.Body)
+	c.Abort()
+}
+
+// PurgeIdempotencyKeys deletes expired keys every interval until ctx is done.
+func PurgeIdempotencyKeys(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := db.Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}).Error; err != nil {
+				log.Println("error purging idempotency keys:", err)
+			}
+		}
+	}
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -32,10 +32,24 @@ var (
 			Help: "Current number of todo tasks",
 		},
 	)
+
+	RemindersFired = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reminders_fired_total",
+			Help: "Total number of reminders delivered to the notifier",
+		},
+	)
+
+	RemindersFailed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "reminders_failed_total",
+			Help: "Total number of reminders the notifier failed to deliver",
+		},
+	)
 )
 
 func MustRegisterMetrics() {
-	prometheus.MustRegister(RequestsTotal, RequestLatencyHistogram, TasksCount)
+	prometheus.MustRegister(RequestsTotal, RequestLatencyHistogram, TasksCount, RemindersFired, RemindersFailed)
 }
 
 func MetricsMiddleware() gin.HandlerFunc {
@@ -1,7 +1,12 @@
 package middleware
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
 
-func SetupMiddlewares(engine *gin.Engine) {
+func SetupMiddlewares(engine *gin.Engine, db *gorm.DB, verifier auth.Verifier) {
 	CorsMiddleware(engine)
+	engine.Use(Authentication(verifier, db))
 }
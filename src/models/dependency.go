@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// TodoDependency is a "blocker blocks blocked" edge between two todos.
+type TodoDependency struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;index" json:"-"`
+	BlockerID   uint      `gorm:"not null;uniqueIndex:idx_todo_dependencies_edge" json:"blocker_id"`
+	BlockedID   uint      `gorm:"not null;uniqueIndex:idx_todo_dependencies_edge;index" json:"blocked_id"`
+	Blocker     TodoItem  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Blocked     TodoItem  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// IdempotencyKey remembers the response to a request sent with an
+// Idempotency-Key header, so that a retry gets the same response instead of
+// being executed again. Fingerprint identifies the request the key was first
+// used with, and Status is 0 while that request is still being handled. Key
+// is prefixed with the ID of the user who sent it.
+type IdempotencyKey struct {
+	Key         string    `gorm:"primaryKey;size:300"`
+	Method      string    `gorm:"size:10;not null"`
+	Path        string    `gorm:"type:text;not null"`
+	Fingerprint string    `gorm:"size:64;not null"`
+	Status      int       `gorm:"not null"`
+	Headers     string    `gorm:"type:text;not null;default:''"`
+	Body        []byte    `gorm:"type:bytea"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
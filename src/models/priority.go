@@ -0,0 +1,37 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	PriorityLow    = 1
+	PriorityMedium = 2
+	PriorityHigh   = 3
+	PriorityUrgent = 4
+)
+
+var PriorityNames = map[string]int{
+	"low":    PriorityLow,
+	"medium": PriorityMedium,
+	"high":   PriorityHigh,
+	"urgent": PriorityUrgent,
+}
+
+func ValidPriority(p int) bool {
+	return p >= PriorityLow && p <= PriorityUrgent
+}
+
+// ParsePriority accepts either a priority name ("high") or its level ("3").
+func ParsePriority(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if p, ok := PriorityNames[s]; ok {
+		return p, nil
+	}
+	if p, err := strconv.Atoi(s); err == nil && ValidPriority(p) {
+		return p, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+const DefaultProjectName = "Inbox"
+
+// Project is a list that owns todos. Names are unique per workspace, and todo
+// titles per project. Each workspace has exactly one default project, which
+// takes the todos created without a project.
+type Project struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID uint       `gorm:"not null;uniqueIndex:idx_projects_workspace_name,priority:1" json:"-"`
+	Workspace   *Workspace `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name        string     `gorm:"size:100;not null;uniqueIndex:idx_projects_workspace_name,priority:2" json:"name"`
+	Description string     `gorm:"type:text;not null;default:''" json:"description"`
+	IsDefault   bool       `gorm:"not null;default:false" json:"is_default"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
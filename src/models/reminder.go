@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Reminder is a point in time at which the todo's owner is notified. FiredAt is
+// set when the reminder is claimed by the scheduler, which makes sure it fires
+// at most once, and LastError keeps the notifier's error if sending failed.
+type Reminder struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID uint       `gorm:"not null;index" json:"-"`
+	TodoItemID  uint       `gorm:"not null;index" json:"todo_id"`
+	TodoItem    *TodoItem  `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	RemindAt    time.Time  `gorm:"not null;index" json:"remind_at"`
+	FiredAt     *time.Time `gorm:"index" json:"fired_at"`
+	LastError   string     `gorm:"type:text;not null;default:''" json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "slices"
+
+// Roles of users in their workspace. Admins can do everything, including
+// adding users and assigning roles, editors can read and change todos, and
+// viewers can only read them.
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+
+	// DefaultRole is the role of new users, but for the first one of a
+	// workspace, who becomes its admin.
+	DefaultRole = RoleEditor
+)
+
+// Roles lists every role, from the most to the least privileged.
+var Roles = []string{RoleAdmin, RoleEditor, RoleViewer}
+
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
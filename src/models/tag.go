@@ -0,0 +1,31 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type Tag struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID uint       `gorm:"not null;uniqueIndex:idx_tags_workspace_name,priority:1" json:"-"`
+	Workspace   *Workspace `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name        string     `gorm:"size:50;not null;uniqueIndex:idx_tags_workspace_name,priority:2" json:"name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// NormalizeTagName trims and lower-cases a tag name so "Backend" and
+// " backend" end up as the same tag.
+func NormalizeTagName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch {
+	case name == "":
+		return "", errors.New("tag name cannot be empty")
+	case len(name) > 50:
+		return "", errors.New("tag name cannot be longer than 50 characters")
+	case strings.Contains(name, ","):
+		return "", errors.New("tag name cannot contain commas")
+	}
+	return name, nil
+}
@@ -4,11 +4,35 @@ import (
 	"time"
 )
 
+// TodoItem is a task. Its Status moves through the configured workflow (see
+// the workflow package), IsDone is kept in sync with it for older clients.
+// A todo with a Recurrence (an RFC 5545 RRULE) is one occurrence of a series,
+// completing it creates the next one; SeriesID points at the first occurrence.
+// Version is incremented on every change, for optimistic concurrency control.
+// OwnerID is the user who created the todo, nil for todos created before users
+// were introduced. Todos, like everything users create, belong to the
+// workspace of their creator.
 type TodoItem struct {
-	ID          uint      `gorm:"primarykey"`
-	Title       string    `gorm:"size:50;unique;not null" json:"title"`
-	Description string    `gorm:"type:text;not null" json:"description"`
-	IsDone      bool      `gorm:"default:false" json:"is_done"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID            uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID   uint       `gorm:"not null;uniqueIndex:idx_todo_items_workspace_project_title,priority:1" json:"-"`
+	Workspace     *Workspace `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	ProjectID     uint       `gorm:"not null;uniqueIndex:idx_todo_items_workspace_project_title,priority:2" json:"project_id"`
+	Project       *Project   `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Title         string     `gorm:"size:50;not null;uniqueIndex:idx_todo_items_workspace_project_title,priority:3" json:"title"`
+	Description   string     `gorm:"type:text;not null" json:"description"`
+	Status        string     `gorm:"size:30;not null;default:'todo';index" json:"status"`
+	IsDone        bool       `gorm:"default:false" json:"is_done"`
+	EstimateHours *float64   `json:"estimate_hours"`
+	Priority      int        `gorm:"not null;default:2;index" json:"priority"`
+	DueAt         *time.Time `gorm:"index" json:"due_at"`
+	Recurrence    string     `gorm:"type:text;not null;default:''" json:"recurrence"`
+	SeriesID      *uint      `gorm:"index" json:"series_id"`
+	Tags          []Tag      `gorm:"many2many:todo_item_tags;constraint:OnDelete:CASCADE" json:"tags"`
+	ParentID      *uint      `gorm:"index" json:"parent_id"`
+	Parent        *TodoItem  `gorm:"constraint:OnDelete:SET NULL" json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+	Version       uint       `gorm:"not null;default:1" json:"version"`
+	OwnerID       *uint      `gorm:"index" json:"owner_id"`
+	Owner         *User      `gorm:"constraint:OnDelete:SET NULL" json:"-"`
 }
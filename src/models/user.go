@@ -0,0 +1,81 @@
+package models
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// User is an account of the API. Emails are stored lower-cased, passwords
+// only as bcrypt hashes. Users of an OpenID Connect provider have no password
+// and are identified by the issuer and subject of their tokens; their email
+// is only known when the provider shares it. The role of a user decides what
+// they can do with the todos of their workspace.
+type User struct {
+	ID              uint       `gorm:"primarykey" json:"id"`
+	WorkspaceID     uint       `gorm:"not null;index" json:"workspace_id"`
+	Workspace       *Workspace `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Email           *string    `gorm:"size:255;unique" json:"email"`
+	PasswordHash    string     `gorm:"size:60;not null;default:''" json:"-"`
+	Role            string     `gorm:"size:20;not null;default:'editor';index" json:"role" example:"editor"`
+	ExternalIssuer  string     `gorm:"size:255;not null;default:'';uniqueIndex:idx_users_external,priority:1,where:external_subject <> ''" json:"external_issuer,omitempty"`
+	ExternalSubject string     `gorm:"size:255;not null;default:'';uniqueIndex:idx_users_external,priority:2" json:"external_subject,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// RefreshToken lets a user get new access tokens without logging in again.
+// Only the SHA-256 hash of the token is stored; it is revoked once used, as a
+// new one is issued along with every access token.
+type RefreshToken struct {
+	ID        uint      `gorm:"primarykey"`
+	UserID    uint      `gorm:"not null;index"`
+	User      *User     `gorm:"constraint:OnDelete:CASCADE"`
+	TokenHash string    `gorm:"size:64;uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	RevokedAt *time.Time
+	CreatedAt time.Time `gorm:"not null"`
+}
+
+// APIKey is a credential of a user for non-interactive clients. It only
+// grants its Scopes, stored comma separated. Only the SHA-256 hash of the key
+// is stored; Prefix is its first characters, to tell keys apart.
+type APIKey struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       *User      `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Name       string     `gorm:"size:100;not null" json:"name"`
+	Prefix     string     `gorm:"size:16;not null" json:"prefix"`
+	KeyHash    string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Scopes     string     `gorm:"type:text;not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList returns the scopes of the key.
+func (k *APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// NormalizeEmail trims and lower-cases an email and checks that it is a bare
+// address.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	switch {
+	case email == "":
+		return "", errors.New("\"email\" cannot be empty")
+	case len(email) > 255:
+		return "", errors.New("\"email\" cannot be longer than 255 characters")
+	}
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("\"email\" is not a valid email address")
+	}
+	return email, nil
+}
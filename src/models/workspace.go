@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Workspace is a tenant: a team whose users, projects, tags and todos can't
+// be seen from other workspaces. The workspaces of an OpenID Connect provider
+// are identified by the issuer and a claim of their users' tokens.
+type Workspace struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	Name           string    `gorm:"size:255;not null" json:"name"`
+	ExternalIssuer string    `gorm:"size:255;not null;default:'';uniqueIndex:idx_workspaces_external,priority:1,where:external_id <> ''" json:"-"`
+	ExternalID     string    `gorm:"size:255;not null;default:'';uniqueIndex:idx_workspaces_external,priority:2" json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
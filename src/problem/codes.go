@@ -0,0 +1,69 @@
+package problem
+
+// Codes of the problems the API answers with. They are part of the API and
+// must not change.
+const (
+	CodeInvalidRequest       = "invalid_request"
+	CodeValidationFailed     = "validation_failed"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeTitleConflict        = "title_conflict"
+	CodeNameConflict         = "name_conflict"
+	CodeEmailConflict        = "email_conflict"
+	CodeReferenceNotFound    = "reference_not_found"
+	CodeUnknownStatus        = "unknown_status"
+	CodeIllegalTransition    = "illegal_transition"
+	CodeOpenSubtasks         = "open_subtasks"
+	CodeDependencyCycle      = "dependency_cycle"
+	CodePreconditionFailed   = "precondition_failed"
+	CodePreconditionRequired = "precondition_required"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeNotApplied           = "not_applied"
+	CodeIdempotencyKeyReused = "idempotency_key_reused"
+	CodeRequestInProgress    = "request_in_progress"
+	CodeUnauthorized         = "unauthorized"
+	CodeInvalidToken         = "invalid_token"
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeInsufficientScope    = "insufficient_scope"
+	CodePermissionDenied     = "permission_denied"
+	CodeLastAdmin            = "last_admin"
+	CodeInternal             = "internal_error"
+)
+
+var titles = map[string]string{
+	CodeInvalidRequest:       "Invalid request",
+	CodeValidationFailed:     "Validation failed",
+	CodeNotFound:             "Not found",
+	CodeConflict:             "Conflict",
+	CodeTitleConflict:        "Title already taken",
+	CodeNameConflict:         "Name already taken",
+	CodeEmailConflict:        "Email already registered",
+	CodeReferenceNotFound:    "Referenced resource not found",
+	CodeUnknownStatus:        "Unknown status",
+	CodeIllegalTransition:    "Illegal status transition",
+	CodeOpenSubtasks:         "Todo has open subtasks",
+	CodeDependencyCycle:      "Dependency cycle",
+	CodePreconditionFailed:   "Precondition failed",
+	CodePreconditionRequired: "Precondition required",
+	CodeInvalidPatch:         "Invalid patch",
+	CodePatchTestFailed:      "Patch test failed",
+	CodeNotApplied:           "Not applied",
+	CodeIdempotencyKeyReused: "Idempotency key reused",
+	CodeRequestInProgress:    "Request in progress",
+	CodeUnauthorized:         "Authentication required",
+	CodeInvalidToken:         "Invalid token",
+	CodeInvalidCredentials:   "Invalid credentials",
+	CodeInsufficientScope:    "Insufficient scope",
+	CodePermissionDenied:     "Permission denied",
+	CodeLastAdmin:            "Last admin",
+	CodeInternal:             "Internal server error",
+}
+
+// Title is the human readable summary of a code.
+func Title(code string) string {
+	if title, ok := titles[code]; ok {
+		return title
+	}
+	return titles[CodeInternal]
+}
@@ -0,0 +1,56 @@
+package problem
+
+import (
+	"errors"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"net/http"
+	"strings"
+)
+
+// Error codes of PostgreSQL, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+)
+
+// FromDB turns a database error into a problem: missing records, unique,
+// foreign key and check violations get their own codes; anything else is an
+// internal error. Database messages are never returned.
+func FromDB(err error) *Problem {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound("not found")
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return Internal(err)
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		return uniqueViolation(pgErr)
+	case pgForeignKeyViolation:
+		return New(http.StatusConflict, CodeReferenceNotFound, "a resource this one refers to does not exist")
+	case pgCheckViolation:
+		return New(http.StatusUnprocessableEntity, CodeValidationFailed, "the request violates a constraint")
+	default:
+		return Internal(err)
+	}
+}
+
+func uniqueViolation(pgErr *pgconn.PgError) *Problem {
+	switch {
+	case pgErr.TableName == "todo_items" || strings.HasSuffix(pgErr.ConstraintName, "_project_title"):
+		return New(http.StatusConflict, CodeTitleConflict, "a todo with this title already exists in the project")
+	case pgErr.TableName == "tags":
+		return New(http.StatusConflict, CodeNameConflict, "a tag with this name already exists")
+	case pgErr.TableName == "projects":
+		return New(http.StatusConflict, CodeNameConflict, "a project with this name already exists")
+	case pgErr.TableName == "users":
+		return New(http.StatusConflict, CodeEmailConflict, "a user with this email already exists")
+	default:
+		return New(http.StatusConflict, CodeConflict, "the resource already exists")
+	}
+}
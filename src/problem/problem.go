@@ -0,0 +1,136 @@
+// Package problem answers errors with RFC 7807 problem details
+// (application/problem+json). Every problem carries a stable code, that
+// clients can switch on, and a type URI made from it.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"log"
+	"net/http"
+)
+
+const (
+	ContentType = "application/problem+json"
+
+	// TypeBase prefixes the code of a problem to make its type URI.
+	TypeBase = "urn:graph-task:problem:"
+)
+
+// Problem is the body of an error response. Problems that carry more
+// information embed it and add their own members.
+type Problem struct {
+	Type     string       `json:"type" example:"urn:graph-task:problem:title_conflict"`
+	Title    string       `json:"title" example:"Title already taken"`
+	Status   int          `json:"status" example:"409"`
+	Code     string       `json:"code" example:"title_conflict"`
+	Detail   string       `json:"detail,omitempty" example:"a todo with this title already exists in the project"`
+	Instance string       `json:"instance,omitempty" example:"/api/task/todos"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is a validation failure of one field of a request. As an error,
+// it is what validations return to point at the field.
+type FieldError struct {
+	Field  string `json:"field" example:"title"`
+	Detail string `json:"detail" example:"\"title\" cannot be empty"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Detail
+}
+
+// Invalid is the validation failure of a field.
+func Invalid(field, detail string) error {
+	return &FieldError{Field: field, Detail: detail}
+}
+
+// Details is a problem, possibly with members of its own.
+type Details interface {
+	Base() *Problem
+}
+
+// Base returns the problem itself, for the types that embed it.
+func (p *Problem) Base() *Problem {
+	return p
+}
+
+// New is a problem with a code from the catalog in codes.go.
+func New(status int, code, detail string) *Problem {
+	return &Problem{Type: TypeBase + code, Title: Title(code), Status: status, Code: code, Detail: detail}
+}
+
+// codes are the default codes of statuses.
+var codes = map[int]string{
+	http.StatusBadRequest:           CodeInvalidRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusConflict:             CodeConflict,
+	http.StatusPreconditionFailed:   CodePreconditionFailed,
+	http.StatusUnprocessableEntity:  CodeValidationFailed,
+	http.StatusPreconditionRequired: CodePreconditionRequired,
+}
+
+// Status is a problem with the default code of its status.
+func Status(status int, detail string) *Problem {
+	code, ok := codes[status]
+	if !ok {
+		code = CodeInternal
+	}
+	return New(status, code, detail)
+}
+
+// BadRequest is a malformed request, such as an invalid path or query param.
+func BadRequest(detail string) *Problem {
+	return New(http.StatusBadRequest, CodeInvalidRequest, detail)
+}
+
+// NotFound is a missing resource.
+func NotFound(detail string) *Problem {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Internal is an unexpected failure. The error is logged, not returned, as
+// it may reveal internals such as database messages.
+func Internal(err error) *Problem {
+	log.Println("internal error:", err)
+	return New(http.StatusInternalServerError, CodeInternal, "an unexpected error occurred")
+}
+
+// Validation is a request body that couldn't be decoded or validated, with the
+// failing field when it is known.
+func Validation(err error) *Problem {
+	var fieldErr *FieldError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &fieldErr):
+		p := New(http.StatusBadRequest, CodeValidationFailed, fieldErr.Detail)
+		p.Errors = []FieldError{*fieldErr}
+		return p
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		detail := fmt.Sprintf("%q must be of type %s", typeErr.Field, typeErr.Type)
+		p := New(http.StatusBadRequest, CodeValidationFailed, detail)
+		p.Errors = []FieldError{{Field: typeErr.Field, Detail: detail}}
+		return p
+	default:
+		return BadRequest(err.Error())
+	}
+}
+
+// Write answers with a problem.
+func Write(c *gin.Context, d Details) {
+	p := d.Base()
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, d)
+}
+
+// Abort answers with a problem and stops the handler chain.
+func Abort(c *gin.Context, d Details) {
+	Write(c, d)
+	c.Abort()
+}
@@ -0,0 +1,132 @@
+package querylang
+
+import (
+	"time"
+)
+
+// Node is a node of a parsed query. Pos is the 1-based column of the text the
+// node was parsed from, used to point at the problem when a node cannot be
+// applied.
+type Node interface {
+	Pos() int
+}
+
+// Op is the comparison of a priority or date term.
+type Op string
+
+const (
+	OpEq Op = "="
+	OpLt Op = "<"
+	OpLe Op = "<="
+	OpGt Op = ">"
+	OpGe Op = ">="
+)
+
+// And matches todos matching all of its nodes. Terms separated by whitespace
+// are implicitly and-ed.
+type And struct {
+	At    int
+	Nodes []Node
+}
+
+// Or matches todos matching any of its nodes.
+type Or struct {
+	At    int
+	Nodes []Node
+}
+
+// Not matches todos not matching its node. Written as "-term" or "NOT term".
+type Not struct {
+	At   int
+	Node Node
+}
+
+// Text matches todos whose title or description contains the text. Written as
+// a bare word or a quoted string.
+type Text struct {
+	At    int
+	Value string
+}
+
+// Title matches todos whose title contains the text, e.g. title:"release notes".
+type Title struct {
+	At    int
+	Value string
+}
+
+// Is matches a predefined state, e.g. is:open, is:done, is:overdue,
+// is:recurring.
+type Is struct {
+	At    int
+	Value string
+}
+
+// Status matches a workflow status, e.g. status:in_review.
+type Status struct {
+	At    int
+	Value string
+}
+
+// Tag matches todos carrying the tag, e.g. tag:backend.
+type Tag struct {
+	At   int
+	Name string
+}
+
+// Project matches todos of the project, e.g. project:3.
+type Project struct {
+	At int
+	ID uint
+}
+
+// Priority compares the priority, e.g. priority:high or priority:>=3.
+type Priority struct {
+	At    int
+	Op    Op
+	Level int
+}
+
+// Date compares one of the due, created or updated dates, e.g. due:<7d,
+// created:>=2026-01-01 or due:none.
+type Date struct {
+	At    int
+	Field string
+	Op    Op
+	Value DateValue
+}
+
+// DateValue is either an absolute time, an offset from now (7d, -2w, 12h) or
+// none, which matches todos without the date.
+type DateValue struct {
+	Time     time.Time
+	Offset   time.Duration
+	Relative bool
+	None     bool
+	// DateOnly is set for values without a time of day (2026-01-31, today).
+	// Compared with "=" they match the whole day.
+	DateOnly bool
+}
+
+// Resolve returns the point in time the value stands for.
+func (v DateValue) Resolve(now time.Time) time.Time {
+	if !v.Relative {
+		return v.Time
+	}
+	t := now.Add(v.Offset)
+	if v.DateOnly {
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t
+}
+
+func (n *And) Pos() int      { return n.At }
+func (n *Or) Pos() int       { return n.At }
+func (n *Not) Pos() int      { return n.At }
+func (n *Text) Pos() int     { return n.At }
+func (n *Title) Pos() int    { return n.At }
+func (n *Is) Pos() int       { return n.At }
+func (n *Status) Pos() int   { return n.At }
+func (n *Tag) Pos() int      { return n.At }
+func (n *Project) Pos() int  { return n.At }
+func (n *Priority) Pos() int { return n.At }
+func (n *Date) Pos() int     { return n.At }
@@ -0,0 +1,121 @@
+package querylang
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokField // "name:" directly followed by its value
+	tokLParen
+	tokRParen
+	tokMinus
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// Error is a syntax or value error in a query, with the 1-based column where
+// it was found.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos, e.Msg)
+}
+
+func errorAt(pos int, format string, args ...any) *Error {
+	return &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+type lexer struct {
+	src []rune
+	i   int
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')' || r == '"'
+}
+
+// next returns the next token. Column positions are 1-based and counted in
+// characters, not bytes.
+func (l *lexer) next() (token, error) {
+	for l.i < len(l.src) && unicode.IsSpace(l.src[l.i]) {
+		l.i++
+	}
+	if l.i >= len(l.src) {
+		return token{kind: tokEOF, pos: l.i + 1}, nil
+	}
+
+	start := l.i
+	switch r := l.src[l.i]; {
+	case r == '(':
+		l.i++
+		return token{kind: tokLParen, value: "(", pos: start + 1}, nil
+	case r == ')':
+		l.i++
+		return token{kind: tokRParen, value: ")", pos: start + 1}, nil
+	case r == '"':
+		s, err := l.readString()
+		return token{kind: tokString, value: s, pos: start + 1}, err
+	case r == '-' && l.i+1 < len(l.src) && !unicode.IsSpace(l.src[l.i+1]):
+		l.i++
+		return token{kind: tokMinus, value: "-", pos: start + 1}, nil
+	}
+
+	for l.i < len(l.src) && !isDelimiter(l.src[l.i]) {
+		if l.src[l.i] == ':' {
+			l.i++
+			return token{kind: tokField, value: string(l.src[start : l.i-1]), pos: start + 1}, nil
+		}
+		l.i++
+	}
+	return token{kind: tokWord, value: string(l.src[start:l.i]), pos: start + 1}, nil
+}
+
+// value reads the value of a field: a quoted string or a run of characters up
+// to the next delimiter.
+func (l *lexer) value() (string, int, error) {
+	start := l.i
+	if l.i < len(l.src) && l.src[l.i] == '"' {
+		s, err := l.readString()
+		return s, start + 1, err
+	}
+	for l.i < len(l.src) && !isDelimiter(l.src[l.i]) {
+		l.i++
+	}
+	return string(l.src[start:l.i]), start + 1, nil
+}
+
+func (l *lexer) readString() (string, error) {
+	start := l.i
+	l.i++ // opening quote
+
+	var sb strings.Builder
+	for l.i < len(l.src) {
+		r := l.src[l.i]
+		switch {
+		case r == '\\' && l.i+1 < len(l.src):
+			sb.WriteRune(l.src[l.i+1])
+			l.i += 2
+		case r == '"':
+			l.i++
+			return sb.String(), nil
+		default:
+			sb.WriteRune(r)
+			l.i++
+		}
+	}
+	return "", errorAt(start+1, "unterminated string")
+}
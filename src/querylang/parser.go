@@ -0,0 +1,295 @@
+// Package querylang parses the compact search syntax of the todo list, e.g.
+//
+//	is:open tag:backend due:<7d "release"
+//	(priority:>=high OR tag:incident) -status:wont_do
+//
+// Terms separated by whitespace are and-ed, OR binds looser than AND, and a
+// leading "-" or NOT negates a term or a parenthesized group.
+package querylang
+
+import (
+	"fmt"
+	"github.com/alirezamastery/graph_task/models"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxDepth caps the nesting of parentheses and negations.
+const MaxDepth = 32
+
+var relativeDate = regexp.MustCompile(`^([+-]?\d+)([hdw])$`)
+
+type parser struct {
+	lex   *lexer
+	tok   token
+	depth int
+}
+
+// Parse parses a query into its AST. An empty query returns a nil node.
+func Parse(q string) (Node, error) {
+	p := &parser{lex: &lexer{src: []rune(q)}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF {
+		return nil, nil
+	}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, errorAt(p.tok.pos, "unexpected %q", p.tok.value)
+	}
+	return node, nil
+}
+
+func (p *parser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *parser) isKeyword(kw string) bool {
+	return p.tok.kind == tokWord && p.tok.value == kw
+}
+
+func (p *parser) parseOr() (Node, error) {
+	pos := p.tok.pos
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []Node{first}
+	for p.isKeyword("OR") {
+		orPos := p.tok.pos
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokEOF || p.tok.kind == tokRParen || p.isKeyword("OR") {
+			return nil, errorAt(orPos, "OR needs a term on both sides")
+		}
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(nodes) == 1 {
+		return first, nil
+	}
+	return &Or{At: pos, Nodes: nodes}, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	pos := p.tok.pos
+	var nodes []Node
+	for p.tok.kind != tokEOF && p.tok.kind != tokRParen && !p.isKeyword("OR") {
+		if p.isKeyword("AND") {
+			andPos := p.tok.pos
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if len(nodes) == 0 || p.tok.kind == tokEOF || p.tok.kind == tokRParen || p.isKeyword("OR") {
+				return nil, errorAt(andPos, "AND needs a term on both sides")
+			}
+			continue
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, errorAt(p.tok.pos, "expected a term")
+	case 1:
+		return nodes[0], nil
+	}
+	return &And{At: pos, Nodes: nodes}, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.tok.kind != tokMinus && !p.isKeyword("NOT") {
+		return p.parsePrimary()
+	}
+
+	pos := p.tok.pos
+	if p.depth++; p.depth > MaxDepth {
+		return nil, errorAt(pos, "query is nested too deeply")
+	}
+	defer func() { p.depth-- }()
+
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.tok.kind == tokEOF || p.tok.kind == tokRParen {
+		return nil, errorAt(pos, "nothing to negate")
+	}
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &Not{At: pos, Node: node}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokLParen:
+		if p.depth++; p.depth > MaxDepth {
+			return nil, errorAt(tok.pos, "query is nested too deeply")
+		}
+		defer func() { p.depth-- }()
+
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if p.tok.kind == tokRParen {
+			return nil, errorAt(tok.pos, "empty parentheses")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, errorAt(tok.pos, "unclosed parenthesis")
+		}
+		return node, p.advance()
+
+	case tokRParen:
+		return nil, errorAt(tok.pos, "unexpected \")\"")
+
+	case tokString:
+		if tok.value == "" {
+			return nil, errorAt(tok.pos, "empty string")
+		}
+		return &Text{At: tok.pos, Value: tok.value}, p.advance()
+
+	case tokField:
+		value, valuePos, err := p.lex.value()
+		if err != nil {
+			return nil, err
+		}
+		node, err := parseField(tok.value, tok.pos, value, valuePos)
+		if err != nil {
+			return nil, err
+		}
+		return node, p.advance()
+	}
+
+	return &Text{At: tok.pos, Value: tok.value}, p.advance()
+}
+
+func parseField(name string, pos int, value string, valuePos int) (Node, error) {
+	field := strings.ToLower(name)
+	if value == "" {
+		return nil, errorAt(valuePos, "%q needs a value", field)
+	}
+
+	switch field {
+	case "is":
+		v := strings.ToLower(value)
+		switch v {
+		case "open", "done", "overdue", "recurring":
+			return &Is{At: pos, Value: v}, nil
+		}
+		return nil, errorAt(valuePos, "unknown is:%s, expected open, done, overdue or recurring", value)
+
+	case "status":
+		return &Status{At: pos, Value: strings.ToLower(value)}, nil
+
+	case "tag":
+		name, err := models.NormalizeTagName(value)
+		if err != nil {
+			return nil, errorAt(valuePos, "%s", err.Error())
+		}
+		return &Tag{At: pos, Name: name}, nil
+
+	case "title":
+		return &Title{At: pos, Value: value}, nil
+
+	case "project":
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil || id == 0 {
+			return nil, errorAt(valuePos, "invalid project id %q", value)
+		}
+		return &Project{At: pos, ID: uint(id)}, nil
+
+	case "priority":
+		op, rest := splitOp(value)
+		level, err := models.ParsePriority(rest)
+		if err != nil {
+			return nil, errorAt(valuePos+len(op), "%s", err.Error())
+		}
+		return &Priority{At: pos, Op: op, Level: level}, nil
+
+	case "due", "created", "updated":
+		op, rest := splitOp(value)
+		v, err := parseDate(rest)
+		if err != nil {
+			return nil, errorAt(valuePos+len(op), "%s", err.Error())
+		}
+		if v.None && op != OpEq {
+			return nil, errorAt(valuePos, "%s:none cannot be compared", field)
+		}
+		return &Date{At: pos, Field: field, Op: op, Value: v}, nil
+	}
+
+	return nil, errorAt(pos, "unknown field %q", field)
+}
+
+// splitOp splits a leading comparison off a value. Without one the
+// comparison is "=".
+func splitOp(value string) (Op, string) {
+	for _, op := range []Op{OpLe, OpGe, OpLt, OpGt, OpEq} {
+		if strings.HasPrefix(value, string(op)) {
+			return op, value[len(op):]
+		}
+	}
+	return OpEq, value
+}
+
+func parseDate(value string) (DateValue, error) {
+	switch strings.ToLower(value) {
+	case "none":
+		return DateValue{None: true}, nil
+	case "now":
+		return DateValue{Relative: true}, nil
+	case "today":
+		return DateValue{Relative: true, DateOnly: true}, nil
+	case "tomorrow":
+		return DateValue{Relative: true, Offset: 24 * time.Hour, DateOnly: true}, nil
+	case "yesterday":
+		return DateValue{Relative: true, Offset: -24 * time.Hour, DateOnly: true}, nil
+	}
+
+	if m := relativeDate.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return DateValue{}, err
+		}
+		unit := map[string]time.Duration{"h": time.Hour, "d": 24 * time.Hour, "w": 7 * 24 * time.Hour}[m[2]]
+		return DateValue{Relative: true, Offset: time.Duration(n) * unit}, nil
+	}
+
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return DateValue{Time: t, DateOnly: true}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return DateValue{Time: t}, nil
+	}
+
+	return DateValue{}, fmt.Errorf("invalid date %q, expected e.g. 7d, -2w, today, 2026-01-31 or an RFC 3339 time", value)
+}
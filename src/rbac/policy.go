@@ -0,0 +1,48 @@
+package rbac
+
+import (
+	"fmt"
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// DeniedResponse is the problem of a request whose user lacks a permission.
+type DeniedResponse struct {
+	problem.Problem
+	Permission string `json:"permission" example:"todos:delete"`
+	Role       string `json:"role,omitempty" example:"viewer"`
+}
+
+// Policy grants permissions to the user of a request by the role recorded
+// when they were authenticated, so that role changes apply right away.
+type Policy struct{}
+
+func NewPolicy() *Policy {
+	return &Policy{}
+}
+
+// Authorize reports whether the user of a request has the permission. When
+// they don't, it answers 403 naming the permission. A nil Policy grants
+// nothing, so that handlers wired without one are closed rather than open.
+func (p *Policy) Authorize(c *gin.Context, permission string) bool {
+	role := auth.Role(c)
+	if p != nil && Allows(role, permission) {
+		return true
+	}
+
+	detail := fmt.Sprintf("the %s role lacks the %s permission", role, permission)
+	switch {
+	case p == nil:
+		detail = fmt.Sprintf("no policy grants the %s permission", permission)
+	case role == "":
+		detail = fmt.Sprintf("requests without a user lack the %s permission", permission)
+	}
+	problem.Write(c, &DeniedResponse{
+		Problem:    *problem.New(http.StatusForbidden, problem.CodePermissionDenied, detail),
+		Permission: permission,
+		Role:       role,
+	})
+	return false
+}
@@ -0,0 +1,48 @@
+// Package rbac decides what users can do by their role. Handlers ask the
+// Policy for the permission an operation needs, and users lacking it are
+// answered 403 with the permission named.
+package rbac
+
+import (
+	"github.com/alirezamastery/graph_task/models"
+	"slices"
+)
+
+// Permissions checked by handlers.
+const (
+	TodosRead   = "todos:read"
+	TodosCreate = "todos:create"
+	TodosUpdate = "todos:update"
+	TodosDelete = "todos:delete"
+	// ProjectsWrite and TagsWrite cover creating, changing and deleting
+	// projects and tags; reading them needs no permission.
+	ProjectsWrite = "projects:write"
+	TagsWrite     = "tags:write"
+	UsersRead     = "users:read"
+	UsersCreate   = "users:create"
+	RolesAssign   = "roles:assign"
+)
+
+// AllPermissions lists every permission, in the order they are documented.
+var AllPermissions = []string{
+	TodosRead, TodosCreate, TodosUpdate, TodosDelete,
+	ProjectsWrite, TagsWrite,
+	UsersRead, UsersCreate, RolesAssign,
+}
+
+// grants are the permissions of each role.
+var grants = map[string][]string{
+	models.RoleAdmin:  AllPermissions,
+	models.RoleEditor: {TodosRead, TodosCreate, TodosUpdate, TodosDelete, ProjectsWrite, TagsWrite},
+	models.RoleViewer: {TodosRead},
+}
+
+// Permissions returns the permissions a role grants, none for unknown roles.
+func Permissions(role string) []string {
+	return slices.Clone(grants[role])
+}
+
+// Allows reports whether a role grants a permission.
+func Allows(role, permission string) bool {
+	return slices.Contains(grants[role], permission)
+}
@@ -0,0 +1,122 @@
+package recurrence
+
+import (
+	"errors"
+	"github.com/teambition/rrule-go"
+	"strings"
+	"time"
+)
+
+// MaxPreview caps the number of occurrences Preview returns.
+const MaxPreview = 100
+
+var ErrDTStart = errors.New("the rule cannot carry its own DTSTART, the todo's due date is used instead")
+
+// Normalize validates an RFC 5545 RRULE (with or without the "RRULE:" prefix)
+// and returns it in canonical form. An empty rule stays empty.
+func Normalize(rule string) (string, error) {
+	rule = strings.TrimSpace(rule)
+	if rule == "" {
+		return "", nil
+	}
+
+	opt, err := parse(rule)
+	if err != nil {
+		return "", err
+	}
+	if _, err := rrule.NewRRule(*opt); err != nil {
+		return "", err
+	}
+	return opt.RRuleString(), nil
+}
+
+// Next returns the first occurrence of the rule after the one due at due, and
+// the rule the next occurrence carries on with: COUNT is decremented so that a
+// series stops after the requested number of occurrences. ok is false when the
+// series is over.
+func Next(rule string, due time.Time) (next time.Time, nextRule string, ok bool, err error) {
+	opt, err := parse(rule)
+	if err != nil {
+		return time.Time{}, "", false, err
+	}
+	if opt.Count == 1 {
+		return time.Time{}, "", false, nil
+	}
+
+	opt.Dtstart = due
+	r, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return time.Time{}, "", false, err
+	}
+
+	next = r.After(due, false)
+	if next.IsZero() {
+		return time.Time{}, "", false, nil
+	}
+
+	if opt.Count > 1 {
+		opt.Count--
+	}
+	opt.Dtstart = time.Time{}
+	return next, opt.RRuleString(), true, nil
+}
+
+// Layout returns the shortest time layout that tells the occurrences of the
+// rule apart: the date, unless the rule can repeat within a day, in which
+// case the time is added, with seconds when it can repeat within a minute.
+func Layout(rule string) (string, error) {
+	opt, err := parse(rule)
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case opt.Freq == rrule.SECONDLY || len(opt.Bysecond) > 1:
+		return time.DateTime, nil
+	case opt.Freq == rrule.MINUTELY || opt.Freq == rrule.HOURLY || len(opt.Byminute) > 1 || len(opt.Byhour) > 1:
+		return "2006-01-02 15:04", nil
+	default:
+		return time.DateOnly, nil
+	}
+}
+
+// Preview returns up to n occurrences of the rule following the one due at
+// due. Nothing is created.
+func Preview(rule string, due time.Time, n int) ([]time.Time, error) {
+	opt, err := parse(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	opt.Dtstart = due
+	r, err := rrule.NewRRule(*opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// The current occurrence is the first one of a COUNT limited series.
+	limit := n
+	if opt.Count > 0 && opt.Count-1 < limit {
+		limit = opt.Count - 1
+	}
+
+	occurrences := []time.Time{}
+	next := r.Iterator()
+	for len(occurrences) < limit {
+		t, ok := next()
+		if !ok {
+			break
+		}
+		if t.After(due) {
+			occurrences = append(occurrences, t)
+		}
+	}
+	return occurrences, nil
+}
+
+func parse(rule string) (*rrule.ROption, error) {
+	rule = strings.ToUpper(strings.TrimSpace(rule))
+	if strings.Contains(rule, "DTSTART") {
+		return nil, ErrDTStart
+	}
+	return rrule.StrToROption(rule)
+}
@@ -0,0 +1,82 @@
+package reminder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// WebhookURLEnv names the environment variable holding the URL reminders are
+// posted to. Without it reminders are only logged.
+const WebhookURLEnv = "REMINDER_WEBHOOK_URL"
+
+// Notification is what a notifier receives when a reminder fires.
+type Notification struct {
+	ReminderID uint       `json:"reminder_id"`
+	TodoID     uint       `json:"todo_id"`
+	Title      string     `json:"title"`
+	DueAt      *time.Time `json:"due_at"`
+	RemindAt   time.Time  `json:"remind_at"`
+}
+
+// Notifier delivers fired reminders.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes reminders to the standard logger.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(_ context.Context, n Notification) error {
+	log.Printf("reminder %d: todo %d %q is due at %v", n.ReminderID, n.TodoID, n.Title, n.DueAt)
+	return nil
+}
+
+// WebhookNotifier posts reminders as JSON to a URL. Any non 2xx response
+// counts as a failure.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", res.Status)
+	}
+	return nil
+}
+
+// NotifierFromEnv returns a webhook notifier when REMINDER_WEBHOOK_URL is set
+// and a log notifier otherwise.
+func NotifierFromEnv() Notifier {
+	if url := os.Getenv(WebhookURLEnv); url != "" {
+		return NewWebhookNotifier(url)
+	}
+	return LogNotifier{}
+}
@@ -0,0 +1,126 @@
+package reminder
+
+import (
+	"context"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	DefaultInterval  = 30 * time.Second
+	DefaultBatchSize = 100
+)
+
+// Worker fires due reminders. Every tick it claims the reminders whose time
+// has come, including the ones missed while the service was down, and hands
+// them to the notifier.
+//
+// A reminder is claimed by setting its fired_at in the same statement that
+// selects it (with SKIP LOCKED), so it fires at most once even with several
+// workers. A failed notification is recorded on the reminder and not retried.
+type Worker struct {
+	db        *gorm.DB
+	notifier  Notifier
+	Interval  time.Duration
+	BatchSize int
+}
+
+func NewWorker(db *gorm.DB, notifier Notifier) *Worker {
+	return &Worker{
+		db:        db,
+		notifier:  notifier,
+		Interval:  DefaultInterval,
+		BatchSize: DefaultBatchSize,
+	}
+}
+
+// Run fires due reminders until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := w.FireDue(ctx, time.Now()); err != nil {
+			log.Println("error in firing reminders:", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FireDue claims and fires every reminder due at now, one batch at a time.
+func (w *Worker) FireDue(ctx context.Context, now time.Time) error {
+	for {
+		claimed, err := w.claim(now)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range claimed {
+			w.fire(ctx, r)
+		}
+
+		if len(claimed) < w.BatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+func (w *Worker) claim(now time.Time) ([]models.Reminder, error) {
+	var claimed []models.Reminder
+	err := w.db.Raw(`
+		UPDATE reminders SET fired_at = ?
+		WHERE id IN (
+			SELECT id FROM reminders
+			WHERE fired_at IS NULL AND remind_at <= ?
+			ORDER BY remind_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, todo_item_id, remind_at`, now, now, w.BatchSize).
+		Scan(&claimed).Error
+	return claimed, err
+}
+
+func (w *Worker) fire(ctx context.Context, r models.Reminder) {
+	var todo models.TodoItem
+	if err := w.db.Select("id", "title", "is_done", "due_at").First(&todo, r.TodoItemID).Error; err != nil {
+		w.fail(r, err)
+		return
+	}
+
+	// The reminder is no longer useful once the todo is done.
+	if todo.IsDone {
+		return
+	}
+
+	err := w.notifier.Notify(ctx, Notification{
+		ReminderID: r.ID,
+		TodoID:     todo.ID,
+		Title:      todo.Title,
+		DueAt:      todo.DueAt,
+		RemindAt:   r.RemindAt,
+	})
+	if err != nil {
+		w.fail(r, err)
+		return
+	}
+
+	middleware.RemindersFired.Inc()
+}
+
+func (w *Worker) fail(r models.Reminder, err error) {
+	middleware.RemindersFailed.Inc()
+	log.Printf("error in firing reminder %d: %v", r.ID, err)
+
+	if err := w.db.Model(&r).Update("last_error", err.Error()).Error; err != nil {
+		log.Printf("error in recording failure of reminder %d: %v", r.ID, err)
+	}
+}
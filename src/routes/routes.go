@@ -1,9 +1,16 @@
 package routes
 
 import (
+	"github.com/alirezamastery/graph_task/auth"
+	adminctrl "github.com/alirezamastery/graph_task/controllers/admin"
+	authctrl "github.com/alirezamastery/graph_task/controllers/auth"
+	projectctrl "github.com/alirezamastery/graph_task/controllers/project"
 	"github.com/alirezamastery/graph_task/controllers/swagger"
+	tagctrl "github.com/alirezamastery/graph_task/controllers/tag"
 	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
 	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/workflow"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerfiles "github.com/swaggo/files"
@@ -13,7 +20,9 @@ import (
 	"os"
 )
 
-func SetupRoutes(db *gorm.DB) *gin.Engine {
+// SetupRoutes mounts the API. issuer is nil when tokens are issued by an
+// OpenID Connect provider, in which case users have no passwords here.
+func SetupRoutes(db *gorm.DB, wf *workflow.Workflow, verifier auth.Verifier, issuer *auth.Issuer) *gin.Engine {
 	if os.Getenv("DEBUG") == "true" {
 		gin.SetMode(gin.DebugMode)
 	} else {
@@ -24,19 +33,105 @@ func SetupRoutes(db *gorm.DB) *gin.Engine {
 	router.Use(otelgin.Middleware("todo-api"))
 	router.Use(middleware.MetricsMiddleware())
 
-	middleware.SetupMiddlewares(router)
+	middleware.SetupMiddlewares(router, db, verifier)
+
+	// Create requests can be retried safely with an Idempotency-Key header.
+	idempotent := middleware.Idempotency(db, middleware.IdempotencyTTLFromEnv())
+
+	// Every route requires a scope, access tokens of users carry all of them.
+	readTodos, writeTodos := middleware.RequireScope(auth.ScopeTodosRead), middleware.RequireScope(auth.ScopeTodosWrite)
+	readTags, writeTags := middleware.RequireScope(auth.ScopeTagsRead), middleware.RequireScope(auth.ScopeTagsWrite)
+	readProjects, writeProjects := middleware.RequireScope(auth.ScopeProjectsRead), middleware.RequireScope(auth.ScopeProjectsWrite)
+	readKeys, writeKeys := middleware.RequireScope(auth.ScopeKeysRead), middleware.RequireScope(auth.ScopeKeysWrite)
+	readUsers, writeUsers := middleware.RequireScope(auth.ScopeUsersRead), middleware.RequireScope(auth.ScopeUsersWrite)
+
+	// Handlers also check the permissions the role of the user grants.
+	policy := rbac.NewPolicy()
 
 	// API Routes:
 	apiRouter := router.Group("/api")
 
+	account := authctrl.NewAuthController(db, issuer)
+	authRouter := apiRouter.Group("/auth")
+	{
+		if issuer != nil {
+			authRouter.POST("/register", account.Register())
+			authRouter.POST("/login", account.Login())
+			authRouter.POST("/refresh", account.Refresh())
+			authRouter.POST("/logout", account.Logout())
+		}
+		authRouter.GET("/me", readUsers, account.GetCurrentUser())
+
+		authRouter.GET("/keys", readKeys, account.ListAPIKeys())
+		authRouter.POST("/keys", writeKeys, account.CreateAPIKey())
+		authRouter.DELETE("/keys/:id", writeKeys, account.RevokeAPIKey())
+	}
+
 	todo := todoctrl.NewTodoController(db)
+	todo.UseWorkflow(wf)
+	todo.UsePolicy(policy)
 	todoRouter := apiRouter.Group("/task")
 	{
-		todoRouter.GET("/todos", todo.GetTodoItemList())
-		todoRouter.POST("/todos", todo.CreateTodo())
-		todoRouter.GET("/todos/:id", todo.GetTodoItemByID())
-		todoRouter.PATCH("/todos/:id", todo.UpdateTodoItem())
-		todoRouter.DELETE("/todos/:id", todo.DeleteTodoItem())
+		todoRouter.GET("/workflow", readTodos, todo.GetWorkflow())
+		todoRouter.GET("/todos", readTodos, todo.GetTodoItemList())
+		todoRouter.GET("/todos/order", readTodos, todo.GetTodoExecutionOrder())
+		todoRouter.GET("/todos/export", readTodos, todo.ExportTodoGraph())
+		todoRouter.GET("/todos/search", readTodos, todo.SearchTodos())
+		todoRouter.POST("/todos", writeTodos, idempotent, todo.CreateTodo())
+		todoRouter.POST("/todos/bulk", writeTodos, idempotent, todo.BulkCreateTodos())
+		todoRouter.PATCH("/todos/bulk", writeTodos, todo.BulkUpdateTodos())
+		todoRouter.DELETE("/todos/bulk", writeTodos, todo.BulkDeleteTodos())
+		todoRouter.GET("/todos/:id", readTodos, todo.GetTodoItemByID())
+		todoRouter.PATCH("/todos/:id", writeTodos, todo.UpdateTodoItem())
+		todoRouter.DELETE("/todos/:id", writeTodos, todo.DeleteTodoItem())
+
+		todoRouter.GET("/todos/:id/dependencies", readTodos, todo.ListTodoDependencies())
+		todoRouter.POST("/todos/:id/dependencies", writeTodos, todo.AddTodoDependency())
+		todoRouter.DELETE("/todos/:id/dependencies/:dep_id", writeTodos, todo.RemoveTodoDependency())
+
+		todoRouter.GET("/todos/:id/occurrences", readTodos, todo.ListTodoOccurrences())
+
+		todoRouter.GET("/todos/:id/reminders", readTodos, todo.ListTodoReminders())
+		todoRouter.POST("/todos/:id/reminders", writeTodos, todo.AddTodoReminder())
+		todoRouter.DELETE("/todos/:id/reminders/:reminder_id", writeTodos, todo.RemoveTodoReminder())
+
+		todoRouter.GET("/todos/:id/children", readTodos, todo.ListTodoChildren())
+		todoRouter.GET("/todos/:id/subtree", readTodos, todo.GetTodoSubtree())
+		todoRouter.POST("/todos/:id/move", writeTodos, todo.MoveTodoSubtree())
+	}
+
+	tag := tagctrl.NewTagController(db, policy)
+	tagRouter := apiRouter.Group("/task")
+	{
+		tagRouter.GET("/tags", readTags, tag.GetTagList())
+		tagRouter.POST("/tags", writeTags, idempotent, tag.CreateTag())
+		tagRouter.GET("/tags/:id", readTags, tag.GetTagByID())
+		tagRouter.PATCH("/tags/:id", writeTags, tag.UpdateTag())
+		tagRouter.DELETE("/tags/:id", writeTags, tag.DeleteTag())
+	}
+
+	project := projectctrl.NewProjectController(db, policy)
+	projectRouter := apiRouter.Group("/projects")
+	{
+		projectRouter.GET("", readProjects, project.GetProjectList())
+		projectRouter.POST("", writeProjects, idempotent, project.CreateProject())
+		projectRouter.GET("/:pid", readProjects, project.GetProjectByID())
+		projectRouter.PATCH("/:pid", writeProjects, project.UpdateProject())
+		projectRouter.DELETE("/:pid", writeProjects, project.DeleteProject())
+
+		projectRouter.GET("/:pid/todos", readTodos, todo.ListProjectTodos())
+		projectRouter.POST("/:pid/todos", writeTodos, idempotent, todo.CreateProjectTodo())
+	}
+
+	admin := adminctrl.NewAdminController(db, policy)
+	adminRouter := apiRouter.Group("/admin")
+	{
+		adminRouter.GET("/roles", readUsers, admin.ListRoles())
+		adminRouter.GET("/users", readUsers, admin.ListUsers())
+		if issuer != nil {
+			adminRouter.POST("/users", writeUsers, admin.CreateUser())
+		}
+		adminRouter.PUT("/users/:id/role", writeUsers, admin.SetUserRole())
 	}
 
 	// Swagger:
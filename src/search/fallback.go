@@ -0,0 +1,188 @@
+package search
+
+import (
+	"github.com/alirezamastery/graph_task/tenant"
+	"gorm.io/gorm"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MaxCandidates caps the rows the fallback ranks in memory. Matches past it,
+// by ID, are counted but not returned.
+const MaxCandidates = 1000
+
+// snippetRadius is the number of characters kept around the first match of a
+// description.
+const snippetRadius = 60
+
+// Fallback is a portable searcher for backends without full-text search. Every
+// word of the query must appear in the title or the description; matches in
+// the title weigh more. It is meant for development and tests, not for large
+// tables.
+type Fallback struct{}
+
+type candidate struct {
+	ID          uint
+	Title       string
+	Description string
+}
+
+func (Fallback) Search(db *gorm.DB, query string, limit, offset int) ([]Hit, int64, error) {
+	terms := splitTerms(query)
+	if len(terms) == 0 {
+		return []Hit{}, 0, nil
+	}
+
+	q := db.Table("todo_items").Scopes(tenant.Table("todo_items"))
+	for _, term := range terms {
+		pattern := "%" + term + "%"
+		q = q.Where("LOWER(title) LIKE ? OR LOWER(description) LIKE ?", pattern, pattern)
+	}
+	q = q.Session(&gorm.Session{})
+
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var candidates []candidate
+	if err := q.Select("id", "title", "description").Order("id").Limit(MaxCandidates).Scan(&candidates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	hits := make([]Hit, 0, len(candidates))
+	for _, c := range candidates {
+		hits = append(hits, Hit{
+			ID:      c.ID,
+			Title:   highlight(c.Title, terms),
+			Snippet: highlight(snippet(c.Description, terms), terms),
+			Rank:    rank(c, terms),
+		})
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Rank != hits[j].Rank {
+			return hits[i].Rank > hits[j].Rank
+		}
+		return hits[i].ID < hits[j].ID
+	})
+
+	if offset >= len(hits) {
+		return []Hit{}, total, nil
+	}
+	return hits[offset:min(offset+limit, len(hits))], total, nil
+}
+
+// splitTerms lower-cases the query and splits it into words, dropping LIKE
+// wildcards.
+func splitTerms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+// rank scores a match: every occurrence in the title counts twice as much as
+// one in the description, normalized by the text length.
+func rank(c candidate, terms []string) float64 {
+	title := strings.ToLower(c.Title)
+	desc := strings.ToLower(c.Description)
+
+	var score float64
+	for _, term := range terms {
+		score += 2*float64(strings.Count(title, term)) + float64(strings.Count(desc, term))
+	}
+	return score / (1 + float64(len(strings.Fields(title))+len(strings.Fields(desc)))/10)
+}
+
+// snippet cuts the text around the first match.
+func snippet(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+
+	first := -1
+	for _, term := range terms {
+		if i := indexRunes(lower, []rune(term)); i >= 0 && (first < 0 || i < first) {
+			first = i
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	start := max(first-snippetRadius, 0)
+	end := min(first+snippetRadius, len(runes))
+	s := string(runes[start:end])
+	if start > 0 {
+		s = "…" + s
+	}
+	if end < len(runes) {
+		s += "…"
+	}
+	return s
+}
+
+// highlight escapes the text and wraps every case-insensitive occurrence of
+// the terms in the highlight markers.
+func highlight(text string, terms []string) string {
+	runes := []rune(text)
+	lower := []rune(strings.ToLower(text))
+	if len(lower) != len(runes) {
+		// Lower-casing changed the length, positions would not line up.
+		return html.EscapeString(text)
+	}
+
+	marked := make([]bool, len(runes))
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); {
+			j := indexRunes(lower[i:], t)
+			if j < 0 {
+				break
+			}
+			for k := i + j; k < i+j+len(t); k++ {
+				marked[k] = true
+			}
+			i += j + len(t)
+		}
+	}
+
+	var sb strings.Builder
+	for i, r := range runes {
+		if marked[i] && (i == 0 || !marked[i-1]) {
+			sb.WriteString(StartSel)
+		}
+		sb.WriteString(html.EscapeString(string(r)))
+		if marked[i] && (i == len(runes)-1 || !marked[i+1]) {
+			sb.WriteString(StopSel)
+		}
+	}
+	return sb.String()
+}
+
+func indexRunes(s, sub []rune) int {
+	if len(sub) == 0 {
+		return -1
+	}
+	for i := 0; i+len(sub) <= len(s); i++ {
+		match := true
+		for j := range sub {
+			if s[i+j] != sub[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"fmt"
+	"github.com/alirezamastery/graph_task/tenant"
+	"gorm.io/gorm"
+)
+
+// Config is the text search configuration used for the search_vector column
+// and for parsing queries. Both sides must use the same one.
+const Config = "english"
+
+// VectorColumnSQL adds the generated tsvector column. Title words weigh more
+// than description words.
+var VectorColumnSQL = fmt.Sprintf(`ALTER TABLE todo_items ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('%[1]s', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('%[1]s', coalesce(description, '')), 'B')
+	) STORED`, Config)
+
+// IndexSQL creates the GIN index used by the @@ match.
+const IndexSQL = `CREATE INDEX IF NOT EXISTS idx_todo_items_search_vector ON todo_items USING GIN (search_vector)`
+
+// headlineOptions mark matches with control characters rather than the
+// highlight markers, since ts_headline doesn't escape the text around them.
+var headlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=25, MinWords=10, MaxFragments=2", startMark, stopMark)
+
+// Postgres searches with tsquery against the indexed search_vector column.
+// Queries use the websearch syntax: words, "quoted phrases", OR and -word.
+type Postgres struct{}
+
+func (Postgres) Search(db *gorm.DB, query string, limit, offset int) ([]Hit, int64, error) {
+	tsQuery := fmt.Sprintf("websearch_to_tsquery('%s', ?)", Config)
+
+	var total int64
+	if err := db.Table("todo_items").
+		Scopes(tenant.Table("todo_items")).
+		Where("search_vector @@ "+tsQuery, query).
+		Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Raw SQL isn't scoped by the tenant plugin.
+	where, args := "search_vector @@ q", []any{headlineOptions + ", HighlightAll=true", headlineOptions, query}
+	if workspaceID, ok := tenant.ID(db); ok {
+		where, args = where+" AND workspace_id = ?", append(args, workspaceID)
+	}
+
+	hits := []Hit{}
+	err := db.Raw(fmt.Sprintf(`
+		SELECT id,
+			ts_headline('%[1]s', title, q, ?) AS title,
+			ts_headline('%[1]s', description, q, ?) AS snippet,
+			ts_rank(search_vector, q) AS rank
+		FROM todo_items, %[2]s AS q
+		WHERE %[3]s
+		ORDER BY rank DESC, id
+		LIMIT ? OFFSET ?`, Config, tsQuery, where),
+		append(args, limit, offset)...).
+		Scan(&hits).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range hits {
+		hits[i].Title = markup(hits[i].Title)
+		hits[i].Snippet = markup(hits[i].Snippet)
+	}
+	return hits, total, nil
+}
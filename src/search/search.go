@@ -0,0 +1,78 @@
+// Package search implements relevance ranked full-text search over todo titles
+// and descriptions.
+//
+// On Postgres it uses the search_vector column (a tsvector generated from the
+// title and the description, with a GIN index) created by db.MigrateDB. Other
+// backends get a portable LIKE based fallback that ranks and highlights in Go.
+package search
+
+import (
+	"gorm.io/gorm"
+	"html"
+	"strings"
+)
+
+// Highlight markers around matched words in titles and snippets.
+const (
+	StartSel = "<b>"
+	StopSel  = "</b>"
+)
+
+// Control characters standing in for the highlight markers until the text
+// around them is escaped.
+const (
+	startMark = "\x02"
+	stopMark  = "\x03"
+)
+
+// Hit is a todo matching a search, with the matched words of its title and a
+// fragment of its description highlighted. Both are HTML-escaped, so that the
+// highlight markers are the only markup in them.
+type Hit struct {
+	ID      uint    `json:"id" example:"3"`
+	Title   string  `json:"title" example:"<b>release</b> notes"`
+	Snippet string  `json:"snippet" example:"write the <b>release</b> notes for v2"`
+	Rank    float64 `json:"rank" example:"0.6"`
+}
+
+// Searcher finds the todos matching a free text query, best match first.
+type Searcher interface {
+	Search(db *gorm.DB, query string, limit, offset int) ([]Hit, int64, error)
+}
+
+// For returns the searcher suited to the database's backend.
+func For(db *gorm.DB) Searcher {
+	if db.Dialector.Name() == "postgres" {
+		return Postgres{}
+	}
+	return Fallback{}
+}
+
+// markup escapes text highlighted with startMark and stopMark and turns the
+// marks into the highlight markers. Marks that don't pair up, such as ones
+// the text had already, are dropped or closed.
+func markup(text string) string {
+	var sb strings.Builder
+	open := false
+	for text != "" {
+		i := strings.IndexAny(text, startMark+stopMark)
+		if i < 0 {
+			sb.WriteString(html.EscapeString(text))
+			break
+		}
+		sb.WriteString(html.EscapeString(text[:i]))
+		switch mark := text[i : i+1]; {
+		case mark == startMark && !open:
+			sb.WriteString(StartSel)
+			open = true
+		case mark == stopMark && open:
+			sb.WriteString(StopSel)
+			open = false
+		}
+		text = text[i+1:]
+	}
+	if open {
+		sb.WriteString(StopSel)
+	}
+	return sb.String()
+}
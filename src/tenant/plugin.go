@@ -0,0 +1,102 @@
+package tenant
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"reflect"
+)
+
+// Plugin scopes the queries, updates and deletes of the models with a
+// workspace_id column to the workspace of their context, and sets it on the
+// records they create. Raw SQL is left alone.
+type Plugin struct{}
+
+func (Plugin) Name() string {
+	return "tenant"
+}
+
+func (Plugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", scope); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", scope); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", scopeConditioned); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:delete", scopeConditioned); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:create", assign)
+}
+
+// field returns the workspace of the statement and the field holding it, nil
+// when either is missing.
+func field(db *gorm.DB) (uint, *schema.Field) {
+	id, ok := ID(db)
+	if !ok || db.Statement.Schema == nil {
+		return 0, nil
+	}
+	return id, db.Statement.Schema.LookUpField(Column)
+}
+
+func scope(db *gorm.DB) {
+	if id, f := field(db); f != nil {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: id},
+		}})
+	}
+}
+
+// scopeConditioned scopes updates and deletes that already have conditions.
+// gorm refuses the ones without, unless AllowGlobalUpdate is set, and the
+// workspace condition must not lift that.
+func scopeConditioned(db *gorm.DB) {
+	if db.AllowGlobalUpdate || hasConditions(db) {
+		scope(db)
+	}
+}
+
+func hasConditions(db *gorm.DB) bool {
+	if _, ok := db.Statement.Clauses["WHERE"]; ok {
+		return true
+	}
+	if db.Statement.Schema == nil {
+		return false
+	}
+	fields := db.Statement.Schema.PrimaryFields
+	if _, values := schema.GetIdentityFieldValuesMap(db.Statement.Context, db.Statement.ReflectValue, fields); len(values) > 0 {
+		return true
+	}
+	if db.Statement.Model != nil {
+		_, values := schema.GetIdentityFieldValuesMap(db.Statement.Context, reflect.ValueOf(db.Statement.Model), fields)
+		return len(values) > 0
+	}
+	return false
+}
+
+// assign puts the records being created in the workspace, whatever they say.
+func assign(db *gorm.DB) {
+	id, f := field(db)
+	if f == nil {
+		return
+	}
+
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := f.Set(db.Statement.Context, reflect.Indirect(rv.Index(i)), id); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := f.Set(db.Statement.Context, rv, id); err != nil {
+			_ = db.AddError(err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Package tenant isolates the data of workspaces. The workspace of a request
+// is carried by its context; the Plugin scopes every query run with that
+// context to it, so that the data of other workspaces can't be read, changed
+// or referred to. Queries run without a workspace, such as the ones of
+// migrations and background jobs, are not scoped.
+package tenant
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// Column is the column of the models scoped to a workspace.
+const Column = "workspace_id"
+
+type contextKey struct{}
+
+// WithWorkspace returns a context scoped to the workspace.
+func WithWorkspace(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the workspace a context is scoped to, if any.
+func FromContext(ctx context.Context) (uint, bool) {
+	id, ok := ctx.Value(contextKey{}).(uint)
+	return id, ok && id != 0
+}
+
+// ID returns the workspace the queries of db are scoped to, if any.
+func ID(db *gorm.DB) (uint, bool) {
+	if db.Statement.Context == nil {
+		return 0, false
+	}
+	return FromContext(db.Statement.Context)
+}
+
+// Table scopes a query built on a table name rather than a model, which the
+// Plugin can't recognize, to the workspace of db.
+func Table(table string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if id, ok := ID(db); ok {
+			return db.Where(table+"."+Column+" = ?", id)
+		}
+		return db
+	}
+}
@@ -0,0 +1,23 @@
+package tenant
+
+import (
+	"github.com/alirezamastery/graph_task/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateWorkspace creates a workspace along with its default project. It
+// returns false, creating nothing, when a workspace with the same external
+// identity exists. It is meant to be called in a transaction, with a db that
+// isn't scoped to another workspace.
+func CreateWorkspace(tx *gorm.DB, workspace *models.Workspace) (bool, error) {
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(workspace)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	inbox := models.Project{WorkspaceID: workspace.ID, Name: models.DefaultProjectName, IsDefault: true}
+	if err := tx.Create(&inbox).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
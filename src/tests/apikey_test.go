@@ -0,0 +1,203 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/alirezamastery/graph_task/auth"
+	authctrl "github.com/alirezamastery/graph_task/controllers/auth"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/problem"
+)
+
+var apiKeyColumns = []string{"id", "user_id", "name", "prefix", "key_hash", "scopes", "expires_at", "last_used_at"}
+
+func setupScopedRouter(db *gorm.DB, issuer *auth.Issuer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Authentication(issuer, db))
+
+	account := authctrl.NewAuthController(db, issuer)
+	r.GET("/api/auth/me", middleware.RequireScope(auth.ScopeUsersRead), account.GetCurrentUser())
+	r.POST("/api/auth/keys", middleware.RequireScope(auth.ScopeKeysWrite), account.CreateAPIKey())
+	r.GET("/api/task/todos", middleware.RequireScope(auth.ScopeTodosRead), func(c *gin.Context) {
+		id, _ := auth.UserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": id})
+	})
+	r.DELETE("/api/task/todos/:id", middleware.RequireScope(auth.ScopeTodosWrite), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+	return r
+}
+
+func sendWithAPIKey(router *gin.Engine, method, path, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.APIKeyHeader, key)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func expectAPIKey(mock sqlmock.Sqlmock, key string, rows *sqlmock.Rows) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "api_keys" WHERE key_hash = $1 AND revoked_at IS NULL`)).
+		WithArgs(auth.HashAPIKey(key), 1).
+		WillReturnRows(rows)
+}
+
+func TestCreateAPIKey_201_ReturnsKeyOnceAndStoresHash(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupScopedRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(7)
+
+	ExpectPrincipal(mock, 7, "editor", 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "api_keys"`)).
+		WithArgs(7, "ci bot", sqlmock.AnyArg(), sqlmock.AnyArg(), "todos:read,todos:write", nil, nil, nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/keys", token,
+		`{"name":" ci bot ","scopes":["todos:write","todos:read","todos:read"]}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp authctrl.APIKeyResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if !strings.HasPrefix(resp.Key, auth.APIKeyPrefix) || !strings.HasPrefix(resp.Key, resp.Prefix) {
+		t.Fatalf("expected a key starting with its prefix, got key=%q prefix=%q", resp.Key, resp.Prefix)
+	}
+	if !equalStrings(resp.Scopes, []string{"todos:read", "todos:write"}) {
+		t.Fatalf("expected sorted, unique scopes, got %v", resp.Scopes)
+	}
+	if strings.Contains(recorder.Body.String(), "key_hash") {
+		t.Fatalf("expected the hash to stay private, body=%s", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestCreateAPIKey_400_UnknownScope_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupScopedRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(7)
+
+	ExpectPrincipal(mock, 7, "editor", 1)
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/keys", token, `{"name":"ci","scopes":["todos:admin"]}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); len(p.Errors) != 1 || p.Errors[0].Field != "scopes" {
+		t.Fatalf("expected an error on scopes, got %+v", p.Errors)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestAPIKey_GrantsOnlyItsScopes(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupScopedRouter(db, newTestIssuer())
+	key := "gt_read-only-key"
+	row := func(lastUsed any) *sqlmock.Rows {
+		return sqlmock.NewRows(apiKeyColumns).
+			AddRow(3, 7, "ci", "gt_read-o", auth.HashAPIKey(key), "todos:read,keys:write", nil, lastUsed)
+	}
+
+	// The first use is recorded.
+	expectAPIKey(mock, key, row(nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "api_keys" SET "last_used_at"=$1 WHERE "id" = $2`)).
+		WithArgs(sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ExpectPrincipal(mock, 7, "editor", 1)
+
+	recorder := sendWithAPIKey(router, http.MethodGet, "/api/task/todos", key, "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"user_id":7`) {
+		t.Fatalf("expected 200 as user 7, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// A use right after is not.
+	expectAPIKey(mock, key, row(time.Now()))
+	ExpectPrincipal(mock, 7, "editor", 1)
+
+	recorder = sendWithAPIKey(router, http.MethodDelete, "/api/task/todos/1", key, "")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeInsufficientScope {
+		t.Fatalf("expected code %s, got %s", problem.CodeInsufficientScope, p.Code)
+	}
+
+	// Nor can it create a key with more scopes than it has.
+	expectAPIKey(mock, key, row(time.Now()))
+	ExpectPrincipal(mock, 7, "editor", 1)
+
+	recorder = sendWithAPIKey(router, http.MethodPost, "/api/auth/keys", key, `{"name":"escalate","scopes":["todos:write"]}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// Nor read the account of its user.
+	expectAPIKey(mock, key, row(time.Now()))
+	ExpectPrincipal(mock, 7, "editor", 1)
+
+	recorder = sendWithAPIKey(router, http.MethodGet, "/api/auth/me", key, "")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeInsufficientScope {
+		t.Fatalf("expected code %s, got %s", problem.CodeInsufficientScope, p.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestAPIKey_401_UnknownOrExpired(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupScopedRouter(db, newTestIssuer())
+
+	expectAPIKey(mock, "gt_revoked", sqlmock.NewRows(apiKeyColumns))
+	expectAPIKey(mock, "gt_expired", sqlmock.NewRows(apiKeyColumns).
+		AddRow(4, 7, "old", "gt_expire", auth.HashAPIKey("gt_expired"), "todos:read", time.Now().Add(-time.Hour), nil))
+
+	for _, key := range []string{"gt_revoked", "gt_expired"} {
+		recorder := sendWithAPIKey(router, http.MethodGet, "/api/task/todos", key, "")
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: expected 401, got %d, body=%s", key, recorder.Code, recorder.Body.String())
+		}
+		if p := decodeProblem(t, recorder); p.Code != problem.CodeInvalidToken {
+			t.Fatalf("%s: expected code %s, got %s", key, problem.CodeInvalidToken, p.Code)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/alirezamastery/graph_task/auth"
+	authctrl "github.com/alirezamastery/graph_task/controllers/auth"
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/problem"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestIssuer() *auth.Issuer {
+	return auth.NewIssuer(testSecret, 15*time.Minute, time.Hour)
+}
+
+func setupAuthRouter(db *gorm.DB, issuer *auth.Issuer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Authentication(issuer, db))
+
+	account := authctrl.NewAuthController(db, issuer)
+	r.POST("/api/auth/register", account.Register())
+	r.POST("/api/auth/login", account.Login())
+	r.POST("/api/auth/refresh", account.Refresh())
+	r.GET("/api/auth/me", middleware.RequireScope(auth.ScopeUsersRead), account.GetCurrentUser())
+	r.POST("/api/task/todos", todoctrl.NewTodoController(db).CreateTodo())
+	return r
+}
+
+func sendJSON(router *gin.Engine, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestIssuer_VerifiesOnlyUntamperedLiveTokens(t *testing.T) {
+	issuer := newTestIssuer()
+
+	token, _, err := issuer.AccessToken(42)
+	if err != nil {
+		t.Fatalf("signing failed: %v", err)
+	}
+	if id, err := issuer.Verify(token); err != nil || id != 42 {
+		t.Fatalf("expected user 42, got %d, %v", id, err)
+	}
+
+	parts := strings.Split(token, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"graph-task","sub":"1","iat":0,"exp":99999999999}`))
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	other := auth.NewIssuer([]byte("another-secret-another-secret-xx"), time.Minute, time.Hour)
+	otherToken, _, _ := other.AccessToken(42)
+
+	for name, bad := range map[string]string{
+		"payload":   parts[0] + "." + forged + "." + parts[2],
+		"alg none":  none + "." + parts[1] + ".",
+		"secret":    otherToken,
+		"malformed": "not-a-token",
+	} {
+		if _, err := issuer.Verify(bad); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	expired := auth.NewIssuer(testSecret, -time.Minute, time.Hour)
+	old, _, _ := expired.AccessToken(42)
+	if _, err := issuer.Verify(old); !errors.Is(err, auth.ErrExpiredToken) {
+		t.Fatalf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestAuthentication_401_WithoutToken_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupAuthRouter(db, newTestIssuer())
+
+	for _, token := range []string{"", "garbage"} {
+		recorder := sendJSON(router, http.MethodPost, "/api/task/todos", token, `{"title":"x"}`)
+		if recorder.Code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d, body=%s", recorder.Code, recorder.Body.String())
+		}
+		if !strings.HasPrefix(recorder.Header().Get("WWW-Authenticate"), "Bearer") {
+			t.Fatalf("expected a Bearer challenge, got %q", recorder.Header().Get("WWW-Authenticate"))
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestCreateTodo_201_RecordsOwner(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupAuthRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(42)
+
+	args := make([]driver.Value, 16)
+	for i := range args {
+		args[i] = sqlmock.AnyArg()
+	}
+	args[0], args[15] = 3, 42
+
+	ExpectPrincipal(mock, 42, "editor", 3)
+	ExpectWorkspaceDefaultProject(mock, 3, 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPost, "/api/task/todos", token, `{"title":"mine"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp map[string]any
+	_ = json.Unmarshal(recorder.Body.Bytes(), &resp)
+	if resp["owner_id"] != float64(42) {
+		t.Fatalf("expected owner_id=42, got %#v", resp["owner_id"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestRegister_201_StoresHashOnly(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupAuthRouter(db, newTestIssuer())
+
+	// The user gets a workspace of their own, with an inbox, and is its admin.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "workspaces" ("name","external_issuer","external_id","created_at","updated_at") VALUES ($1,$2,$3,$4,$5) ON CONFLICT DO NOTHING`)).
+		WithArgs("Lovelace & co", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "projects"`)).
+		WithArgs(4, "Inbox", "", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(4, "ada@example.com", sqlmock.AnyArg(), "admin", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/register", "",
+		`{"email":" Ada@Example.com ","password":"correct horse","workspace":" Lovelace & co "}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if strings.Contains(recorder.Body.String(), "password") || strings.Contains(recorder.Body.String(), "$2a$") {
+		t.Fatalf("expected no password in the response, body=%s", recorder.Body.String())
+	}
+	if !strings.Contains(recorder.Body.String(), `"workspace_id":4`) {
+		t.Fatalf("expected the new workspace in the response, body=%s", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestRegister_400_ShortPassword_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupAuthRouter(db, newTestIssuer())
+
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/register", "", `{"email":"ada@example.com","password":"short"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); len(p.Errors) != 1 || p.Errors[0].Field != "password" {
+		t.Fatalf("expected an error on password, got %+v", p.Errors)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestLogin_IssuesTokensOnlyForTheRightPassword(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupAuthRouter(db, issuer)
+
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatalf("hashing failed: %v", err)
+	}
+	userRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "email", "password_hash"}).AddRow(7, "ada@example.com", hash)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WithArgs("ada@example.com", 1).
+		WillReturnRows(userRows())
+
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/login", "", `{"email":"ada@example.com","password":"wrong horse"}`)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeInvalidCredentials {
+		t.Fatalf("expected code %s, got %s", problem.CodeInvalidCredentials, p.Code)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email = $1`)).
+		WithArgs("ada@example.com", 1).
+		WillReturnRows(userRows())
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "refresh_tokens"`)).
+		WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	recorder = sendJSON(router, http.MethodPost, "/api/auth/login", "", `{"email":"Ada@example.com","password":"correct horse"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp authctrl.TokenResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if id, err := issuer.Verify(resp.AccessToken); err != nil || id != 7 {
+		t.Fatalf("expected an access token for user 7, got %d, %v", id, err)
+	}
+	if resp.RefreshToken == "" || resp.TokenType != "Bearer" || resp.ExpiresIn != 900 {
+		t.Fatalf("unexpected token response %+v", resp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestRefresh_RotatesTheRefreshToken(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupAuthRouter(db, newTestIssuer())
+
+	revoke := regexp.QuoteMeta(`UPDATE "refresh_tokens" SET "revoked_at"=$1 WHERE token_hash = $2 AND revoked_at IS NULL AND expires_at > $3 RETURNING "user_id"`)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(revoke).
+		WithArgs(sqlmock.AnyArg(), auth.HashRefreshToken("old"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "refresh_tokens"`)).
+		WithArgs(7, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPost, "/api/auth/refresh", "", `{"refresh_token":"old"}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// The same token can't be used twice.
+	mock.ExpectBegin()
+	mock.ExpectQuery(revoke).
+		WithArgs(sqlmock.AnyArg(), auth.HashRefreshToken("old"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+	mock.ExpectRollback()
+
+	recorder = sendJSON(router, http.MethodPost, "/api/auth/refresh", "", `{"refresh_token":"old"}`)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeInvalidToken {
+		t.Fatalf("expected code %s, got %s", problem.CodeInvalidToken, p.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
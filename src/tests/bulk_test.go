@@ -0,0 +1,311 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+)
+
+func doBulk(t *testing.T, router *gin.Engine, method, query, body string) (int, todoctrl.BulkResponse) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/task/todos/bulk"+query, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	var resp todoctrl.BulkResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	return recorder.Code, resp
+}
+
+func resultStatuses(resp todoctrl.BulkResponse) []int {
+	statuses := make([]int, len(resp.Results))
+	for i, r := range resp.Results {
+		statuses[i] = r.Status
+	}
+	return statuses
+}
+
+func TestBulkCreateTodos_201_InsertsInOneBatch(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	before := testutil.ToFloat64(middleware.TasksCount)
+
+	ExpectDefaultProject(mock, 1)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "project_id","title" FROM "todo_items" WHERE (project_id, title) IN (($1,$2),($3,$4))`)).
+		WithArgs(1, "a", 1, "b").
+		WillReturnRows(sqlmock.NewRows([]string{"project_id", "title"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`) + `.*\),\(.*` + regexp.QuoteMeta(`RETURNING "id"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10).AddRow(11))
+	mock.ExpectCommit()
+
+	code, resp := doBulk(t, router, http.MethodPost, "", `{"items":[{"title":"a"},{"title":" b "}]}`)
+
+	if code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%+v", code, resp)
+	}
+	if resp.Succeeded != 2 || resp.Results[0].ID != 10 || resp.Results[1].ID != 11 {
+		t.Fatalf("unexpected results: %+v", resp)
+	}
+	if after := testutil.ToFloat64(middleware.TasksCount); after != before+2 {
+		t.Fatalf("expected TasksCount +2, before=%v after=%v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkCreateTodos_400_AtomicRejectsEverything_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	code, resp := doBulk(t, router, http.MethodPost, "", `{"items":[{"title":"a"},{"title":"  "},{"title":"c","priority":9}]}`)
+
+	if code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%+v", code, resp)
+	}
+	want := []int{http.StatusFailedDependency, http.StatusBadRequest, http.StatusBadRequest}
+	if got := resultStatuses(resp); !equalInts(got, want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+	if resp.Failed != 3 || resp.Results[1].Error == nil {
+		t.Fatalf("unexpected results: %+v", resp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkCreateTodos_200_BestEffortSkipsConflicts(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	before := testutil.ToFloat64(middleware.TasksCount)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "projects" WHERE id IN ($1)`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "project_id","title" FROM "todo_items" WHERE (project_id, title) IN (($1,$2),($3,$4),($5,$6))`)).
+		WillReturnRows(sqlmock.NewRows([]string{"project_id", "title"}).AddRow(2, "taken"))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(20))
+	mock.ExpectCommit()
+
+	code, resp := doBulk(t, router, http.MethodPost, "?best_effort=true",
+		`{"items":[{"title":"taken","project_id":2},{"title":"new","project_id":2},{"title":"new","project_id":2}]}`)
+
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%+v", code, resp)
+	}
+	want := []int{http.StatusConflict, http.StatusCreated, http.StatusConflict}
+	if got := resultStatuses(resp); !equalInts(got, want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+	if resp.Results[1].ID != 20 || resp.Succeeded != 1 || resp.Failed != 2 {
+		t.Fatalf("unexpected results: %+v", resp)
+	}
+	if after := testutil.ToFloat64(middleware.TasksCount); after != before+1 {
+		t.Fatalf("expected TasksCount +1, before=%v after=%v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkUpdateTodos_409_RollsBackOnIllegalTransition(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1`)).
+		WithArgs(1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status"}).AddRow(1, "a", "todo"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "priority"=$1,"version"=version + 1,"updated_at"=$2 WHERE "id" = $3`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1`)).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status"}).AddRow(2, "b", "todo"))
+	mock.ExpectRollback()
+
+	code, resp := doBulk(t, router, http.MethodPatch, "",
+		`{"items":[{"id":1,"priority":4},{"id":2,"status":"in_review"},{"id":3,"priority":1}]}`)
+
+	if code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%+v", code, resp)
+	}
+	want := []int{http.StatusFailedDependency, http.StatusConflict, http.StatusFailedDependency}
+	if got := resultStatuses(resp); !equalInts(got, want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+	if resp.Results[1].Error.Code != "illegal_transition" || resp.Results[0].ID != 0 {
+		t.Fatalf("unexpected results: %+v", resp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkUpdateTodos_500_FailedCommitCountsNothing(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	before := testutil.ToFloat64(middleware.TasksCount)
+
+	due := time.Date(2026, 1, 31, 17, 0, 0, 0, time.UTC)
+	columns := []string{"id", "workspace_id", "project_id", "title", "status", "is_done", "priority", "due_at", "recurrence"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1`)).
+		WithArgs(3, 1).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 2, 1, "invoice (2026-01-31)", "todo", false, 2, due, "FREQ=MONTHLY;COUNT=3"))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(3, "invoice", false, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 2, 1, "invoice (2026-01-31)", "done", true, 2, due, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	code, resp := doBulk(t, router, http.MethodPatch, "", `{"items":[{"id":3,"is_done":true}]}`)
+
+	if code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d, body=%+v", code, resp)
+	}
+	if resp.Failed != 1 || resp.Results[0].NextID != nil {
+		t.Fatalf("unexpected results: %+v", resp)
+	}
+	if after := testutil.ToFloat64(middleware.TasksCount); after != before {
+		t.Fatalf("expected TasksCount unchanged, before=%v after=%v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkDeleteTodos_500_FailedCommitKeepsTheCount(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	before := testutil.ToFloat64(middleware.TasksCount)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","version" FROM "todo_items" WHERE id IN ($1,$2)`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(1, 1).AddRow(2, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "todo_items" WHERE id IN ($1,$2) RETURNING "id"`)).
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	body := []byte(`{"ids":[1,2]}`)
+	req := httptest.NewRequest(http.MethodDelete, "/api/task/todos/bulk", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if after := testutil.ToFloat64(middleware.TasksCount); after != before {
+		t.Fatalf("expected TasksCount unchanged, before=%v after=%v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestBulkDeleteTodos_AtomicAndBestEffort(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	before := testutil.ToFloat64(middleware.TasksCount)
+
+	// Atomic: one missing todo keeps the others.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","version" FROM "todo_items" WHERE id IN ($1,$2,$3)`)).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(1, 1).AddRow(3, 1))
+
+	code, resp := doBulk(t, router, http.MethodDelete, "", `{"ids":[1,2,3]}`)
+	if code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d, body=%+v", code, resp)
+	}
+	want := []int{http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency}
+	if got := resultStatuses(resp); !equalInts(got, want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+
+	// Best effort: the existing ones go.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","version" FROM "todo_items" WHERE id IN ($1,$2,$3)`)).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(1, 1).AddRow(3, 1))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM "todo_items" WHERE id IN ($1,$2) RETURNING "id"`)).
+		WithArgs(1, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+	mock.ExpectCommit()
+
+	code, resp = doBulk(t, router, http.MethodDelete, "?best_effort=true", `{"ids":[1,2,3,1]}`)
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%+v", code, resp)
+	}
+	want = []int{http.StatusNoContent, http.StatusNotFound, http.StatusNoContent, http.StatusBadRequest}
+	if got := resultStatuses(resp); !equalInts(got, want) {
+		t.Fatalf("expected statuses %v, got %v", want, got)
+	}
+	if after := testutil.ToFloat64(middleware.TasksCount); after != before-2 {
+		t.Fatalf("expected TasksCount -2, before=%v after=%v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
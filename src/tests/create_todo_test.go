@@ -24,6 +24,7 @@ func TestCreateTodo_201_InsertsAndIncrementsGauge(t *testing.T) {
 
 	before := testutil.ToFloat64(middleware.TasksCount)
 
+	ExpectDefaultProject(mock, 1)
 	mock.ExpectBegin()
 
 	mock.ExpectQuery(regexp.QuoteMeta("INSERT")).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
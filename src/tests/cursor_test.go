@@ -0,0 +1,172 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+)
+
+func getTodoList(t *testing.T, router *gin.Engine, query string) todoctrl.TodoListResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?"+query, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	var resp todoctrl.TodoListResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	return resp
+}
+
+func expectTagPreload(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+}
+
+func TestGetTodoItemList_200_CursorPagesForwardAndBack(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	t1 := time.Date(2026, 3, 3, 10, 0, 0, 0, time.UTC)
+	t2 := t1.Add(-time.Hour)
+
+	// First page, by number.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" ORDER BY created_at DESC, id ASC LIMIT $1`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "created_at"}).
+			AddRow(9, "a", t1).
+			AddRow(4, "b", t2))
+	expectTagPreload(mock)
+
+	first := getTodoList(t, router, "page_size=2")
+	if first.NextCursor == "" || first.PrevCursor != "" {
+		t.Fatalf("expected only a next cursor on the first page, got %+v", first)
+	}
+
+	// Next page, by cursor. Rows inserted meanwhile don't shift it.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(6))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE ((created_at < $1) OR (created_at = $2 AND id > $3)) ORDER BY created_at DESC, id ASC LIMIT $4`)).
+		WithArgs(t2, t2, int64(4), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "created_at"}).
+			AddRow(5, "c", t2).
+			AddRow(2, "d", t2.Add(-time.Hour)).
+			AddRow(1, "e", t2.Add(-2*time.Hour)))
+	expectTagPreload(mock)
+
+	second := getTodoList(t, router, "page_size=2&cursor="+url.QueryEscape(first.NextCursor))
+	if second.Page != 0 || len(second.Items) != 2 || second.Items[0].ID != 5 {
+		t.Fatalf("unexpected second page: %+v", second)
+	}
+	if second.NextCursor == "" || second.PrevCursor == "" {
+		t.Fatalf("expected both cursors on the second page, got %+v", second)
+	}
+
+	// And back, read in reverse and flipped.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(6))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE ((created_at > $1) OR (created_at = $2 AND id < $3)) ORDER BY created_at ASC, id DESC LIMIT $4`)).
+		WithArgs(t2, t2, int64(5), 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "created_at"}).
+			AddRow(4, "b", t2).
+			AddRow(9, "a", t1))
+	expectTagPreload(mock)
+
+	back := getTodoList(t, router, "page_size=2&cursor="+url.QueryEscape(second.PrevCursor))
+	if len(back.Items) != 2 || back.Items[0].ID != 9 || back.Items[1].ID != 4 {
+		t.Fatalf("unexpected previous page: %+v", back.Items)
+	}
+	if back.PrevCursor != "" || back.NextCursor == "" {
+		t.Fatalf("expected only a next cursor back on the first page, got %+v", back)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_200_CursorAfterNullDueDate(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" ORDER BY due_at ASC, id ASC LIMIT $1`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "due_at"}).AddRow(3, nil))
+	expectTagPreload(mock)
+
+	first := getTodoList(t, router, "sort=due_at&page_size=1")
+
+	// NULLs sort last ascending, so only other undated todos can follow.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE ((due_at IS NULL AND id > $1)) ORDER BY due_at ASC, id ASC LIMIT $2`)).
+		WithArgs(int64(3), 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "due_at"}))
+
+	next := getTodoList(t, router, "page_size=1&cursor="+url.QueryEscape(first.NextCursor))
+	if len(next.Items) != 0 || next.NextCursor != "" {
+		t.Fatalf("expected an empty last page, got %+v", next)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_400_BadCursor_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" ORDER BY created_at DESC, id ASC LIMIT $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	expectTagPreload(mock)
+
+	token := getTodoList(t, router, "page_size=1").NextCursor
+	tampered := []byte(token)
+	tampered[3] ^= 1
+
+	for _, query := range []string{
+		"cursor=" + url.QueryEscape(string(tampered)),
+		"cursor=garbage",
+		"sort=title&cursor=" + url.QueryEscape(token),
+		"page=2&cursor=" + url.QueryEscape(token),
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?"+query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d, body=%s", query, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/graph"
+)
+
+func TestAddTodoDependency_409_RejectsCycle(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock(hashtext('dependency_graph'), $1::int)")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "blocker_id","blocked_id" FROM "todo_dependencies"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id", "blocked_id"}).AddRow(2, 3).AddRow(3, 1))
+	mock.ExpectRollback()
+
+	// 1 -> 2 closes the existing chain 2 -> 3 -> 1.
+	body := []byte(`{"todo_id":1,"type":"blocked_by"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/2/dependencies", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.CycleErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	want := []uint{1, 2, 3, 1}
+	if len(resp.Cycle) != len(want) {
+		t.Fatalf("expected cycle %v, got %v", want, resp.Cycle)
+	}
+	for i := range want {
+		if resp.Cycle[i] != want[i] {
+			t.Fatalf("expected cycle %v, got %v", want, resp.Cycle)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestAddTodoDependency_400_SelfDependency_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	body := []byte(`{"todo_id":4}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/4/dependencies", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemByID_200_ReportsOpenBlockers(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description", "is_done"}).
+			AddRow(5, "ship", "", false))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "todo_dependencies"."blocker_id" FROM "todo_dependencies" JOIN todo_items`)).
+		WithArgs(5, false).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(5, "ship", false))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/5", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if resp["is_blocked"] != true {
+		t.Fatalf("expected is_blocked=true, got %#v", resp["is_blocked"])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGraphCycleWith(t *testing.T) {
+	g := graph.New()
+	g.AddEdge(1, 2)
+	g.AddEdge(2, 3)
+
+	if cycle := g.CycleWith(1, 3); cycle != nil {
+		t.Fatalf("expected 1 -> 3 to be allowed, got cycle %v", cycle)
+	}
+	if cycle := g.CycleWith(3, 1); len(cycle) != 4 {
+		t.Fatalf("expected 3 -> 1 to close a cycle, got %v", cycle)
+	}
+}
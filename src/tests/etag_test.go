@@ -0,0 +1,213 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+)
+
+func sendWithIfMatch(router *gin.Engine, method, path, ifMatch, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func versionedTodoRows(version uint) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "title", "status", "version"}).AddRow(1, "a", "todo", version)
+}
+
+func TestGetTodoItemByID_200_ReturnsETag(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnRows(versionedTodoRows(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectQuery("todo_dependencies").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(1, "a", false, nil))
+
+	recorder := sendWithIfMatch(router, http.MethodGet, "/api/task/todos/1", "", "")
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if etag := recorder.Header().Get("ETag"); etag != `"3"` {
+		t.Fatalf(`expected ETag "3", got %q`, etag)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_412_StaleIfMatch_NoWrite(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 ORDER BY "todo_items"."id" LIMIT $2 FOR UPDATE`)).
+		WillReturnRows(versionedTodoRows(3))
+	mock.ExpectRollback()
+
+	recorder := sendWithIfMatch(router, http.MethodPatch, "/api/task/todos/1", `"2"`, `{"priority":4}`)
+
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if etag := recorder.Header().Get("ETag"); etag != `"3"` {
+		t.Fatalf(`expected the current ETag "3", got %q`, etag)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_412_ChangedConcurrently(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	// The version matches when read, but someone else writes first.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnRows(versionedTodoRows(3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "priority"=$1,"version"=version + 1,"updated_at"=$2 WHERE version = $3 AND "id" = $4`)).
+		WithArgs(4, sqlmock.AnyArg(), 3, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	recorder := sendWithIfMatch(router, http.MethodPatch, "/api/task/todos/1", `W/"1", "3"`, `{"priority":4}`)
+
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_SavesTheTrimmedTitle(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnRows(versionedTodoRows(3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "title"=$1,"version"=version + 1,"updated_at"=$2 WHERE "id" = $3`)).
+		WithArgs("b", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "title", "status", "version"}).AddRow(1, "b", "todo", 4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	recorder := sendWithIfMatch(router, http.MethodPatch, "/api/task/todos/1", "", `{"title":"  b  "}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_500_ReloadFails_RolledBack(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	// The todo is reloaded before the commit, so that an update is only
+	// applied if it can be answered.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnRows(versionedTodoRows(3))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "priority"=$1,"version"=version + 1,"updated_at"=$2 WHERE "id" = $3`)).
+		WithArgs(4, sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	recorder := sendWithIfMatch(router, http.MethodPatch, "/api/task/todos/1", "", `{"priority":4}`)
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if etag := recorder.Header().Get("ETag"); etag != "" {
+		t.Fatalf("expected no ETag, got %q", etag)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateAndDelete_428_WhenIfMatchIsRequired_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctl := todoctrl.NewTodoController(db)
+	ctl.RequireIfMatch(true)
+	router := SetupRouter(ctl)
+
+	for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+		recorder := sendWithIfMatch(router, method, "/api/task/todos/1", "", `{"priority":4}`)
+		if recorder.Code != http.StatusPreconditionRequired {
+			t.Fatalf("%s: expected 428, got %d, body=%s", method, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	recorder := sendWithIfMatch(router, http.MethodPatch, "/api/task/todos/bulk", "", `{"items":[{"id":1,"priority":4}]}`)
+	if recorder.Code != http.StatusPreconditionRequired {
+		t.Fatalf("bulk: expected 428, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestDeleteTodoItem_204_MatchingIfMatch(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","version" FROM "todo_items" WHERE "todo_items"."id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "version"}).AddRow(1, 5))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "todo_items" WHERE version = $1 AND "todo_items"."id" = $2`)).
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	recorder := sendWithIfMatch(router, http.MethodDelete, "/api/task/todos/1", `"5"`, "")
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package todoctrltest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+)
+
+func expectGraphQueries(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","title","is_done","parent_id" FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).
+			AddRow(1, `say "hi"`, true, nil).
+			AddRow(2, "ship", false, nil).
+			AddRow(3, "tag", false, 2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "blocker_id","blocked_id" FROM "todo_dependencies"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id", "blocked_id"}).AddRow(1, 2))
+}
+
+func TestExportTodoGraph_200_DOTByQueryParam(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+	expectGraphQueries(mock)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/export?format=dot", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/vnd.graphviz") {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+
+	body := recorder.Body.String()
+	for _, want := range []string{
+		`t1 [label="say \"hi\"", fillcolor="#d4edda"`,
+		`t2 [label="ship"];`,
+		`t1 -> t2 [label="blocks"];`,
+		`t2 -> t3 [label="subtask", style=dashed, arrowhead=none];`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %q in body:\n%s", want, body)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestExportTodoGraph_200_MermaidAndGraphMLByAcceptHeader(t *testing.T) {
+	cases := map[string][]string{
+		"text/vnd.mermaid":        {"flowchart LR", `t1["say #quot;hi#quot;"]`, "class t1 done", "t1 -->|blocks| t2"},
+		"application/graphml+xml": {"<graphml", `<node id="t1">`, `<data key="done">true</data>`, `<edge source="t1" target="t2">`},
+	}
+
+	for accept, wants := range cases {
+		db, mock, sqlDB := NewMockGormDB(t)
+		router := SetupRouter(todoctrl.NewTodoController(db))
+		expectGraphQueries(mock)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/task/todos/export", nil)
+		req.Header.Set("Accept", accept)
+		recorder := httptest.NewRecorder()
+
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d, body=%s", accept, recorder.Code, recorder.Body.String())
+		}
+		for _, want := range wants {
+			if !strings.Contains(recorder.Body.String(), want) {
+				t.Fatalf("%s: expected %q in body:\n%s", accept, want, recorder.Body.String())
+			}
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("db expectations not met: %v", err)
+		}
+		_ = sqlDB.Close()
+	}
+}
+
+func TestExportTodoGraph_400_UnknownFormat_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/export?format=png", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
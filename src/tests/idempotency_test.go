@@ -0,0 +1,200 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/alirezamastery/graph_task/auth"
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+)
+
+const createTodoURL = "/api/task/todos/"
+
+var idempotencyColumns = []string{"key", "method", "path", "fingerprint", "status", "headers", "body", "created_at", "expires_at"}
+
+func setupIdempotentRouter(db *gorm.DB) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AsRole(models.RoleEditor))
+	r.POST(createTodoURL, middleware.Idempotency(db, time.Hour), todoctrl.NewTodoController(db).CreateTodo())
+	return r
+}
+
+func postWithIdempotencyKey(router *gin.Engine, key string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, createTodoURL, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(middleware.IdempotencyKeyHeader, key)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+// expectKeyInUse expects a failed claim of the key followed by its lookup.
+func expectKeyInUse(mock sqlmock.Sqlmock, rows *sqlmock.Rows) {
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "idempotency_keys"`) + ".*" + regexp.QuoteMeta(`ON CONFLICT DO NOTHING`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "idempotency_keys"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "idempotency_keys" WHERE key = $1`)).
+		WithArgs("key-1", 1).
+		WillReturnRows(rows)
+}
+
+func TestIdempotency_201_StoresResponseOfFirstRequest(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupIdempotentRouter(db)
+
+	body := []byte(`{"title":"pay rent"}`)
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "idempotency_keys"`)+".*"+regexp.QuoteMeta(`ON CONFLICT DO NOTHING`)).
+		WithArgs("key-1", http.MethodPost, createTodoURL,
+			middleware.IdempotencyFingerprint(http.MethodPost, createTodoURL, body),
+			0, "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ExpectDefaultProject(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "idempotency_keys" SET "body"=$1,"headers"=$2,"status"=$3 WHERE key = $4`)).
+		WithArgs(sqlmock.AnyArg(), `{"Content-Type":"application/json; charset=utf-8","ETag":"\"1\""}`, http.StatusCreated, "key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder := postWithIdempotencyKey(router, "key-1", body)
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first response must not be marked as replayed")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestIdempotency_201_ReplaysStoredResponse(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupIdempotentRouter(db)
+
+	body := []byte(`{"title":"pay rent"}`)
+	stored := `{"id":7,"title":"pay rent"}`
+	now := time.Now()
+	expectKeyInUse(mock, sqlmock.NewRows(idempotencyColumns).AddRow(
+		"key-1", http.MethodPost, createTodoURL,
+		middleware.IdempotencyFingerprint(http.MethodPost, createTodoURL, body),
+		http.StatusCreated, `{"Content-Type":"application/json; charset=utf-8","ETag":"\"1\""}`, []byte(stored),
+		now, now.Add(time.Hour)))
+
+	recorder := postWithIdempotencyKey(router, "key-1", body)
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Body.String() != stored {
+		t.Fatalf("expected the stored body, got %s", recorder.Body.String())
+	}
+	if recorder.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected Idempotent-Replayed header")
+	}
+	if recorder.Header().Get("ETag") != `"1"` {
+		t.Fatalf("expected the stored ETag, got %q", recorder.Header().Get("ETag"))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestIdempotency_422_KeyReusedWithDifferentBody(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupIdempotentRouter(db)
+
+	now := time.Now()
+	expectKeyInUse(mock, sqlmock.NewRows(idempotencyColumns).AddRow(
+		"key-1", http.MethodPost, createTodoURL,
+		middleware.IdempotencyFingerprint(http.MethodPost, createTodoURL, []byte(`{"title":"pay rent"}`)),
+		http.StatusCreated, "{}", []byte(`{}`), now, now.Add(time.Hour)))
+
+	recorder := postWithIdempotencyKey(router, "key-1", []byte(`{"title":"pay bills"}`))
+
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestIdempotency_409_FirstRequestStillRunning(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := setupIdempotentRouter(db)
+
+	body := []byte(`{"title":"pay rent"}`)
+	now := time.Now()
+	expectKeyInUse(mock, sqlmock.NewRows(idempotencyColumns).AddRow(
+		"key-1", http.MethodPost, createTodoURL,
+		middleware.IdempotencyFingerprint(http.MethodPost, createTodoURL, body),
+		0, "", nil, now, now.Add(time.Hour)))
+
+	recorder := postWithIdempotencyKey(router, "key-1", body)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected a Retry-After header")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestIdempotency_KeysAreScopedToTheirUser(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST(createTodoURL, func(c *gin.Context) { auth.SetUserID(c, 2) }, middleware.Idempotency(db, time.Hour),
+		func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	// Another user may have used key-1 already, this one gets a key of its
+	// own rather than their response.
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "idempotency_keys"`)+".*"+regexp.QuoteMeta(`ON CONFLICT DO NOTHING`)).
+		WithArgs("2:key-1", http.MethodPost, createTodoURL, sqlmock.AnyArg(),
+			0, "", sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "idempotency_keys" SET "body"=$1,"headers"=$2,"status"=$3 WHERE key = $4`)).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), http.StatusCreated, "2:key-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	recorder := postWithIdempotencyKey(router, "key-1", []byte(`{"title":"pay rent"}`))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -3,10 +3,16 @@ package todoctrltest
 import (
 	"database/sql"
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alirezamastery/graph_task/auth"
+	projectctrl "github.com/alirezamastery/graph_task/controllers/project"
+	tagctrl "github.com/alirezamastery/graph_task/controllers/tag"
 	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/tenant"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"regexp"
 	"testing"
 )
 
@@ -30,13 +36,93 @@ func NewMockGormDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock, *sql.DB) {
 	if err != nil {
 		t.Fatalf("gorm error: %v", err)
 	}
+	if err := gdb.Use(tenant.Plugin{}); err != nil {
+		t.Fatalf("tenant plugin error: %v", err)
+	}
 
 	return gdb, mock, sqlDB
 }
 
+// ExpectDefaultProject expects the lookup of the default project that todos
+// created without a project go into.
+func ExpectDefaultProject(mock sqlmock.Sqlmock, id uint) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "projects" WHERE is_default = $1`)).
+		WithArgs(true, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+}
+
+// ExpectWorkspaceDefaultProject expects the default project to be looked up
+// in a workspace.
+func ExpectWorkspaceDefaultProject(mock sqlmock.Sqlmock, workspaceID, id uint) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "projects" WHERE is_default = $1 AND "projects"."workspace_id" = $2`)).
+		WithArgs(true, workspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+}
+
+// ExpectPrincipal expects the authentication middleware to load the role and
+// workspace of the user.
+func ExpectPrincipal(mock sqlmock.Sqlmock, userID uint, role string, workspaceID uint) {
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","role","workspace_id" FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(userID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "workspace_id"}).AddRow(userID, role, workspaceID))
+}
+
+// AsRole stands in for the authentication middleware, giving requests the
+// role without a user, so that no owner or key prefix is recorded.
+func AsRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth.SetRole(c, role)
+		c.Next()
+	}
+}
+
 func SetupRouter(ctl *todoctrl.Controller) *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
+	r.Use(AsRole(models.RoleAdmin))
+	r.GET("/api/task/todos/", ctl.GetTodoItemList())
 	r.POST("/api/task/todos/", ctl.CreateTodo())
+	r.POST("/api/task/todos/bulk", ctl.BulkCreateTodos())
+	r.PATCH("/api/task/todos/bulk", ctl.BulkUpdateTodos())
+	r.DELETE("/api/task/todos/bulk", ctl.BulkDeleteTodos())
+	r.GET("/api/task/todos/order", ctl.GetTodoExecutionOrder())
+	r.GET("/api/task/todos/export", ctl.ExportTodoGraph())
+	r.GET("/api/task/todos/search", ctl.SearchTodos())
+	r.GET("/api/task/todos/:id", ctl.GetTodoItemByID())
+	r.PATCH("/api/task/todos/:id", ctl.UpdateTodoItem())
+	r.DELETE("/api/task/todos/:id", ctl.DeleteTodoItem())
+	r.GET("/api/task/todos/:id/occurrences", ctl.ListTodoOccurrences())
+	r.GET("/api/task/todos/:id/reminders", ctl.ListTodoReminders())
+	r.POST("/api/task/todos/:id/reminders", ctl.AddTodoReminder())
+	r.GET("/api/task/todos/:id/children", ctl.ListTodoChildren())
+	r.GET("/api/task/todos/:id/subtree", ctl.GetTodoSubtree())
+	r.POST("/api/task/todos/:id/move", ctl.MoveTodoSubtree())
+	r.GET("/api/task/todos/:id/dependencies", ctl.ListTodoDependencies())
+	r.POST("/api/task/todos/:id/dependencies", ctl.AddTodoDependency())
+	r.DELETE("/api/task/todos/:id/dependencies/:dep_id", ctl.RemoveTodoDependency())
+	r.GET("/api/projects/:pid/todos", ctl.ListProjectTodos())
+	r.POST("/api/projects/:pid/todos", ctl.CreateProjectTodo())
+	return r
+}
+
+func SetupTagRouter(ctl *tagctrl.Controller) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AsRole(models.RoleAdmin))
+	r.GET("/api/task/tags", ctl.GetTagList())
+	r.POST("/api/task/tags", ctl.CreateTag())
+	r.PATCH("/api/task/tags/:id", ctl.UpdateTag())
+	r.DELETE("/api/task/tags/:id", ctl.DeleteTag())
+	return r
+}
+
+func SetupProjectRouter(ctl *projectctrl.Controller) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AsRole(models.RoleAdmin))
+	r.GET("/api/projects", ctl.GetProjectList())
+	r.POST("/api/projects", ctl.CreateProject())
+	r.PATCH("/api/projects/:pid", ctl.UpdateProject())
+	r.DELETE("/api/projects/:pid", ctl.DeleteProject())
 	return r
 }
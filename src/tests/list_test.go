@@ -0,0 +1,86 @@
+package todoctrltest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+)
+
+func TestGetTodoItemList_200_SortsAndPaginates(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" WHERE title ILIKE $1 AND description <> ''`)).
+		WithArgs(`%100\%%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(25))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE title ILIKE $1 AND description <> '' ORDER BY priority DESC, title ASC, id ASC LIMIT $2 OFFSET $3`)).
+		WithArgs(`%100\%%`, 10, 20).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(7, "reach 100% coverage"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?title=100%25&has_description=true&sort=-priority,title&page=3&page_size=10", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_200_CreatedRange(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" WHERE created_at < $1 AND created_at > $2`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE created_at < $1 AND created_at > $2 ORDER BY created_at DESC, id ASC LIMIT $3`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?created_after=2026-01-01T00:00:00Z&created_before=2026-02-01T00:00:00Z", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_400_UnknownSortField_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?sort=description", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
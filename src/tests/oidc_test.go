@@ -0,0 +1,450 @@
+package todoctrltest
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	"github.com/alirezamastery/graph_task/auth"
+	"github.com/alirezamastery/graph_task/middleware"
+)
+
+const (
+	testOIDCIssuer   = "https://login.example.com/"
+	testOIDCAudience = "graph-task-api"
+)
+
+// jwksStandIn serves a JWKS like an identity provider would, and counts how
+// often it is fetched.
+type jwksStandIn struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PrivateKey
+	fetches int
+	server  *httptest.Server
+
+	stalled, waiting chan struct{}
+}
+
+func newJWKSStandIn(t *testing.T, kids ...string) *jwksStandIn {
+	t.Helper()
+
+	s := &jwksStandIn{keys: map[string]*rsa.PrivateKey{}}
+	s.rotate(t, kids...)
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		stalled, waiting := s.stalled, s.waiting
+		s.mu.Unlock()
+		if stalled != nil {
+			select {
+			case waiting <- struct{}{}:
+			default:
+			}
+			<-stalled
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.fetches++
+
+		keys := []auth.JWK{}
+		for kid, key := range s.keys {
+			keys = append(keys, auth.JWK{
+				Kty: "RSA", Kid: kid, Alg: "RS256", Use: "sig",
+				N: b64(key.N.Bytes()), E: b64(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// rotate replaces the published keys with new ones.
+func (s *jwksStandIn) rotate(t *testing.T, kids ...string) {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = map[string]*rsa.PrivateKey{}
+	for _, kid := range kids {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("generating key: %v", err)
+		}
+		s.keys[kid] = key
+	}
+}
+
+// stall makes fetches wait until release is called. waiting receives when a
+// fetch starts waiting.
+func (s *jwksStandIn) stall(t *testing.T) (waiting <-chan struct{}, release func()) {
+	t.Helper()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stalled, s.waiting = make(chan struct{}), make(chan struct{}, 1)
+	var once sync.Once
+	stalled := s.stalled
+	release = func() { once.Do(func() { close(stalled) }) }
+	t.Cleanup(release)
+	return s.waiting, release
+}
+
+func (s *jwksStandIn) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+
+	s.mu.Lock()
+	key := s.keys[kid]
+	s.mu.Unlock()
+	if key == nil {
+		t.Fatalf("no key %q", kid)
+	}
+	return signRS256(t, key, kid, claims)
+}
+
+func (s *jwksStandIn) provider() *auth.OIDC {
+	return &auth.OIDC{
+		Issuer:     testOIDCIssuer,
+		Audience:   testOIDCAudience,
+		EmailClaim: "email",
+		Keys:       auth.NewJWKSFromURL(s.server.URL),
+	}
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func encodeJWT(t *testing.T, header, claims map[string]any) string {
+	t.Helper()
+
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	return b64(h) + "." + b64(c)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	t.Helper()
+
+	signed := encodeJWT(t, map[string]any{"alg": "RS256", "typ": "JWT", "kid": kid}, claims)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func validClaims(sub string) map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss": testOIDCIssuer, "aud": testOIDCAudience, "sub": sub,
+		"iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		"email": "Ada@Example.com", "email_verified": true,
+	}
+}
+
+func withClaim(claims map[string]any, name string, value any) map[string]any {
+	changed := map[string]any{}
+	for k, v := range claims {
+		changed[k] = v
+	}
+	if value == nil {
+		delete(changed, name)
+	} else {
+		changed[name] = value
+	}
+	return changed
+}
+
+func TestOIDC_ChecksSignatureIssuerAudienceAndExpiry(t *testing.T) {
+	idp := newJWKSStandIn(t, "k1")
+	provider := idp.provider()
+	ctx := context.Background()
+
+	identity, err := provider.Verify(ctx, idp.sign(t, "k1", validClaims("user-1")))
+	if err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+	if identity.Issuer != testOIDCIssuer || identity.Subject != "user-1" || identity.Email != "ada@example.com" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+
+	multi := withClaim(validClaims("user-1"), "aud", []string{"other", testOIDCAudience})
+	if _, err := provider.Verify(ctx, idp.sign(t, "k1", multi)); err != nil {
+		t.Fatalf("expected an audience array to be accepted, got %v", err)
+	}
+	unverified := withClaim(validClaims("user-1"), "email_verified", false)
+	if identity, _ := provider.Verify(ctx, idp.sign(t, "k1", unverified)); identity == nil || identity.Email != "" {
+		t.Fatalf("expected an unverified email to be dropped, got %+v", identity)
+	}
+
+	stranger, _ := rsa.GenerateKey(rand.Reader, 2048)
+	past := time.Now().Add(-2 * time.Hour).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+	for name, token := range map[string]string{
+		"issuer":      idp.sign(t, "k1", withClaim(validClaims("user-1"), "iss", "https://evil.example.com/")),
+		"audience":    idp.sign(t, "k1", withClaim(validClaims("user-1"), "aud", "another-api")),
+		"no exp":      idp.sign(t, "k1", withClaim(validClaims("user-1"), "exp", nil)),
+		"not before":  idp.sign(t, "k1", withClaim(validClaims("user-1"), "nbf", future)),
+		"no subject":  idp.sign(t, "k1", withClaim(validClaims("user-1"), "sub", nil)),
+		"foreign key": signRS256(t, stranger, "k1", validClaims("user-1")),
+		"unknown kid": signRS256(t, stranger, "k9", validClaims("user-1")),
+		"alg none":    encodeJWT(t, map[string]any{"alg": "none", "kid": "k1"}, validClaims("user-1")) + ".",
+		"alg HS256":   encodeJWT(t, map[string]any{"alg": "HS256", "kid": "k1"}, validClaims("user-1")) + ".c2ln",
+	} {
+		if _, err := provider.Verify(ctx, token); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	expired := withClaim(validClaims("user-1"), "exp", past)
+	if _, err := provider.Verify(ctx, idp.sign(t, "k1", expired)); !errors.Is(err, auth.ErrExpiredToken) {
+		t.Fatalf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestOIDC_RefetchesJWKSWhenKeysRotate(t *testing.T) {
+	idp := newJWKSStandIn(t, "k1")
+	provider := idp.provider()
+	ctx := context.Background()
+
+	old := idp.sign(t, "k1", validClaims("user-1"))
+	for i := 0; i < 3; i++ {
+		if _, err := provider.Verify(ctx, old); err != nil {
+			t.Fatalf("expected a valid token, got %v", err)
+		}
+	}
+	if idp.fetches != 1 {
+		t.Fatalf("expected the JWKS to be cached, got %d fetches", idp.fetches)
+	}
+
+	// Unknown key IDs don't make the set be fetched again right away.
+	idp.rotate(t, "k2")
+	rotated := idp.sign(t, "k2", validClaims("user-1"))
+	if _, err := provider.Verify(ctx, rotated); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken within the refetch interval, got %v", err)
+	}
+	if idp.fetches != 1 {
+		t.Fatalf("expected no refetch within the refetch interval, got %d fetches", idp.fetches)
+	}
+
+	provider.Keys.MinRefetchInterval = 0
+	if _, err := provider.Verify(ctx, rotated); err != nil {
+		t.Fatalf("expected the rotated key to be picked up, got %v", err)
+	}
+	if idp.fetches != 2 {
+		t.Fatalf("expected one refetch, got %d fetches", idp.fetches)
+	}
+	if _, err := provider.Verify(ctx, old); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected the retired key to be refused, got %v", err)
+	}
+}
+
+func TestOIDC_SlowJWKSFetchesDontHoldUpCachedKeys(t *testing.T) {
+	idp := newJWKSStandIn(t, "k1")
+	provider := idp.provider()
+	provider.Keys.MinRefetchInterval = 0
+	ctx := context.Background()
+
+	known := idp.sign(t, "k1", validClaims("user-1"))
+	if _, err := provider.Verify(ctx, known); err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+
+	// A token naming an unknown key waits for the set to be fetched again...
+	waiting, release := idp.stall(t)
+	stranger, _ := rsa.GenerateKey(rand.Reader, 2048)
+	unknown := signRS256(t, stranger, "k9", validClaims("user-1"))
+	refetched := make(chan error, 1)
+	go func() {
+		_, err := provider.Verify(ctx, unknown)
+		refetched <- err
+	}()
+	<-waiting
+
+	// ...while the ones with cached keys don't.
+	verified := make(chan error, 1)
+	go func() {
+		_, err := provider.Verify(ctx, known)
+		verified <- err
+	}()
+	select {
+	case err := <-verified:
+		if err != nil {
+			t.Fatalf("expected a valid token, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("a token with a cached key waited for the JWKS to be fetched")
+	}
+
+	release()
+	if err := <-refetched; !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("expected ErrInvalidToken for the unknown key, got %v", err)
+	}
+}
+
+func TestOIDC_LoadsECKeysFromFile(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	set, _ := json.Marshal(map[string]any{"keys": []auth.JWK{{
+		Kty: "EC", Kid: "ec1", Crv: "P-256",
+		X: b64(key.X.FillBytes(make([]byte, 32))), Y: b64(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, set, 0o600); err != nil {
+		t.Fatalf("writing JWKS: %v", err)
+	}
+
+	signed := encodeJWT(t, map[string]any{"alg": "ES256", "kid": "ec1"}, validClaims("user-2"))
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("signing: %v", err)
+	}
+	token := signed + "." + b64(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+
+	provider := &auth.OIDC{Issuer: testOIDCIssuer, Audience: testOIDCAudience, EmailClaim: "email", Keys: auth.NewJWKSFromFile(path)}
+	identity, err := provider.Verify(context.Background(), token)
+	if err != nil || identity.Subject != "user-2" {
+		t.Fatalf("expected user-2, got %+v, %v", identity, err)
+	}
+}
+
+func TestOIDCUsers_MapsSubjectsToUsers(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	idp := newJWKSStandIn(t, "k1")
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Authentication(auth.NewOIDCUsers(idp.provider(), db), db))
+	router.GET("/api/auth/me", func(c *gin.Context) {
+		id, _ := auth.UserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": id})
+	})
+	token := idp.sign(t, "k1", validClaims("user-1"))
+	findUser := regexp.QuoteMeta(`SELECT * FROM "users" WHERE external_issuer = $1 AND external_subject = $2`)
+
+	// The first request creates the user, in a workspace of their own.
+	mock.ExpectQuery(findUser).
+		WithArgs(testOIDCIssuer, "user-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "workspaces"`)).
+		WithArgs("ada@example.com", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "projects"`)).
+		WithArgs(5, "Inbox", "", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "workspaces" WHERE "workspaces"."id" = $1 ORDER BY "workspaces"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE workspace_id = $1`)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)+".*"+regexp.QuoteMeta(`ON CONFLICT DO NOTHING`)).
+		WithArgs(5, "ada@example.com", "", "admin", testOIDCIssuer, "user-1", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.ExpectCommit()
+	ExpectPrincipal(mock, 9, "admin", 5)
+
+	recorder := sendJSON(router, http.MethodGet, "/api/auth/me", token, "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"user_id":9`) {
+		t.Fatalf("expected 200 as user 9, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// Later ones find it.
+	mock.ExpectQuery(findUser).
+		WithArgs(testOIDCIssuer, "user-1", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "external_issuer", "external_subject"}).AddRow(9, testOIDCIssuer, "user-1"))
+	ExpectPrincipal(mock, 9, "admin", 5)
+
+	recorder = sendJSON(router, http.MethodGet, "/api/auth/me", token, "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"user_id":9`) {
+		t.Fatalf("expected 200 as user 9, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// Local tokens are not accepted in this mode.
+	local, _, _ := newTestIssuer().AccessToken(9)
+	recorder = sendJSON(router, http.MethodGet, "/api/auth/me", local, "")
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestOIDCUsers_JoinsTheWorkspaceOfTheirClaim(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	idp := newJWKSStandIn(t, "k1")
+	provider := idp.provider()
+	provider.WorkspaceClaim = "org"
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware.Authentication(auth.NewOIDCUsers(provider, db), db))
+	router.GET("/api/auth/me", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"role": auth.Role(c)})
+	})
+	token := idp.sign(t, "k1", withClaim(validClaims("user-2"), "org", "acme"))
+
+	// The workspace of the claim exists, the user joins it as an editor.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE external_issuer = $1 AND external_subject = $2`)).
+		WithArgs(testOIDCIssuer, "user-2", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "workspaces"`)+".*"+regexp.QuoteMeta(`ON CONFLICT DO NOTHING`)).
+		WithArgs("acme", testOIDCIssuer, "acme", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "workspaces" WHERE external_issuer = $1 AND external_id = $2`)).
+		WithArgs(testOIDCIssuer, "acme", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "acme"))
+	// The workspace is locked before its users are counted, so that users
+	// signing up at once don't all become admins.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "workspaces" WHERE "workspaces"."id" = $1 ORDER BY "workspaces"."id" LIMIT $2 FOR UPDATE`)).
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE workspace_id = $1`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(2, "ada@example.com", "", "editor", testOIDCIssuer, "user-2", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(12))
+	mock.ExpectCommit()
+	ExpectPrincipal(mock, 12, "editor", 2)
+
+	recorder := sendJSON(router, http.MethodGet, "/api/auth/me", token, "")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `"role":"editor"`) {
+		t.Fatalf("expected 200 as an editor, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
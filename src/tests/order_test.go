@@ -0,0 +1,93 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/graph"
+)
+
+func TestGetTodoExecutionOrder_200_OrdersOpenTodosAndFindsCriticalPath(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	// 1 -> 3 (5h), 2 -> 3 (1h default), 4 is done and no longer blocks 2.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE is_done = $1`)).
+		WithArgs(false).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "estimate_hours"}).
+			AddRow(1, "design", false, 5.0).
+			AddRow(2, "setup", false, nil).
+			AddRow(3, "build", false, 2.0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "blocker_id","blocked_id" FROM "todo_dependencies"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"blocker_id", "blocked_id"}).
+			AddRow(1, 3).AddRow(2, 3).AddRow(4, 2))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/order?page_size=2", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp struct {
+		Count     int `json:"count"`
+		PageCount int `json:"page_count"`
+		Items     []struct {
+			Title string `json:"title"`
+		} `json:"items"`
+		CriticalPath todoctrl.CriticalPath `json:"critical_path"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+
+	if resp.Count != 3 || resp.PageCount != 2 {
+		t.Fatalf("expected count=3 page_count=2, got %d %d", resp.Count, resp.PageCount)
+	}
+	if len(resp.Items) != 2 || resp.Items[0].Title != "design" || resp.Items[1].Title != "setup" {
+		t.Fatalf("unexpected first page: %+v", resp.Items)
+	}
+	if len(resp.CriticalPath.IDs) != 2 || resp.CriticalPath.IDs[0] != 1 || resp.CriticalPath.IDs[1] != 3 {
+		t.Fatalf("expected critical path [1 3], got %v", resp.CriticalPath.IDs)
+	}
+	if resp.CriticalPath.TotalEstimateHours != 7 {
+		t.Fatalf("expected critical path of 7h, got %v", resp.CriticalPath.TotalEstimateHours)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGraphTopologicalSort(t *testing.T) {
+	g := graph.New()
+	g.AddEdge(3, 1)
+	g.AddEdge(2, 1)
+	g.AddNode(4)
+
+	order, err := g.TopologicalSort()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []uint{2, 3, 1, 4}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, order)
+		}
+	}
+
+	g.AddEdge(1, 2)
+	if _, err := g.TopologicalSort(); err != graph.ErrCycle {
+		t.Fatalf("expected ErrCycle, got %v", err)
+	}
+}
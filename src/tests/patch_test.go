@@ -0,0 +1,286 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/jsonpatch"
+)
+
+var patchColumns = []string{"id", "project_id", "title", "status", "is_done", "priority", "estimate_hours", "due_at", "version"}
+
+// expectPatchedTodo expects the transaction to begin with the todo to patch,
+// locked, with its tag "backend".
+func expectPatchedTodo(mock sqlmock.Sqlmock) {
+	due := time.Date(2026, 1, 31, 17, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 ORDER BY "todo_items"."id" LIMIT $2 FOR UPDATE`)).
+		WillReturnRows(sqlmock.NewRows(patchColumns).AddRow(3, 1, "pay rent", "todo", false, 2, 1.5, due, 3))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags" WHERE "todo_item_tags"."todo_item_id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}).AddRow(3, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tags" WHERE "tags"."id" = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "backend"))
+}
+
+func patchTodo(router *gin.Engine, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/3", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", contentType)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestUpdateTodoItem_200_MergePatchClearsFields(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	expectPatchedTodo(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "due_at"=$1,"estimate_hours"=$2,"title"=$3,"version"=version + 1,"updated_at"=$4 WHERE "id" = $5`)).
+		WithArgs(nil, nil, "pay the rent", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(patchColumns).AddRow(3, 1, "pay the rent", "todo", false, 2, nil, nil, 4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	recorder := patchTodo(router, "application/merge-patch+json",
+		`{"title":"pay the rent","due_at":null,"estimate_hours":null,"unknown":null}`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_JSONPatchTestsAndRemoves(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	expectPatchedTodo(mock)
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "estimate_hours"=$1,"priority"=$2,"version"=version + 1,"updated_at"=$3 WHERE "id" = $4`)).
+		WithArgs(nil, 4, sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(patchColumns).AddRow(3, 1, "pay rent", "todo", false, 4, nil, nil, 4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	recorder := patchTodo(router, "application/json-patch+json", `[
+		{"op":"test","path":"/tags/0","value":"backend"},
+		{"op":"remove","path":"/estimate_hours"},
+		{"op":"replace","path":"/priority","value":4}
+	]`)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_422_JSONPatchReportsEveryInvalidOperation(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	expectPatchedTodo(mock)
+	mock.ExpectRollback()
+
+	recorder := patchTodo(router, "application/json-patch+json", `[
+		{"op":"replace","path":"/title","value":"  "},
+		{"op":"replace","path":"/description","value":"monthly"},
+		{"op":"replace","path":"/priority","value":9},
+		{"op":"replace","path":"/id","value":4}
+	]`)
+
+	if recorder.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.PatchErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	var indexes []int
+	for _, op := range resp.Operations {
+		if op.Index == nil {
+			t.Fatalf("expected the index of every failing operation, got %+v", resp.Operations)
+		}
+		indexes = append(indexes, *op.Index)
+	}
+	// Failures are ordered by field.
+	if !equalInts(indexes, []int{3, 2, 0}) {
+		t.Fatalf("expected operations 3, 2 and 0 to fail, got %v", indexes)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_409_JSONPatchTestFails(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	expectPatchedTodo(mock)
+	mock.ExpectRollback()
+
+	recorder := patchTodo(router, "application/json-patch+json", `[
+		{"op":"replace","path":"/title","value":"pay the rent"},
+		{"op":"test","path":"/version","value":2}
+	]`)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.PatchErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if len(resp.Operations) != 1 || resp.Operations[0].Index == nil || *resp.Operations[0].Index != 1 {
+		t.Fatalf("expected operation 1 to fail, got %+v", resp.Operations)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_PatchChangingNothing_NoWrite(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	for _, p := range []struct{ contentType, body string }{
+		{"application/json-patch+json", `[{"op":"test","path":"/title","value":"pay rent"}]`},
+		{"application/merge-patch+json", `{"title":"pay rent"}`},
+	} {
+		expectPatchedTodo(mock)
+		mock.ExpectCommit()
+
+		recorder := patchTodo(router, p.contentType, p.body)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d, body=%s", p.contentType, recorder.Code, recorder.Body.String())
+		}
+		if etag := recorder.Header().Get("ETag"); etag != `"3"` {
+			t.Fatalf(`%s: expected the current ETag "3", got %q`, p.contentType, etag)
+		}
+		var resp struct {
+			Title string `json:"title"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+		}
+		if resp.Title != "pay rent" {
+			t.Fatalf("%s: expected the todo as it is, got %s", p.contentType, recorder.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_400_MalformedJSONPatch_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	recorder := patchTodo(router, "application/json-patch+json", `[{"op":"replace","path":"/title"}]`)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestJSONPatch_AppliesRFC6902Operations(t *testing.T) {
+	cases := []struct {
+		doc, patch, want string
+	}{
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc"]}]`, `{"foo":["bar",["abc"]]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			`[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1.0},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`},
+		{`{"foo":null}`, `[{"op":"copy","from":"/foo","path":"/bar"}]`, `{"foo":null,"bar":null}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":null}]`, `{"foo":"bar","baz":null}`},
+	}
+
+	for _, tc := range cases {
+		doc, _ := jsonpatch.Decode([]byte(tc.doc))
+		patch, err := jsonpatch.DecodePatch([]byte(tc.patch))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.patch, err)
+		}
+		got, err := patch.Apply(doc)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.patch, err)
+		}
+		want, _ := jsonpatch.Decode([]byte(tc.want))
+		if !jsonpatch.Equal(got, want) {
+			t.Fatalf("%s: expected %s, got %v", tc.patch, tc.want, got)
+		}
+	}
+
+	doc, _ := jsonpatch.Decode([]byte(`{"foo":"bar"}`))
+	patch, _ := jsonpatch.DecodePatch([]byte(`[{"op":"add","path":"/baz/bat","value":"qux"}]`))
+	if _, err := patch.Apply(doc); err == nil {
+		t.Fatalf("expected adding to a missing parent to fail")
+	}
+}
+
+func TestMergePatch_AppliesRFC7396Examples(t *testing.T) {
+	cases := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		target, _ := jsonpatch.Decode([]byte(tc.target))
+		patch, _ := jsonpatch.Decode([]byte(tc.patch))
+		want, _ := jsonpatch.Decode([]byte(tc.want))
+		if got := jsonpatch.MergePatch(target, patch); !jsonpatch.Equal(got, want) {
+			t.Fatalf("%s + %s: expected %s, got %v", tc.target, tc.patch, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/problem"
+)
+
+func decodeProblem(t *testing.T, recorder *httptest.ResponseRecorder) problem.Problem {
+	t.Helper()
+
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, problem.ContentType) {
+		t.Fatalf("expected Content-Type %s, got %q", problem.ContentType, ct)
+	}
+	var p problem.Problem
+	if err := json.Unmarshal(recorder.Body.Bytes(), &p); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if p.Status != recorder.Code {
+		t.Fatalf("expected status member %d, got %d", recorder.Code, p.Status)
+	}
+	if p.Type != problem.TypeBase+p.Code || p.Title == "" {
+		t.Fatalf("expected type and title derived from the code, got %+v", p)
+	}
+	return p
+}
+
+func postTodo(router http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/", bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestProblem_400_ValidationPointsAtField(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	recorder := postTodo(router, `{"title":"   "}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	p := decodeProblem(t, recorder)
+	if p.Code != problem.CodeValidationFailed {
+		t.Fatalf("expected code %s, got %s", problem.CodeValidationFailed, p.Code)
+	}
+	if p.Instance != "/api/task/todos/" {
+		t.Fatalf("expected instance to be the request path, got %q", p.Instance)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "title" {
+		t.Fatalf("expected one error on title, got %+v", p.Errors)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestProblem_409_UniqueViolationIsTitleConflict(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	ExpectDefaultProject(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WillReturnError(&pgconn.PgError{
+			Code:           "23505",
+			Message:        `duplicate key value violates unique constraint "idx_todo_items_workspace_project_title"`,
+			TableName:      "todo_items",
+			ConstraintName: "idx_todo_items_workspace_project_title",
+		})
+	mock.ExpectRollback()
+
+	recorder := postTodo(router, `{"title":"taken"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	p := decodeProblem(t, recorder)
+	if p.Code != problem.CodeTitleConflict {
+		t.Fatalf("expected code %s, got %s", problem.CodeTitleConflict, p.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "duplicate key") {
+		t.Fatalf("expected the database message to be hidden, body=%s", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestProblem_500_HidesDatabaseError(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`FROM "todo_items"`)).
+		WillReturnError(errors.New(`password authentication failed for user "todo"`))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/1", nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	p := decodeProblem(t, recorder)
+	if p.Code != problem.CodeInternal {
+		t.Fatalf("expected code %s, got %s", problem.CodeInternal, p.Code)
+	}
+	if strings.Contains(recorder.Body.String(), "password") {
+		t.Fatalf("expected the database error to be hidden, body=%s", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/querylang"
+)
+
+func TestQueryParse_BuildsTypedAST(t *testing.T) {
+	node, err := querylang.Parse(`is:open (tag:backend OR priority:>=high) -due:none "release notes"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	and, ok := node.(*querylang.And)
+	if !ok || len(and.Nodes) != 4 {
+		t.Fatalf("expected an AND of 4 terms, got %#v", node)
+	}
+	if is, ok := and.Nodes[0].(*querylang.Is); !ok || is.Value != "open" {
+		t.Fatalf("unexpected first term: %#v", and.Nodes[0])
+	}
+	or, ok := and.Nodes[1].(*querylang.Or)
+	if !ok || len(or.Nodes) != 2 {
+		t.Fatalf("expected an OR of 2 terms, got %#v", and.Nodes[1])
+	}
+	if p, ok := or.Nodes[1].(*querylang.Priority); !ok || p.Op != querylang.OpGe || p.Level != models.PriorityHigh {
+		t.Fatalf("unexpected priority term: %#v", or.Nodes[1])
+	}
+	not, ok := and.Nodes[2].(*querylang.Not)
+	if !ok {
+		t.Fatalf("expected a negation, got %#v", and.Nodes[2])
+	}
+	if d, ok := not.Node.(*querylang.Date); !ok || d.Field != "due" || !d.Value.None {
+		t.Fatalf("unexpected date term: %#v", not.Node)
+	}
+	if text, ok := and.Nodes[3].(*querylang.Text); !ok || text.Value != "release notes" || text.At != 52 {
+		t.Fatalf("unexpected text term: %#v", and.Nodes[3])
+	}
+}
+
+func TestQueryParse_ReportsErrorColumn(t *testing.T) {
+	cases := []struct {
+		query string
+		pos   int
+	}{
+		{`is:open (tag:backend`, 9},
+		{`is:open due:<soon`, 14},
+		{`tag:backend "release`, 13},
+		{`is:open colour:red`, 9},
+		{`tag:backend OR`, 13},
+		{`is:open )`, 9},
+		{`priority:`, 10},
+	}
+
+	for _, tc := range cases {
+		_, err := querylang.Parse(tc.query)
+		var qErr *querylang.Error
+		if !errors.As(err, &qErr) {
+			t.Fatalf("%q: expected a query error, got %v", tc.query, err)
+		}
+		if qErr.Pos != tc.pos {
+			t.Fatalf("%q: expected column %d, got %d (%v)", tc.query, tc.pos, qErr.Pos, qErr)
+		}
+	}
+}
+
+func TestGetTodoItemList_200_QueryLanguage(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	where := `WHERE (is_done = $1 AND todo_items.id IN (SELECT todo_item_tags.todo_item_id FROM todo_item_tags ` +
+		`JOIN tags ON tags.id = todo_item_tags.tag_id WHERE tags.name IN ($2)) AND due_at < $3 ` +
+		`AND (title ILIKE $4 OR description ILIKE $5))`
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" `+where)).
+		WithArgs(false, "backend", sqlmock.AnyArg(), "%release%", "%release%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" ` + where)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	q := url.QueryEscape(`is:open tag:backend due:<7d "release"`)
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?q="+q, nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_400_QueryUnknownStatus_ReportsPosition(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	q := url.QueryEscape(`is:open status:blocked`)
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?q="+q, nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp struct {
+		Position int `json:"position"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if resp.Position != 9 {
+		t.Fatalf("expected position 9, got %d", resp.Position)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
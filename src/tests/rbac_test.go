@@ -0,0 +1,339 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/alirezamastery/graph_task/auth"
+	adminctrl "github.com/alirezamastery/graph_task/controllers/admin"
+	projectctrl "github.com/alirezamastery/graph_task/controllers/project"
+	tagctrl "github.com/alirezamastery/graph_task/controllers/tag"
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/rbac"
+)
+
+func setupPolicyRouter(db *gorm.DB, issuer *auth.Issuer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Authentication(issuer, db))
+
+	policy := rbac.NewPolicy()
+	todo := todoctrl.NewTodoController(db)
+	todo.UsePolicy(policy)
+	r.GET("/api/task/workflow", todo.GetWorkflow())
+	r.POST("/api/task/todos", todo.CreateTodo())
+	r.DELETE("/api/task/todos/:id", todo.DeleteTodoItem())
+
+	project := projectctrl.NewProjectController(db, policy)
+	r.POST("/api/projects", project.CreateProject())
+	r.PATCH("/api/projects/:pid", project.UpdateProject())
+	r.DELETE("/api/projects/:pid", project.DeleteProject())
+
+	tag := tagctrl.NewTagController(db, policy)
+	r.POST("/api/task/tags", tag.CreateTag())
+	r.PATCH("/api/task/tags/:id", tag.UpdateTag())
+	r.DELETE("/api/task/tags/:id", tag.DeleteTag())
+
+	admin := adminctrl.NewAdminController(db, policy)
+	r.POST("/api/admin/users", admin.CreateUser())
+	r.PUT("/api/admin/users/:id/role", admin.SetUserRole())
+	return r
+}
+
+func decodeDenied(t *testing.T, recorder *httptest.ResponseRecorder) rbac.DeniedResponse {
+	t.Helper()
+
+	if p := decodeProblem(t, recorder); p.Code != problem.CodePermissionDenied {
+		t.Fatalf("expected code %s, got %s", problem.CodePermissionDenied, p.Code)
+	}
+	var denied rbac.DeniedResponse
+	_ = json.Unmarshal(recorder.Body.Bytes(), &denied)
+	return denied
+}
+
+func TestPolicy_ViewerCanOnlyRead(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(5)
+
+	ExpectPrincipal(mock, 5, "viewer", 1)
+	recorder := sendJSON(router, http.MethodGet, "/api/task/workflow", token, "")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	// Denied before the todo is looked up.
+	ExpectPrincipal(mock, 5, "viewer", 1)
+	recorder = sendJSON(router, http.MethodDelete, "/api/task/todos/1", token, "")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if denied := decodeDenied(t, recorder); denied.Permission != rbac.TodosDelete || denied.Role != "viewer" {
+		t.Fatalf("expected todos:delete to be missing for viewer, got %+v", denied)
+	}
+
+	ExpectPrincipal(mock, 5, "viewer", 1)
+	recorder = sendJSON(router, http.MethodPost, "/api/task/todos", token, `{"title":"nope"}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if denied := decodeDenied(t, recorder); denied.Permission != rbac.TodosCreate {
+		t.Fatalf("expected todos:create to be missing, got %+v", denied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestPolicy_ViewerCanNotChangeProjectsOrTags(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(5)
+
+	// Deleting a project deletes its todos, so it needs projects:write
+	// first and todos:delete as well.
+	requests := []struct {
+		method, path, body, permission string
+	}{
+		{http.MethodPost, "/api/projects", `{"name":"nope"}`, rbac.ProjectsWrite},
+		{http.MethodPatch, "/api/projects/2", `{"name":"nope"}`, rbac.ProjectsWrite},
+		{http.MethodDelete, "/api/projects/2", "", rbac.ProjectsWrite},
+		{http.MethodPost, "/api/task/tags", `{"name":"nope"}`, rbac.TagsWrite},
+		{http.MethodPatch, "/api/task/tags/3", `{"name":"nope"}`, rbac.TagsWrite},
+		{http.MethodDelete, "/api/task/tags/3", "", rbac.TagsWrite},
+	}
+	for _, req := range requests {
+		ExpectPrincipal(mock, 5, "viewer", 1)
+		recorder := sendJSON(router, req.method, req.path, token, req.body)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected 403, got %d, body=%s", req.method, req.path, recorder.Code, recorder.Body.String())
+		}
+		if denied := decodeDenied(t, recorder); denied.Permission != req.permission {
+			t.Fatalf("%s %s: expected %s to be missing, got %+v", req.method, req.path, req.permission, denied)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestPolicy_HandlersWithoutAPolicyDenyEverything(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	todo := todoctrl.NewTodoController(db)
+	todo.UsePolicy(nil)
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(AsRole(models.RoleAdmin))
+	r.GET("/api/task/todos", todo.GetTodoItemList())
+	r.POST("/api/task/tags", tagctrl.NewTagController(db, nil).CreateTag())
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/task/todos"},
+		{http.MethodPost, "/api/task/tags"},
+	} {
+		recorder := sendJSON(r, req.method, req.path, "", `{"name":"work"}`)
+		if recorder.Code != http.StatusForbidden {
+			t.Fatalf("%s %s: expected 403, got %d, body=%s", req.method, req.path, recorder.Code, recorder.Body.String())
+		}
+		decodeDenied(t, recorder)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestAuthentication_401_DeletedUser(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(5)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","role","workspace_id" FROM "users" WHERE "users"."id" = $1`)).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role", "workspace_id"}))
+	recorder := sendJSON(router, http.MethodGet, "/api/task/workflow", token, "")
+	if recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeInvalidToken {
+		t.Fatalf("expected code %s, got %s", problem.CodeInvalidToken, p.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestRoles_EditorsCanNotAssignRoles(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(5)
+
+	ExpectPrincipal(mock, 5, "editor", 1)
+	recorder := sendJSON(router, http.MethodPut, "/api/admin/users/5/role", token, `{"role":"admin"}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if denied := decodeDenied(t, recorder); denied.Permission != rbac.RolesAssign {
+		t.Fatalf("expected roles:assign to be missing, got %+v", denied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestSetUserRole_200_AdminAssignsRole(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(1)
+
+	ExpectPrincipal(mock, 1, "admin", 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE role = $1 AND "users"."workspace_id" = $2 ORDER BY id FOR UPDATE`)).
+		WithArgs("admin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."workspace_id" = $2 ORDER BY "users"."id" LIMIT $3 FOR UPDATE`)).
+		WithArgs(7, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "role"}).AddRow(7, "bob@example.com", "editor"))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "users" SET "role"=$1,"updated_at"=$2 WHERE "users"."workspace_id" = $3 AND "id" = $4`)).
+		WithArgs("viewer", sqlmock.AnyArg(), 1, 7).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPut, "/api/admin/users/7/role", token, `{"role":" Viewer "}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if !strings.Contains(recorder.Body.String(), `"role":"viewer"`) {
+		t.Fatalf("expected the new role in the response, body=%s", recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestSetUserRole_409_LastAdmin(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(1)
+
+	ExpectPrincipal(mock, 1, "admin", 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE role = $1 AND "users"."workspace_id" = $2 ORDER BY id FOR UPDATE`)).
+		WithArgs("admin", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE "users"."id" = $1 AND "users"."workspace_id" = $2`)).
+		WithArgs(1, 1, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "role"}).AddRow(1, "admin"))
+	mock.ExpectRollback()
+
+	recorder := sendJSON(router, http.MethodPut, "/api/admin/users/1/role", token, `{"role":"editor"}`)
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); p.Code != problem.CodeLastAdmin {
+		t.Fatalf("expected code %s, got %s", problem.CodeLastAdmin, p.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestSetUserRole_400_UnknownRole_NoUpdate(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(1)
+
+	ExpectPrincipal(mock, 1, "admin", 1)
+	recorder := sendJSON(router, http.MethodPut, "/api/admin/users/7/role", token, `{"role":"owner"}`)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if p := decodeProblem(t, recorder); len(p.Errors) != 1 || p.Errors[0].Field != "role" {
+		t.Fatalf("expected an error on role, got %+v", p.Errors)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestCreateUser_201_AddsUserToTheWorkspaceOfTheAdmin(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	issuer := newTestIssuer()
+	router := setupPolicyRouter(db, issuer)
+	token, _, _ := issuer.AccessToken(1)
+
+	ExpectPrincipal(mock, 1, "admin", 3)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "users"`)).
+		WithArgs(3, "bob@example.com", sqlmock.AnyArg(), "viewer", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(8))
+	mock.ExpectCommit()
+
+	recorder := sendJSON(router, http.MethodPost, "/api/admin/users", token,
+		`{"email":"Bob@Example.com","password":"correct horse","role":"viewer"}`)
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if !strings.Contains(recorder.Body.String(), `"workspace_id":3`) {
+		t.Fatalf("expected the user in the workspace of the admin, body=%s", recorder.Body.String())
+	}
+
+	// Editors can't add users.
+	token, _, _ = issuer.AccessToken(5)
+	ExpectPrincipal(mock, 5, "editor", 3)
+	recorder = sendJSON(router, http.MethodPost, "/api/admin/users", token,
+		`{"email":"eve@example.com","password":"correct horse"}`)
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	if denied := decodeDenied(t, recorder); denied.Permission != rbac.UsersCreate {
+		t.Fatalf("expected users:create to be missing, got %+v", denied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,172 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/recurrence"
+)
+
+func TestListTodoOccurrences_200_PreviewsWithoutCreating(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC) // a Monday
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","recurrence","due_at" FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "recurrence", "due_at"}).AddRow(3, "FREQ=WEEKLY;BYDAY=MO", due))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/3/occurrences?count=3", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.TodoOccurrencesResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if len(resp.Occurrences) != 3 {
+		t.Fatalf("expected 3 occurrences, got %v", resp.Occurrences)
+	}
+	for i, want := range []int{12, 19, 26} {
+		if !resp.Occurrences[i].Equal(time.Date(2026, 1, want, 9, 0, 0, 0, time.UTC)) {
+			t.Fatalf("occurrence %d: expected Jan %d, got %v", i, want, resp.Occurrences[i])
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_CompletingOccurrenceCreatesNext(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	due := time.Date(2026, 1, 31, 17, 0, 0, 0, time.UTC)
+	columns := []string{"id", "workspace_id", "project_id", "title", "status", "is_done", "priority", "due_at", "recurrence"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 2, 1, "invoice (2026-01-31)", "todo", false, 2, due, "FREQ=MONTHLY;COUNT=3"))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(3, "invoice", false, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"recurrence"=$2,"status"=$3,"version"=version + 1,"updated_at"=$4 WHERE "id" = $5`)).
+		WithArgs(true, "", "done", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 2, 1, "invoice (2026-01-31)", "done", true, 2, due, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	// February has no 31st, so the monthly rule skips to March. The next
+	// occurrence stays in the workspace of the series.
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WithArgs(2, 1, "invoice (2026-03-31)", "", "todo", false, nil, 2,
+			time.Date(2026, 3, 31, 17, 0, 0, 0, time.UTC), "FREQ=MONTHLY;COUNT=2", 3, nil,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), 1, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 2, 1, "invoice (2026-01-31)", "done", true, 2, due, ""))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	body := []byte(`{"is_done":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/3", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp struct {
+		NextID *uint `json:"next_occurrence_id"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if resp.NextID == nil || *resp.NextID != 4 {
+		t.Fatalf("expected next occurrence 4, got %v", resp.NextID)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestCreateTodo_400_RecurrenceWithoutDueDate_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	body := []byte(`{"title":"weekly report","recurrence":"RRULE:FREQ=WEEKLY;BYDAY=FR"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestRecurrenceNext_StopsAtLastOccurrence(t *testing.T) {
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	if _, _, ok, err := recurrence.Next("FREQ=DAILY;COUNT=1", due); err != nil || ok {
+		t.Fatalf("expected the series to be over, got ok=%v err=%v", ok, err)
+	}
+
+	next, rule, ok, err := recurrence.Next("FREQ=DAILY;COUNT=2", due)
+	if err != nil || !ok {
+		t.Fatalf("expected a next occurrence, got ok=%v err=%v", ok, err)
+	}
+	if !next.Equal(due.AddDate(0, 0, 1)) || rule != "FREQ=DAILY;COUNT=1" {
+		t.Fatalf("unexpected next occurrence %v with rule %q", next, rule)
+	}
+}
+
+func TestRecurrenceLayout_TellsOccurrencesOfADayApart(t *testing.T) {
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+
+	for rule, want := range map[string]string{
+		"FREQ=WEEKLY;BYDAY=MO":        "2026-01-12",
+		"FREQ=DAILY;BYHOUR=9,17":      "2026-01-05 17:00",
+		"FREQ=HOURLY":                 "2026-01-05 10:00",
+		"FREQ=MINUTELY;INTERVAL=30":   "2026-01-05 09:30",
+		"FREQ=MINUTELY;BYSECOND=0,30": "2026-01-05 09:00:30",
+	} {
+		layout, err := recurrence.Layout(rule)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", rule, err)
+		}
+		next, _, _, _ := recurrence.Next(rule, due)
+		if got := next.Format(layout); got != want {
+			t.Fatalf("%s: expected the next occurrence to read %q, got %q", rule, want, got)
+		}
+	}
+}
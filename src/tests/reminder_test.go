@@ -0,0 +1,146 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/reminder"
+)
+
+type recordingNotifier struct {
+	sent []reminder.Notification
+	err  error
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, notification reminder.Notification) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, notification)
+	return nil
+}
+
+func TestReminderWorker_FiresClaimedAndSkipsDoneTodos(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	now := time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)
+	notifier := &recordingNotifier{}
+	worker := reminder.NewWorker(db, notifier)
+	before := testutil.ToFloat64(middleware.RemindersFired)
+
+	// Both were due while the service was down.
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reminders SET fired_at = $1`)+".*"+regexp.QuoteMeta(`FOR UPDATE SKIP LOCKED`)).
+		WithArgs(now, now, reminder.DefaultBatchSize).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "todo_item_id", "remind_at"}).
+			AddRow(1, 10, now.Add(-2*time.Hour)).
+			AddRow(2, 11, now.Add(-time.Hour)))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","title","is_done","due_at" FROM "todo_items"`)).
+		WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(10, "send invoice", false))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","title","is_done","due_at" FROM "todo_items"`)).
+		WithArgs(11, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(11, "renew domain", true))
+
+	if err := worker.FireDue(context.Background(), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(notifier.sent) != 1 || notifier.sent[0].ReminderID != 1 || notifier.sent[0].Title != "send invoice" {
+		t.Fatalf("unexpected notifications: %+v", notifier.sent)
+	}
+	if after := testutil.ToFloat64(middleware.RemindersFired); after != before+1 {
+		t.Fatalf("expected fired counter to grow by 1, got %v -> %v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestReminderWorker_RecordsNotifierFailure(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	now := time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)
+	worker := reminder.NewWorker(db, &recordingNotifier{err: errors.New("connection refused")})
+	before := testutil.ToFloat64(middleware.RemindersFailed)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`UPDATE reminders SET fired_at = $1`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "todo_item_id", "remind_at"}).AddRow(1, 10, now))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","title","is_done","due_at" FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(10, "send invoice", false))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "reminders" SET "last_error"=$1 WHERE "id" = $2`)).
+		WithArgs("connection refused", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := worker.FireDue(context.Background(), now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if after := testutil.ToFloat64(middleware.RemindersFailed); after != before+1 {
+		t.Fatalf("expected failed counter to grow by 1, got %v -> %v", before, after)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestWebhookNotifier_FailsOnErrorStatus(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("expected a json body, got %q", r.Header.Get("Content-Type"))
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	notifier := reminder.NewWebhookNotifier(server.URL)
+	notification := reminder.Notification{ReminderID: 1, TodoID: 10, Title: "send invoice"}
+
+	if err := notifier.Notify(context.Background(), notification); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status = http.StatusBadGateway
+	if err := notifier.Notify(context.Background(), notification); err == nil {
+		t.Fatalf("expected an error for a 502 response")
+	}
+}
+
+func TestAddTodoReminder_400_PastTime_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	body := []byte(`{"remind_at":"2020-01-01T09:00:00Z"}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/1/reminders", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
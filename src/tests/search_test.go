@@ -0,0 +1,147 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/search"
+)
+
+func TestSearchTodos_200_RanksWithTsQuery(t *testing.T) {
+	gdb, mock, sqlDB := NewMockGormDB(t)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT count(*) FROM "todo_items" WHERE search_vector @@ websearch_to_tsquery('english', $1)`)).
+		WithArgs("release notes").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(`(?s)SELECT id,\s+ts_headline\('english', title, q, \$1\) AS title,\s+`+
+		`ts_headline\('english', description, q, \$2\) AS snippet,\s+ts_rank\(search_vector, q\) AS rank\s+`+
+		`FROM todo_items, websearch_to_tsquery\('english', \$3\) AS q\s+WHERE search_vector @@ q\s+`+
+		`ORDER BY rank DESC, id\s+LIMIT \$4 OFFSET \$5`).
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "release notes", 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "snippet", "rank"}).
+			AddRow(7, "draft <script>\x02release\x03", "collect the \x02notes\x03 & \x03more", 0.3))
+
+	r := SetupRouter(todoctrl.NewTodoController(gdb))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/search?q=release+notes&page=2&page_size=2", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", w.Code, w.Body.String())
+	}
+
+	var resp todoctrl.TodoSearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if resp.Count != 3 || resp.PageCount != 2 || len(resp.Items) != 1 {
+		t.Fatalf("unexpected page: %+v", resp)
+	}
+	// The text is escaped, so that the highlight markers are its only markup.
+	hit := resp.Items[0]
+	if hit.ID != 7 || hit.Title != "draft &lt;script&gt;<b>release</b>" || hit.Rank != 0.3 {
+		t.Fatalf("unexpected hit: %+v", hit)
+	}
+	if hit.Snippet != "collect the <b>notes</b> &amp; more" {
+		t.Fatalf("unexpected snippet: %q", hit.Snippet)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSearchTodos_400_EmptyQuery(t *testing.T) {
+	gdb, mock, sqlDB := NewMockGormDB(t)
+	defer sqlDB.Close()
+
+	r := SetupRouter(todoctrl.NewTodoController(gdb))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/search?q=++", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSearchFallback_RanksAndHighlights(t *testing.T) {
+	gdb, mock, sqlDB := NewMockGormDB(t)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT count(*) FROM "todo_items" `+
+			`WHERE (LOWER(title) LIKE $1 OR LOWER(description) LIKE $2) `+
+			`AND (LOWER(title) LIKE $3 OR LOWER(description) LIKE $4)`)).
+		WithArgs("%release%", "%release%", "%notes%", "%notes%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT id,title,description FROM "todo_items" `+
+			`WHERE (LOWER(title) LIKE $1 OR LOWER(description) LIKE $2) `+
+			`AND (LOWER(title) LIKE $3 OR LOWER(description) LIKE $4) ORDER BY id LIMIT $5`)).
+		WithArgs("%release%", "%release%", "%notes%", "%notes%", search.MaxCandidates).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description"}).
+			AddRow(1, "Plan sprint", "write the release notes").
+			AddRow(2, "Release notes", "").
+			AddRow(3, "Misc", "notes about the release of the new release"))
+
+	hits, total, err := search.Fallback{}.Search(gdb, "Release notes", 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 3 || len(hits) != 2 {
+		t.Fatalf("expected 2 of 3 hits, got %d of %d", len(hits), total)
+	}
+	if hits[0].ID != 2 || hits[0].Title != "<b>Release</b> <b>notes</b>" {
+		t.Fatalf("expected the title match first, got %+v", hits[0])
+	}
+	if hits[1].ID != 3 || hits[1].Snippet != "<b>notes</b> about the <b>release</b> of the new <b>release</b>" {
+		t.Fatalf("unexpected second hit: %+v", hits[1])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestSearchFallback_EscapesTextAndCountsPastTheCandidates(t *testing.T) {
+	gdb, mock, sqlDB := NewMockGormDB(t)
+	defer sqlDB.Close()
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" WHERE LOWER(title) LIKE $1 OR LOWER(description) LIKE $2`)).
+		WithArgs("%release%", "%release%").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(search.MaxCandidates + 500))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id,title,description FROM "todo_items"`)).
+		WithArgs("%release%", "%release%", search.MaxCandidates).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "description"}).
+			AddRow(1, `<img src=x onerror="alert(1)"> release`, "release & ship"))
+
+	hits, total, err := search.Fallback{}.Search(gdb, "release", 10, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != search.MaxCandidates+500 {
+		t.Fatalf("expected every match to be counted, got %d", total)
+	}
+	if len(hits) != 1 || hits[0].Title != `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <b>release</b>` ||
+		hits[0].Snippet != "<b>release</b> &amp; ship" {
+		t.Fatalf("expected escaped text around the markers, got %+v", hits)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/problem"
+	"github.com/alirezamastery/graph_task/workflow"
+)
+
+func TestUpdateTodoItem_409_IllegalStatusTransition(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(1, "release", "done", true))
+	mock.ExpectRollback()
+
+	body := []byte(`{"status":"in_review"}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.TransitionErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if resp.Code != problem.CodeIllegalTransition || resp.From != "done" || resp.To != "in_review" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if len(resp.Allowed) != 1 || resp.Allowed[0] != "todo" {
+		t.Fatalf("expected allowed [todo], got %v", resp.Allowed)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_IsDoneMovesToDoneState(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(5, "ship it", "in_review", false))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(5, "ship it", false, nil))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"status"=$2,"version"=version + 1,"updated_at"=$3 WHERE "id" = $4`)).
+		WithArgs(true, "done", sqlmock.AnyArg(), 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(5, "ship it", "done", true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	body := []byte(`{"is_done":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/5", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_400_UnknownStatus_NoWrite(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(5, "ship it", "todo", false))
+	mock.ExpectRollback()
+
+	body := []byte(`{"status":"blocked"}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/5", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestWorkflowParse_RejectsUndeclaredState(t *testing.T) {
+	config := []byte(`{
+		"initial": "open",
+		"done_state": "closed",
+		"states": [{"name": "open"}, {"name": "closed", "done": true}],
+		"transitions": {"open": ["closed", "archived"]}
+	}`)
+
+	if _, err := workflow.Parse(config); err == nil {
+		t.Fatalf("expected an error for the undeclared \"archived\" state")
+	}
+}
@@ -0,0 +1,263 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/problem"
+)
+
+func subtreeRows() *sqlmock.Rows {
+	// 1
+	// ├── 2 (done)
+	// │   └── 4 (done)
+	// └── 3 (in review)
+	return sqlmock.NewRows([]string{"id", "title", "status", "is_done", "parent_id"}).
+		AddRow(1, "release", "todo", false, nil).
+		AddRow(2, "docs", "done", true, 1).
+		AddRow(3, "build", "in_review", false, 1).
+		AddRow(4, "changelog", "done", true, 2)
+}
+
+func TestGetTodoSubtree_200_RollsUpProgress(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(1).WillReturnRows(subtreeRows())
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/1/subtree", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var root todoctrl.TodoTreeNode
+	if err := json.Unmarshal(recorder.Body.Bytes(), &root); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+
+	if root.Progress != 2.0/3.0 {
+		t.Fatalf("expected root progress 2/3, got %v", root.Progress)
+	}
+	if len(root.Children) != 2 || root.Children[0].ID != 2 || root.Children[1].ID != 3 {
+		t.Fatalf("unexpected children: %+v", root.Children)
+	}
+	if root.Children[0].Progress != 1 || len(root.Children[0].Children) != 1 {
+		t.Fatalf("unexpected subtree of 2: %+v", root.Children[0])
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_409_OpenSubtasksWithoutCascade(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(1, "release", "todo", false))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(1).WillReturnRows(subtreeRows())
+	mock.ExpectRollback()
+
+	body := []byte(`{"is_done":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp todoctrl.OpenSubtasksResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if len(resp.OpenSubtasks) != 1 || resp.OpenSubtasks[0] != 3 {
+		t.Fatalf("expected open subtasks [3], got %v", resp.OpenSubtasks)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_CascadesDoneToSubtasks(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	// The todo and its subtasks are locked while the cascade is planned.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 ORDER BY "todo_items"."id" LIMIT $2 FOR UPDATE`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(1, "release", "todo", false))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree") + `(?s).*` + regexp.QuoteMeta("FOR UPDATE OF todo_items")).
+		WithArgs(1).WillReturnRows(subtreeRows())
+	// The subtask goes through the workflow like a direct update, its
+	// version bumped.
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"status"=$2,"version"=version + 1,"updated_at"=$3 WHERE "id" = $4`)).
+		WithArgs(true, "done", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"status"=$2,"version"=version + 1,"updated_at"=$3 WHERE "id" = $4`)).
+		WithArgs(true, "done", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(1, "release", true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	body := []byte(`{"is_done":true,"cascade":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_409_CascadeRefusedWhenASubtaskCantTransition(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	// The workflow doesn't let a todo in review be dropped, so the subtask
+	// in review keeps the release from being dropped with it.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(1, "release", "todo", false))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(1).WillReturnRows(subtreeRows())
+	mock.ExpectRollback()
+
+	body := []byte(`{"status":"wont_do","cascade":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	var resp todoctrl.TransitionErrorResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if resp.Code != problem.CodeIllegalTransition || resp.From != "in_review" || resp.To != "wont_do" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestUpdateTodoItem_200_CascadeCreatesNextOccurrenceOfRecurringSubtask(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	due := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC)
+	columns := []string{"id", "project_id", "title", "status", "is_done", "priority", "due_at", "recurrence", "parent_id"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "is_done"}).AddRow(1, "release", "todo", false))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(1).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(1, 1, "release", "todo", false, 2, nil, "", nil).
+			AddRow(3, 1, "standup", "todo", false, 2, due, "FREQ=DAILY", 1))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"recurrence"=$2,"status"=$3,"version"=version + 1,"updated_at"=$4 WHERE "id" = $5`)).
+		WithArgs(true, "", "done", sqlmock.AnyArg(), 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(3, 1, "standup", "done", true, 2, due, "", 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WithArgs(0, 1, "standup (2026-01-06)", "", "todo", false, nil, 2,
+			due.AddDate(0, 0, 1), "FREQ=DAILY", 3, 1,
+			sqlmock.AnyArg(), sqlmock.AnyArg(), 1, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "todo_items" SET "is_done"=$1,"status"=$2,"version"=version + 1,"updated_at"=$3 WHERE "id" = $4`)).
+		WithArgs(true, "done", sqlmock.AnyArg(), 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(1, "release", true))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}))
+	mock.ExpectCommit()
+
+	body := []byte(`{"is_done":true,"cascade":true}`)
+	req := httptest.NewRequest(http.MethodPatch, "/api/task/todos/1", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestMoveTodoSubtree_409_UnderOwnDescendant(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 ORDER BY "todo_items"."id" LIMIT $2 FOR UPDATE`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(1, "release"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id","project_id" FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "project_id"}).AddRow(4, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).WithArgs(1).WillReturnRows(subtreeRows())
+	mock.ExpectRollback()
+
+	body := []byte(`{"parent_id":4}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/1/move", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package todoctrltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	tagctrl "github.com/alirezamastery/graph_task/controllers/tag"
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/rbac"
+)
+
+func TestCreateTodo_201_CreatesMissingTagsInline(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	ExpectDefaultProject(mock, 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tags"`) + ".*" + regexp.QuoteMeta(`ON CONFLICT ("workspace_id","name") DO NOTHING`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tags" WHERE name IN ($1,$2)`)).
+		WithArgs("backend", "sprint-7").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "backend").AddRow(2, "sprint-7"))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tags"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO "todo_item_tags"`)).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectCommit()
+
+	body := []byte(`{"title":"fix login","tags":[" Backend ","sprint-7","backend"]}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/todos/", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp struct {
+		Tags []struct {
+			Name string `json:"name"`
+		} `json:"tags"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if len(resp.Tags) != 2 || resp.Tags[0].Name != "backend" || resp.Tags[1].Name != "sprint-7" {
+		t.Fatalf("unexpected tags: %+v", resp.Tags)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_200_AllOfTagsFilter(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" WHERE todo_items.id IN (SELECT todo_item_tags.todo_item_id`)+
+		".*"+regexp.QuoteMeta(`HAVING COUNT(DISTINCT tags.id) = $3)`)).
+		WithArgs("backend", "customer-acme", 2).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE todo_items.id IN`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title"}).AddRow(3, "renew contract"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_item_tags" WHERE "todo_item_tags"."todo_item_id" = $1`)).
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"todo_item_id", "tag_id"}).AddRow(3, 1).AddRow(3, 4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "tags" WHERE "tags"."id" IN ($1,$2)`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "backend").AddRow(4, "customer-acme"))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?tags_all=backend,Customer-ACME", nil)
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	var resp struct {
+		Items []struct {
+			Tags []struct {
+				Name string `json:"name"`
+			} `json:"tags"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	if len(resp.Items) != 1 || len(resp.Items[0].Tags) != 2 {
+		t.Fatalf("expected one item with two tags, got %+v", resp.Items)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestCreateTag_400_EmptyName_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupTagRouter(tagctrl.NewTagController(db, rbac.NewPolicy()))
+
+	body := []byte(`{"name":"  "}`)
+	req := httptest.NewRequest(http.MethodPost, "/api/task/tags", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	recorder := httptest.NewRecorder()
+
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
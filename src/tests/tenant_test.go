@@ -0,0 +1,365 @@
+package todoctrltest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/alirezamastery/graph_task/auth"
+	projectctrl "github.com/alirezamastery/graph_task/controllers/project"
+	tagctrl "github.com/alirezamastery/graph_task/controllers/tag"
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+	"github.com/alirezamastery/graph_task/middleware"
+	"github.com/alirezamastery/graph_task/models"
+	"github.com/alirezamastery/graph_task/rbac"
+	"github.com/alirezamastery/graph_task/tenant"
+)
+
+// tenantTables matches the SQL touching tables whose rows belong to a
+// workspace.
+var tenantTables = regexp.MustCompile(`\b(todo_items|projects|tags|todo_dependencies|reminders|users)\b`)
+
+// scopeChecker is a query matcher that matches like the regexp one, and
+// records every statement touching a workspace table without a condition on,
+// or a value for, its workspace_id.
+type scopeChecker struct {
+	mu       sync.Mutex
+	unscoped []string
+}
+
+func (s *scopeChecker) Match(expectedSQL, actualSQL string) error {
+	if tenantTables.MatchString(actualSQL) && !strings.Contains(actualSQL, "workspace_id") {
+		s.mu.Lock()
+		s.unscoped = append(s.unscoped, actualSQL)
+		s.mu.Unlock()
+	}
+	return sqlmock.QueryMatcherRegexp.Match(expectedSQL, actualSQL)
+}
+
+func newScopeCheckedDB(t *testing.T) (*gorm.DB, sqlmock.Sqlmock, *scopeChecker) {
+	t.Helper()
+
+	checker := &scopeChecker{}
+	sqlDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(checker.Match)))
+	if err != nil {
+		t.Fatalf("sqlmock error: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("gorm error: %v", err)
+	}
+	if err := db.Use(tenant.Plugin{}); err != nil {
+		t.Fatalf("tenant plugin error: %v", err)
+	}
+	return db, mock, checker
+}
+
+func setupTenantRouter(db *gorm.DB, issuer *auth.Issuer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middleware.Authentication(issuer, db))
+
+	todo := todoctrl.NewTodoController(db)
+	todo.UsePolicy(rbac.NewPolicy())
+	r.GET("/api/task/todos", todo.GetTodoItemList())
+	r.GET("/api/task/todos/order", todo.GetTodoExecutionOrder())
+	r.GET("/api/task/todos/export", todo.ExportTodoGraph())
+	r.GET("/api/task/todos/search", todo.SearchTodos())
+	r.PATCH("/api/task/todos/bulk", todo.BulkUpdateTodos())
+	r.DELETE("/api/task/todos/bulk", todo.BulkDeleteTodos())
+	r.GET("/api/task/todos/:id", todo.GetTodoItemByID())
+	r.PATCH("/api/task/todos/:id", todo.UpdateTodoItem())
+	r.DELETE("/api/task/todos/:id", todo.DeleteTodoItem())
+	r.GET("/api/task/todos/:id/dependencies", todo.ListTodoDependencies())
+	r.POST("/api/task/todos/:id/dependencies", todo.AddTodoDependency())
+	r.DELETE("/api/task/todos/:id/dependencies/:dep_id", todo.RemoveTodoDependency())
+	r.GET("/api/task/todos/:id/occurrences", todo.ListTodoOccurrences())
+	r.GET("/api/task/todos/:id/reminders", todo.ListTodoReminders())
+	r.POST("/api/task/todos/:id/reminders", todo.AddTodoReminder())
+	r.DELETE("/api/task/todos/:id/reminders/:reminder_id", todo.RemoveTodoReminder())
+	r.GET("/api/task/todos/:id/children", todo.ListTodoChildren())
+	r.GET("/api/task/todos/:id/subtree", todo.GetTodoSubtree())
+	r.POST("/api/task/todos/:id/move", todo.MoveTodoSubtree())
+	r.GET("/api/projects/:pid/todos", todo.ListProjectTodos())
+	r.POST("/api/projects/:pid/todos", todo.CreateProjectTodo())
+
+	tag := tagctrl.NewTagController(db, rbac.NewPolicy())
+	r.GET("/api/task/tags", tag.GetTagList())
+	r.GET("/api/task/tags/:id", tag.GetTagByID())
+	r.PATCH("/api/task/tags/:id", tag.UpdateTag())
+	r.DELETE("/api/task/tags/:id", tag.DeleteTag())
+
+	project := projectctrl.NewProjectController(db, rbac.NewPolicy())
+	r.GET("/api/projects", project.GetProjectList())
+	r.GET("/api/projects/:pid", project.GetProjectByID())
+	r.PATCH("/api/projects/:pid", project.UpdateProject())
+	r.DELETE("/api/projects/:pid", project.DeleteProject())
+	return r
+}
+
+func expectNothing(mock sqlmock.Sqlmock, sql string) {
+	mock.ExpectQuery(regexp.QuoteMeta(sql)).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func expectNoCount(mock sqlmock.Sqlmock, sql string) {
+	mock.ExpectQuery(regexp.QuoteMeta(sql)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+}
+
+func expectNoChange(mock sqlmock.Sqlmock, sql string) {
+	mock.ExpectExec(regexp.QuoteMeta(sql)).WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+func TestTenantPlugin_ScopesStatementsOfTheContextWorkspace(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	scoped := db.WithContext(tenant.WithWorkspace(context.Background(), 2))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)).
+		WithArgs(5, 2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	if err := scoped.First(&models.TodoItem{}, 5).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the todo of another workspace not to be found, got %v", err)
+	}
+
+	// Records are created in the workspace, whatever they say.
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "tags" ("workspace_id","name"`)).
+		WithArgs(2, "backend", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectCommit()
+	if err := scoped.Create(&models.Tag{WorkspaceID: 1, Name: "backend"}).Error; err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "tags" WHERE "tags"."id" = $1 AND "tags"."workspace_id" = $2`)).
+		WithArgs(3, 2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	if err := scoped.Delete(&models.Tag{}, 3).Error; err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	// The workspace condition doesn't make unconditioned deletes possible.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	if err := scoped.Delete(&models.Tag{}).Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("expected a delete without conditions to be refused, got %v", err)
+	}
+
+	// Statements run without a workspace, as the ones of migrations and
+	// background jobs, are not scoped.
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 ORDER BY`)).
+		WithArgs(5, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	if err := db.First(&models.TodoItem{}, 5).Error; err != nil {
+		t.Fatalf("unscoped query failed: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+// The user is in workspace 1, every ID in the requests belongs to workspace
+// 2. No handler may find, change or list those records: the ones addressing
+// them answer 404, never 403, and every statement is scoped to workspace 1.
+func TestTenantIsolation_NoHandlerLeaksAcrossWorkspaces(t *testing.T) {
+	cases := []struct {
+		method, path, body string
+		status             int
+		expect             func(mock sqlmock.Sqlmock)
+	}{
+		{http.MethodGet, "/api/task/todos/20", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodPatch, "/api/task/todos/20", `{"title":"mine now"}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+			mock.ExpectRollback()
+		}},
+		{http.MethodDelete, "/api/task/todos/20", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNoChange(mock, `DELETE FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+			mock.ExpectCommit()
+		}},
+		{http.MethodGet, "/api/task/todos/20/dependencies", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id" FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodPost, "/api/task/todos/20/dependencies", `{"todo_id":21}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			// Only the dependency graph of workspace 1 is locked.
+			mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock(hashtext('dependency_graph'), $1::int)`)).
+				WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items" WHERE id IN ($1,$2) AND "todo_items"."workspace_id" = $3`)).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectRollback()
+		}},
+		{http.MethodDelete, "/api/task/todos/20/dependencies/30", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNoChange(mock, `DELETE FROM "todo_dependencies" WHERE (id = $1 AND (blocker_id = $2 OR blocked_id = $3)) AND "todo_dependencies"."workspace_id" = $4`)
+			mock.ExpectCommit()
+		}},
+		{http.MethodGet, "/api/task/todos/20/occurrences", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id","recurrence","due_at" FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodGet, "/api/task/todos/20/reminders", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id" FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodPost, "/api/task/todos/20/reminders", `{"remind_at":"2030-01-01T09:00:00Z"}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id" FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodDelete, "/api/task/todos/20/reminders/40", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNoChange(mock, `DELETE FROM "reminders" WHERE (id = $1 AND todo_item_id = $2) AND "reminders"."workspace_id" = $3`)
+			mock.ExpectCommit()
+		}},
+		{http.MethodGet, "/api/task/todos/20/children", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `WITH RECURSIVE subtree AS (`)
+		}},
+		{http.MethodGet, "/api/task/todos/20/subtree", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `WITH RECURSIVE subtree AS (`)
+		}},
+		{http.MethodPost, "/api/task/todos/20/move", `{"parent_id":null}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+			mock.ExpectRollback()
+		}},
+		{http.MethodGet, "/api/projects/50/todos", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id" FROM "projects" WHERE "projects"."id" = $1 AND "projects"."workspace_id" = $2`)
+		}},
+		{http.MethodPost, "/api/projects/50/todos", `{"title":"sneaky"}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id" FROM "projects" WHERE "projects"."id" = $1 AND "projects"."workspace_id" = $2`)
+		}},
+		{http.MethodGet, "/api/task/tags/60", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "tags" WHERE "tags"."id" = $1 AND "tags"."workspace_id" = $2`)
+		}},
+		{http.MethodPatch, "/api/task/tags/60", `{"name":"mine"}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "tags" WHERE "tags"."id" = $1 AND "tags"."workspace_id" = $2`)
+		}},
+		{http.MethodDelete, "/api/task/tags/60", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNoChange(mock, `DELETE FROM "tags" WHERE "tags"."id" = $1 AND "tags"."workspace_id" = $2`)
+			mock.ExpectCommit()
+		}},
+		{http.MethodGet, "/api/projects/50", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "projects" WHERE "projects"."id" = $1 AND "projects"."workspace_id" = $2`)
+		}},
+		{http.MethodPatch, "/api/projects/50", `{"name":"mine"}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "projects" WHERE "projects"."id" = $1 AND "projects"."workspace_id" = $2`)
+		}},
+		{http.MethodDelete, "/api/projects/50", "", http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNothing(mock, `SELECT * FROM "projects" WHERE "projects"."id" = $1 AND "projects"."workspace_id" = $2`)
+			mock.ExpectRollback()
+		}},
+		{http.MethodGet, "/api/task/todos", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNoCount(mock, `SELECT count(*) FROM "todo_items" WHERE "todo_items"."workspace_id" = $1`)
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE "todo_items"."workspace_id" = $1`)
+		}},
+		{http.MethodGet, "/api/task/todos/order", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE is_done = $1 AND "todo_items"."workspace_id" = $2`)
+			expectNothing(mock, `SELECT "blocker_id","blocked_id" FROM "todo_dependencies" WHERE "todo_dependencies"."workspace_id" = $1`)
+		}},
+		{http.MethodGet, "/api/task/todos/export", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id","title","is_done","parent_id" FROM "todo_items" WHERE "todo_items"."workspace_id" = $1`)
+			expectNothing(mock, `SELECT "blocker_id","blocked_id" FROM "todo_dependencies" WHERE "todo_dependencies"."workspace_id" = $1`)
+		}},
+		{http.MethodGet, "/api/task/todos/search?q=invoice", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNoCount(mock, `SELECT count(*) FROM "todo_items" WHERE search_vector @@ websearch_to_tsquery('english', $1) AND todo_items.workspace_id = $2`)
+			expectNothing(mock, `WHERE search_vector @@ q AND workspace_id = $4`)
+		}},
+		{http.MethodPatch, "/api/task/todos/bulk", `{"items":[{"id":20,"is_done":true}]}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			mock.ExpectBegin()
+			expectNothing(mock, `SELECT * FROM "todo_items" WHERE "todo_items"."id" = $1 AND "todo_items"."workspace_id" = $2`)
+			mock.ExpectRollback()
+		}},
+		{http.MethodDelete, "/api/task/todos/bulk", `{"ids":[20]}`, http.StatusNotFound, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT "id","version" FROM "todo_items" WHERE id IN ($1) AND "todo_items"."workspace_id" = $2`)
+		}},
+		{http.MethodGet, "/api/task/tags", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "tags" WHERE "tags"."workspace_id" = $1`)
+		}},
+		{http.MethodGet, "/api/projects", "", http.StatusOK, func(mock sqlmock.Sqlmock) {
+			expectNothing(mock, `SELECT * FROM "projects" WHERE "projects"."workspace_id" = $1`)
+		}},
+	}
+
+	for _, tc := range cases {
+		t.Run(fmt.Sprintf("%s %s", tc.method, tc.path), func(t *testing.T) {
+			db, mock, checker := newScopeCheckedDB(t)
+			issuer := newTestIssuer()
+			router := setupTenantRouter(db, issuer)
+			token, _, _ := issuer.AccessToken(1)
+
+			ExpectPrincipal(mock, 1, "admin", 1)
+			tc.expect(mock)
+
+			recorder := sendJSON(router, tc.method, tc.path, token, tc.body)
+			if recorder.Code != tc.status {
+				t.Fatalf("expected %d, got %d, body=%s", tc.status, recorder.Code, recorder.Body.String())
+			}
+			if len(checker.unscoped) > 0 {
+				t.Fatalf("expected every statement to be scoped to the workspace, got %q", checker.unscoped)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("db expectations not met: %v", err)
+			}
+		})
+	}
+}
+
+func TestTenantUniqueness_NamesAndTitlesAreUniquePerWorkspace(t *testing.T) {
+	cases := []struct {
+		model  any
+		index  string
+		fields []string
+	}{
+		{&models.TodoItem{}, "idx_todo_items_workspace_project_title", []string{"workspace_id", "project_id", "title"}},
+		{&models.Project{}, "idx_projects_workspace_name", []string{"workspace_id", "name"}},
+		{&models.Tag{}, "idx_tags_workspace_name", []string{"workspace_id", "name"}},
+	}
+
+	for _, tc := range cases {
+		s, err := schema.Parse(tc.model, &sync.Map{}, schema.NamingStrategy{})
+		if err != nil {
+			t.Fatalf("schema error: %v", err)
+		}
+
+		var fields []string
+		for _, idx := range s.ParseIndexes() {
+			if idx.Name != tc.index {
+				continue
+			}
+			if idx.Class != "UNIQUE" {
+				t.Fatalf("expected %s to be unique, got %q", tc.index, idx.Class)
+			}
+			for _, f := range idx.Fields {
+				fields = append(fields, f.DBName)
+			}
+		}
+		if !slices.Equal(fields, tc.fields) {
+			t.Fatalf("expected %s on %v, got %v", tc.index, tc.fields, fields)
+		}
+		for _, f := range s.Fields {
+			if f.Unique {
+				t.Fatalf("expected no deployment-wide unique column on %s, got %s", s.Table, f.DBName)
+			}
+		}
+	}
+}
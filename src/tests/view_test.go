@@ -0,0 +1,177 @@
+package todoctrltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+
+	todoctrl "github.com/alirezamastery/graph_task/controllers/todo"
+)
+
+func getJSON(t *testing.T, router *gin.Engine, url string) map[string]any {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, url, nil)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d, body=%s", recorder.Code, recorder.Body.String())
+	}
+	var resp map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid json response: %v, body=%s", err, recorder.Body.String())
+	}
+	return resp
+}
+
+func keysOf(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestGetTodoItemList_200_SparseFieldsWithProject(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "project_id", "title", "description"}).
+			AddRow(1, 2, "a", "long text").
+			AddRow(2, 2, "b", "more text"))
+	expectTagPreload(mock)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "projects" WHERE id IN ($1)`)).
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "work"))
+
+	resp := getJSON(t, router, "/api/task/todos/?fields=title&include=project")
+
+	items, _ := resp["items"].([]any)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 items, got %v", resp["items"])
+	}
+	item := items[0].(map[string]any)
+	if keys := keysOf(item); !equalStrings(keys, []string{"id", "project", "title"}) {
+		t.Fatalf("expected id, project and title, got %v", keys)
+	}
+	if project := item["project"].(map[string]any); project["name"] != "work" {
+		t.Fatalf("expected the embedded project, got %v", item["project"])
+	}
+	if resp["count"] != float64(2) {
+		t.Fatalf("expected the page metadata to stay, got %v", resp)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemByID_200_EmbedsChildrenWithSameFields(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(1, "release", false))
+	expectTagPreload(mock)
+	mock.ExpectQuery("todo_dependencies").WillReturnRows(sqlmock.NewRows([]string{"blocker_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).
+			AddRow(1, "release", false, nil).
+			AddRow(2, "changelog", true, 1))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items" WHERE parent_id IN ($1) ORDER BY id`)).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(2, "changelog", true, 1))
+	expectTagPreload(mock)
+
+	resp := getJSON(t, router, "/api/task/todos/1?fields=title,progress&include=children,tags")
+
+	if keys := keysOf(resp); !equalStrings(keys, []string{"children", "id", "progress", "tags", "title"}) {
+		t.Fatalf("unexpected fields %v", keys)
+	}
+	children, _ := resp["children"].([]any)
+	if len(children) != 1 {
+		t.Fatalf("expected one child, got %v", resp["children"])
+	}
+	child := children[0].(map[string]any)
+	if keys := keysOf(child); !equalStrings(keys, []string{"id", "tags", "title"}) {
+		t.Fatalf("unexpected child fields %v", keys)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemByID_200_HasTheFieldsOfListItems(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "todo_items"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done"}).AddRow(1, "release", false))
+	expectTagPreload(mock)
+	mock.ExpectQuery("todo_dependencies").WillReturnRows(sqlmock.NewRows([]string{"blocker_id"}))
+	mock.ExpectQuery(regexp.QuoteMeta("WITH RECURSIVE subtree")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "is_done", "parent_id"}).AddRow(1, "release", false, nil))
+
+	resp := getJSON(t, router, "/api/task/todos/1")
+
+	for _, field := range []string{"id", "created_at", "updated_at", "series_id", "version", "progress"} {
+		if _, ok := resp[field]; !ok {
+			t.Fatalf("expected %q in the todo, got %v", field, keysOf(resp))
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
+
+func TestGetTodoItemList_400_UnknownField_NoDBCall(t *testing.T) {
+	db, mock, sqlDB := NewMockGormDB(t)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	router := SetupRouter(todoctrl.NewTodoController(db))
+
+	for _, query := range []string{"fields=id,password", "include=owner"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/task/todos/?"+query, nil)
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d, body=%s", query, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("db expectations not met: %v", err)
+	}
+}
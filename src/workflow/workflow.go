@@ -0,0 +1,164 @@
+package workflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// ConfigEnv names the environment variable holding the path of a JSON workflow
+// config. Without it the default workflow is used.
+const ConfigEnv = "WORKFLOW_CONFIG"
+
+// State is a status a todo can be in. Todos in a Done state count as done:
+// they report is_done=true and no longer block other todos.
+type State struct {
+	Name string `json:"name" example:"in_progress"`
+	Done bool   `json:"done" example:"false"`
+}
+
+// Workflow is the state machine todo statuses move through.
+//
+// Initial is the status of new todos and the one a todo goes back to when a
+// client sets is_done=false. DoneState is the one a todo moves to when a client
+// sets is_done=true.
+type Workflow struct {
+	Initial     string              `json:"initial" example:"todo"`
+	DoneState   string              `json:"done_state" example:"done"`
+	States      []State             `json:"states"`
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// Default returns the workflow used when none is configured:
+//
+//	todo ──> in_progress ──> in_review ──> done
+//	  │           │                         │
+//	  └──> done   └──> wont_do     reopen ──┘
+func Default() *Workflow {
+	return &Workflow{
+		Initial:   "todo",
+		DoneState: "done",
+		States: []State{
+			{Name: "todo"},
+			{Name: "in_progress"},
+			{Name: "in_review"},
+			{Name: "done", Done: true},
+			{Name: "wont_do", Done: true},
+		},
+		Transitions: map[string][]string{
+			"todo":        {"in_progress", "done", "wont_do"},
+			"in_progress": {"todo", "in_review", "done", "wont_do"},
+			"in_review":   {"in_progress", "done"},
+			"done":        {"todo"},
+			"wont_do":     {"todo"},
+		},
+	}
+}
+
+// FromEnv loads the workflow from the file named by WORKFLOW_CONFIG, or
+// returns the default one when the variable is not set.
+func FromEnv() (*Workflow, error) {
+	path := os.Getenv(ConfigEnv)
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates a JSON workflow config.
+func Parse(data []byte) (*Workflow, error) {
+	wf := &Workflow{}
+	if err := json.Unmarshal(data, wf); err != nil {
+		return nil, err
+	}
+	if err := wf.Validate(); err != nil {
+		return nil, err
+	}
+	return wf, nil
+}
+
+// Validate checks that every state the workflow refers to is declared.
+func (wf *Workflow) Validate() error {
+	if len(wf.States) == 0 {
+		return errors.New("workflow has no states")
+	}
+
+	seen := map[string]bool{}
+	for _, s := range wf.States {
+		if s.Name == "" {
+			return errors.New("workflow state without a name")
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("workflow state %q declared twice", s.Name)
+		}
+		seen[s.Name] = true
+	}
+
+	if !seen[wf.Initial] {
+		return fmt.Errorf("initial state %q is not declared", wf.Initial)
+	}
+	if !seen[wf.DoneState] {
+		return fmt.Errorf("done state %q is not declared", wf.DoneState)
+	}
+	if wf.IsDone(wf.Initial) {
+		return fmt.Errorf("initial state %q cannot be a done state", wf.Initial)
+	}
+	if !wf.IsDone(wf.DoneState) {
+		return fmt.Errorf("done state %q must be marked as done", wf.DoneState)
+	}
+
+	for from, targets := range wf.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("transition from undeclared state %q", from)
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return fmt.Errorf("transition from %q to undeclared state %q", from, to)
+			}
+		}
+	}
+
+	return nil
+}
+
+// HasState reports whether name is one of the workflow's states.
+func (wf *Workflow) HasState(name string) bool {
+	for _, s := range wf.States {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDone reports whether name is a done state.
+func (wf *Workflow) IsDone(name string) bool {
+	for _, s := range wf.States {
+		if s.Name == name {
+			return s.Done
+		}
+	}
+	return false
+}
+
+// Allowed returns the states a todo in the given state may move to.
+func (wf *Workflow) Allowed(from string) []string {
+	targets := wf.Transitions[from]
+	if targets == nil {
+		return []string{}
+	}
+	return targets
+}
+
+// CanTransition reports whether a todo may move from one state to another.
+// Staying in the same state is always allowed.
+func (wf *Workflow) CanTransition(from, to string) bool {
+	return from == to || slices.Contains(wf.Transitions[from], to)
+}